@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version, commit and buildTime describe the build of the binary. They can be set
+// when building, as in
+//
+//	go build -ldflags "-X main.version=1.1.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)" ./cmd/api
+//
+// and otherwise commit and buildTime are taken from the version control information
+// which the go command embeds in binaries built from a repository, buildTime then
+// being the time of the commit.
+var (
+	version   = "1.0.0"
+	commit    string
+	buildTime string
+)
+
+// buildInfo is the description of the build reported by -version and the
+// healthcheck
+type buildInfo struct {
+	version   string
+	commit    string
+	buildTime string
+	goVersion string
+	// modified is set when the binary was built from a working tree with
+	// uncommitted changes
+	modified bool
+}
+
+// readBuildInfo describes the running binary
+func readBuildInfo() buildInfo {
+	info := buildInfo{
+		version:   version,
+		commit:    commit,
+		buildTime: buildTime,
+		goVersion: runtime.Version(),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.commit == "" {
+				info.commit = setting.Value
+			}
+		case "vcs.time":
+			if info.buildTime == "" {
+				info.buildTime = setting.Value
+			}
+		case "vcs.modified":
+			info.modified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
+
+// String formats the build info for -version
+func (b buildInfo) String() string {
+	s := "greenlight api " + b.version
+	if b.commit != "" {
+		s += " (" + b.commit
+		if b.modified {
+			s += ", modified"
+		}
+		s += ")"
+	}
+	if b.buildTime != "" {
+		s += " built " + b.buildTime
+	}
+	return fmt.Sprintf("%s with %s", s, b.goVersion)
+}
+
+// runVersion implements "api version" and "api -version", which print the build info
+func runVersion(args []string) int {
+	fmt.Println(readBuildInfo())
+	return 0
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/i18n"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// maxBulkItems caps the number of movies in a single bulk request
+const maxBulkItems = 100
+
+// bulkItemResult reports the outcome for one item of a bulk request, identified by
+// its position in the request
+type bulkItemResult struct {
+	Index  int                 `json:"index"`
+	Status string              `json:"status"`
+	Movie  *data.Movie         `json:"movie,omitempty"`
+	Errors map[string][]string `json:"errors,omitempty"`
+}
+
+// bulkCreateMoviesHandler creates many movies in one request. The expected JSON
+// structure for the request body is an array of movies in the same format as for
+// createMovieHandler:
+//
+//	[
+//	  {"title": "Movie 1", "year": 2023, "runtime": "120 mins", "genres": ["drama"]},
+//	  {"title": "Movie 2", "year": 2021, "runtime": "95 mins", "genres": ["comedy"]}
+//	]
+//
+// By default (?mode=atomic) the movies are only inserted if every one of them is
+// valid, in a single transaction. With ?mode=best_effort the valid movies are
+// inserted and the invalid ones skipped.
+//
+// The response contains one result per movie, in request order, with a status of
+// "created", "invalid" (with the validation errors), "skipped" (valid, but not
+// inserted because another movie was invalid) or "failed". The status code is 201
+// Created if every movie was created, 422 Unprocessable Entity if none were because
+// of validation errors, and 200 OK otherwise.
+func (app *application) bulkCreateMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	mode := app.readString(r.URL.Query(), "mode", "atomic")
+	v.Check(validator.PermittedValue(mode, "atomic", "best_effort"), "mode", "must be atomic or best_effort")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var input []movieInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// validateBody has checked the number of movies against the body schema
+
+	results := make([]bulkItemResult, len(input))
+	var valid []*data.Movie
+	var validIndexes []int
+
+	for i, item := range input {
+		movie := item.movie()
+		results[i].Index = i
+
+		mv := validator.New()
+		if data.ValidateMovie(mv, movie); !mv.Valid() {
+			results[i].Status = "invalid"
+			results[i].Errors = i18n.TranslateAll(app.language(r), mv.Errors)
+			continue
+		}
+
+		valid = append(valid, movie)
+		validIndexes = append(validIndexes, i)
+	}
+
+	switch {
+	case mode == "atomic" && len(valid) < len(input):
+		for _, i := range validIndexes {
+			results[i].Status = "skipped"
+		}
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, envelope{"results": results})
+		return
+
+	case mode == "atomic":
+		err = app.modelsFor(r).Movies.InsertAll(valid)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for n, i := range validIndexes {
+			results[i].Status = "created"
+			results[i].Movie = valid[n]
+		}
+
+	case len(valid) > 0:
+		errs, err := app.modelsFor(r).Movies.InsertEach(valid)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for n, i := range validIndexes {
+			if errs[n] != nil {
+				app.logError(r, errs[n])
+				results[i].Status = "failed"
+				continue
+			}
+			results[i].Status = "created"
+			results[i].Movie = valid[n]
+		}
+	}
+
+	created := 0
+	for _, result := range results {
+		if result.Status == "created" {
+			created++
+			app.publishMovieEvent(r.Context(), "movie.created", result.Movie)
+		}
+	}
+
+	status := http.StatusOK
+	switch created {
+	case len(results):
+		status = http.StatusCreated
+	case 0:
+		status = http.StatusUnprocessableEntity
+	}
+
+	err = app.writeJSON(w, status, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// bulkDeleteMoviesHandler deletes many movies in one transaction, selected either by
+// a list of IDs or UUIDs or by a filter. The expected JSON structure for the request
+// body is one of:
+//
+//	{"ids": [1, 2, "0b7f7a4e-4bb3-4c59-8d6c-6a3f5e3f7a10"]}
+//
+//	{"filter": {"year_before": 1950, "genres": ["western"]}}
+//
+// The filter supports title (full-text search), genres (all must match), year_before
+// and year_after (exclusive), and must set at least one of them. As a safeguard,
+// nothing is deleted if more than max movies (default 1000) would be.
+//
+// The response contains the number of deleted movies.
+func (app *application) bulkDeleteMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs    []any `json:"ids"`
+		Filter *struct {
+			Title      string   `json:"title"`
+			Genres     []string `json:"genres"`
+			YearBefore int32    `json:"year_before"`
+			YearAfter  int32    `json:"year_after"`
+		} `json:"filter"`
+		Max *int `json:"max"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	max := 1000
+	if input.Max != nil {
+		max = *input.Max
+	}
+	v.Check(validator.Between(max, 1, 100_000), "max", "must be between 1 and 100000")
+
+	v.Check(input.IDs != nil || input.Filter != nil, "ids", "either ids or filter must be provided")
+	v.Check(input.IDs == nil || input.Filter == nil, "filter", "must not be provided together with ids")
+
+	var ids []int64
+	var uuids []string
+	var filter *data.MovieFilter
+
+	switch {
+	case input.IDs != nil:
+		keys := app.validateMovieKeys(v, app.movieKeysFromJSON(v, input.IDs))
+		for _, key := range keys {
+			if validator.Match(key, validator.UUIDRX) {
+				uuids = append(uuids, key)
+				continue
+			}
+			id, _ := strconv.ParseInt(key, 10, 64)
+			ids = append(ids, id)
+		}
+
+	case input.Filter != nil:
+		filter = &data.MovieFilter{
+			Title:      input.Filter.Title,
+			Genres:     input.Filter.Genres,
+			YearBefore: input.Filter.YearBefore,
+			YearAfter:  input.Filter.YearAfter,
+		}
+		v.Check(!filter.IsEmpty(), "filter", "must set at least one of title, genres, year_before or year_after")
+		v.Check(filter.YearBefore >= 0 && filter.YearAfter >= 0, "filter", "years must be positive")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deleted, err := app.modelsFor(r).Movies.DeleteMany(ids, uuids, filter, max)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTooManyRows):
+			v.AddError("max", fmt.Sprintf("more than %d movies would be deleted", max))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, movie := range deleted {
+		app.publishMovieEvent(r.Context(), "movie.deleted", movieDeletedEvent{UUID: movie.UUID, Version: movie.Version})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deleted": len(deleted)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
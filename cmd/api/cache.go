@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
+)
+
+const (
+	// responseCacheGenerationKey is the kvstore key of the counter which is part of
+	// every response cache key, so that incrementing it invalidates the whole cache
+	responseCacheGenerationKey = "cache:responses:generation"
+	// maxCachedResponseBytes is the size above which a response is not cached
+	maxCachedResponseBytes = 256 * 1024
+)
+
+var (
+	responseCacheHits   = expvar.NewInt("response_cache_hits_total")
+	responseCacheMisses = expvar.NewInt("response_cache_misses_total")
+)
+
+// cachedResponse is a response as stored in the response cache
+type cachedResponse struct {
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// cacheResponse serves successful responses of the route from the kvstore for
+// -cache-ttl, keyed by the tenant, URL and Accept header of the request. Responses are
+// stored in the kvstore, so with -kvstore=redis the cache is shared by every
+// instance. Every movie write invalidates the whole cache (see invalidateResponses).
+//
+// A cache hit doesn't run the handler, so it isn't counted as a view of the movie. A
+// failing cache is logged and bypassed rather than failing the request.
+func (app *application) cacheResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := app.responseCacheKey(r)
+		if err != nil {
+			app.logError(r, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cached, err := app.kv.Get(r.Context(), key)
+		switch {
+		case err == nil:
+			var res cachedResponse
+			if err := json.Unmarshal(cached, &res); err == nil {
+				responseCacheHits.Add(1)
+
+				// headers set by the middleware in front of the cache are kept
+				for name, values := range res.Header {
+					if _, ok := w.Header()[name]; !ok {
+						w.Header()[name] = values
+					}
+				}
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(http.StatusOK)
+				w.Write(res.Body)
+				return
+			}
+		case !errors.Is(err, kvstore.ErrNotFound):
+			app.logError(r, err)
+		}
+
+		responseCacheMisses.Add(1)
+		w.Header().Set("X-Cache", "MISS")
+
+		rw := &cacheWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		if rw.status != http.StatusOK || rw.overflow {
+			return
+		}
+
+		header := rw.snapshot.Clone()
+		header.Del("X-Cache")
+		js, err := json.Marshal(cachedResponse{Header: header, Body: rw.body})
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		err = app.kv.Set(r.Context(), key, js, app.config.cache.ttl)
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+}
+
+// responseCacheKey returns the cache key of a request in the current generation of
+// the cache
+func (app *application) responseCacheKey(r *http.Request) (string, error) {
+	generation, err := app.kv.Get(r.Context(), responseCacheGenerationKey)
+	switch {
+	case errors.Is(err, kvstore.ErrNotFound):
+		generation = []byte("0")
+	case err != nil:
+		return "", err
+	}
+
+	// the Accept header selects JSON, JSON:API, MessagePack or NDJSON, and the same
+	// URL lists a different catalog for each tenant
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%s", data.TenantID(r.Context()), r.URL.RequestURI(), r.Header.Get("Accept"))))
+
+	return "cache:responses:" + string(generation) + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// invalidateResponses empties the response cache, by moving on to a new generation
+// of cache keys. The entries of earlier generations expire after -cache-ttl.
+func (app *application) invalidateResponses() {
+	if app.config.cache.ttl <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := app.kv.Incr(ctx, responseCacheGenerationKey, 0)
+	if err != nil {
+		app.logger.Error(err.Error(), "cache", "responses")
+	}
+}
+
+// cacheWriter passes a response through while keeping a copy of its status, headers
+// and body for the response cache
+type cacheWriter struct {
+	http.ResponseWriter
+	status   int
+	snapshot http.Header
+	body     []byte
+	// overflow is set once the body is too large to be cached
+	overflow bool
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *cacheWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+		cw.snapshot = cw.Header().Clone()
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.overflow {
+		if len(cw.body)+len(b) > maxCachedResponseBytes {
+			cw.overflow = true
+			cw.body = nil
+		} else {
+			cw.body = append(cw.body, b...)
+		}
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// changelogData is the versioned changelog of API behavior changes. New entries are
+// added to changelog.json alongside the change they describe.
+//
+//go:embed changelog.json
+var changelogData []byte
+
+var (
+	changelogAreas = []string{"endpoints", "fields", "limits"}
+	changelogTypes = []string{"added", "changed", "deprecated", "removed"}
+)
+
+type changelog struct {
+	SchemaVersion int              `json:"schema_version"`
+	Entries       []changelogEntry `json:"entries"`
+}
+
+type changelogEntry struct {
+	ID      string `json:"id"`
+	Date    string `json:"date"`
+	Area    string `json:"area"`
+	Type    string `json:"type"`
+	Summary string `json:"summary"`
+	// EffectiveDate is when an announced change takes effect, if it is in the future
+	EffectiveDate string `json:"effective_date,omitempty"`
+}
+
+// loadChangelog parses and checks the embedded changelog, so that a malformed
+// entry stops the server at startup rather than breaking the endpoint.
+func loadChangelog() (*changelog, error) {
+	var cl changelog
+
+	err := json.Unmarshal(changelogData, &cl)
+	if err != nil {
+		return nil, fmt.Errorf("changelog: %w", err)
+	}
+
+	if cl.SchemaVersion != 1 {
+		return nil, fmt.Errorf("changelog: unsupported schema version %d", cl.SchemaVersion)
+	}
+
+	ids := make(map[string]bool)
+	for i, entry := range cl.Entries {
+		v := validator.New()
+		v.Check(entry.ID != "", "id", "must be provided")
+		v.Check(!ids[entry.ID], "id", "must be unique")
+		v.Check(isISODate(entry.Date), "date", "must be a date in YYYY-MM-DD format")
+		v.Check(entry.EffectiveDate == "" || isISODate(entry.EffectiveDate), "effective_date", "must be a date in YYYY-MM-DD format")
+		v.Check(validator.PermittedValue(entry.Area, changelogAreas...), "area", "must be one of the known areas")
+		v.Check(validator.PermittedValue(entry.Type, changelogTypes...), "type", "must be one of the known types")
+		v.Check(entry.Summary != "", "summary", "must be provided")
+		if !v.Valid() {
+			return nil, fmt.Errorf("changelog: entry %d (%q): %v", i, entry.ID, v.Errors)
+		}
+		ids[entry.ID] = true
+	}
+
+	// serve the newest entries first
+	slices.SortStableFunc(cl.Entries, func(a, b changelogEntry) int {
+		switch {
+		case a.Date > b.Date:
+			return -1
+		case a.Date < b.Date:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return &cl, nil
+}
+
+func isISODate(value string) bool {
+	_, err := time.Parse(time.DateOnly, value)
+	return err == nil
+}
+
+// changelogHandler serves the structured changelog of API behavior changes, newest
+// first. It can be filtered with ?area= (endpoints, fields or limits) and
+// ?since=YYYY-MM-DD.
+func (app *application) changelogHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	area := app.readString(qs, "area", "")
+	v.Check(area == "" || validator.PermittedValue(area, changelogAreas...), "area", "must be one of endpoints, fields or limits")
+
+	since := app.readString(qs, "since", "")
+	v.Check(since == "" || isISODate(since), "since", "must be a date in YYYY-MM-DD format")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries := []changelogEntry{}
+	for _, entry := range app.changelog.Entries {
+		if area != "" && entry.Area != area {
+			continue
+		}
+		// dates are in YYYY-MM-DD format, so they compare correctly as strings
+		if since != "" && entry.Date < since {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=3600")
+
+	env := envelope{
+		"schema_version": app.changelog.SchemaVersion,
+		"entries":        entries,
+	}
+
+	err := app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies parses the comma-separated CIDR ranges of -trusted-proxies. A
+// bare address stands for itself.
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", part)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", part)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+
+	return proxies, nil
+}
+
+// isTrustedProxy reports whether addr is in one of the -trusted-proxies ranges
+func (app *application) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client making a request. The forwarding
+// headers can be set by anyone, so they are only believed when the peer is a trusted
+// proxy: X-Forwarded-For is then read from the right, skipping the trusted proxies
+// which appended to it, and the first other address is the client's. X-Real-IP is
+// used when there is no X-Forwarded-For.
+func (app *application) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !app.isTrustedProxy(peer) {
+		return host
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// a malformed hop can't be trusted further, so stop at the last good one
+				break
+			}
+			client = addr
+			if !app.isTrustedProxy(addr) {
+				break
+			}
+		}
+		return client.Unmap().String()
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+
+	return host
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipWriters = sync.Pool{
+		New: func() any { return gzip.NewWriter(io.Discard) },
+	}
+	zstdWriters = sync.Pool{
+		New: func() any {
+			zw, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstd.SpeedDefault))
+			return zw
+		},
+	}
+)
+
+// compress compresses responses of at least the configured minimum size with zstd
+// or gzip, whichever the client prefers out of the encodings it accepts (zstd wins
+// ties). Smaller responses are sent as they are, as compressing them costs more
+// than it saves. Every compressible response varies by Accept-Encoding.
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// WebSocket upgrades need the original ResponseWriter to hijack it. HEAD
+		// requests are compressed like GET, so that their headers are the same.
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateContentEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        app.config.compress.minSize,
+		}
+
+		next.ServeHTTP(cw, r)
+
+		// not deferred, so that after a panic recoverPanic can still send its error
+		// response if nothing was written
+		err := cw.Close()
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+}
+
+// negotiateContentEncoding picks zstd or gzip from an Accept-Encoding header, by
+// their quality values, or returns an empty string if the client accepts neither
+func negotiateContentEncoding(header string) string {
+	best, bestQ := "", 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "zstd" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if q > bestQ || (q == bestQ && q > 0 && coding == "zstd") {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best
+}
+
+// compressWriter holds back the start of a response until it knows whether the
+// response reaches the minimum size, and then either compresses it or writes it as
+// it is.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	encoder io.WriteCloser
+	// decided is set once the response is known to be compressed or not
+	decided bool
+	// passthrough is set for responses which are written uncompressed
+	passthrough bool
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+
+	// responses without a body, or which are already encoded or streamed as events,
+	// are never compressed
+	h := cw.Header()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" || strings.HasPrefix(h.Get("Content-Type"), "text/event-stream") {
+		cw.passthrough = true
+		cw.decided = true
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	switch {
+	case cw.passthrough:
+		return cw.ResponseWriter.Write(b)
+	case cw.decided:
+		return cw.encoder.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		err := cw.startEncoding()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush sends what has been written so far, compressing it if the response is
+// compressed, so that streamed responses reach the client as they are written
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.WriteHeader(http.StatusOK)
+		}
+		// a flushed response is a stream of unknown size, so it is compressed
+		if !cw.passthrough && cw.startEncoding() != nil {
+			return
+		}
+	}
+
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok && !cw.passthrough {
+		flusher.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// startEncoding sends the headers of a compressed response and the buffered start
+// of its body
+func (cw *compressWriter) startEncoding() error {
+	cw.decided = true
+
+	h := cw.Header()
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	switch cw.encoding {
+	case "zstd":
+		zw := zstdWriters.Get().(*zstd.Encoder)
+		zw.Reset(cw.ResponseWriter)
+		cw.encoder = zw
+	default:
+		gw := gzipWriters.Get().(*gzip.Writer)
+		gw.Reset(cw.ResponseWriter)
+		cw.encoder = gw
+	}
+
+	_, err := cw.encoder.Write(cw.buf)
+	cw.buf = nil
+	return err
+}
+
+// Close finishes the response: small responses are written as they are, and the
+// encoder of compressed ones is flushed and returned to its pool.
+func (cw *compressWriter) Close() error {
+	switch {
+	case cw.passthrough:
+		return nil
+
+	case !cw.decided:
+		if cw.status == 0 {
+			// the handler wrote nothing at all
+			return nil
+		}
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(cw.buf)
+		return err
+	}
+
+	err := cw.encoder.Close()
+
+	switch encoder := cw.encoder.(type) {
+	case *zstd.Encoder:
+		zstdWriters.Put(encoder)
+	case *gzip.Writer:
+		gzipWriters.Put(encoder)
+	}
+
+	return err
+}
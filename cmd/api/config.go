@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes the environment variables which set the configuration flags
+const envPrefix = "GREENLIGHT_"
+
+// applyConfigLayers sets the flags of fs which weren't given on the command line
+// from their environment variable or, failing that, from the configuration file, if
+// any. The value of every setting is checked by its flag, and all the problems are
+// reported together.
+func applyConfigLayers(fs *flag.FlagSet, file string) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var settings map[string]string
+	if file != "" {
+		var err error
+		settings, err = readConfigFile(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	var problems []string
+	for name := range settings {
+		if fs.Lookup(name) == nil || name == "config" {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting %q", file, name))
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || f.Name == "config" {
+			return
+		}
+
+		env := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(env); ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid value %q: %v", env, value, err))
+			}
+			return
+		}
+
+		if value, ok := settings[f.Name]; ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s: invalid value %q: %v", file, f.Name, value, err))
+			}
+		}
+	})
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// readConfigFile reads the settings of a YAML configuration file, keyed by the names
+// of their flags. Settings may be grouped by the prefix of their names, so that
+//
+//	db:
+//	  dsn: postgres://localhost/greenlight
+//	  max-open-conns: 25
+//
+// is the same as db-dsn and db-max-open-conns. Lists, such as kafka-brokers, may be
+// written as YAML sequences.
+func readConfigFile(file string) (map[string]string, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+	err = yaml.Unmarshal(contents, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	settings := make(map[string]string)
+	err = flattenConfig(settings, "", doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return settings, nil
+}
+
+// flattenConfig adds the settings of a YAML mapping to settings, joining the keys of
+// nested mappings with dashes
+func flattenConfig(settings map[string]string, prefix string, doc map[string]any) error {
+	for key, value := range doc {
+		name := key
+		if prefix != "" {
+			name = prefix + "-" + key
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			err := flattenConfig(settings, name, value)
+			if err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			settings[name] = strings.Join(items, ",")
+		case nil:
+			return fmt.Errorf("%s: missing value", name)
+		default:
+			settings[name] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+// validateConfig checks the settings of the configuration, under the names of their
+// flags, so that every problem is reported at startup rather than surfacing later as
+// a runtime failure
+func validateConfig(v *validator.Validator, cfg config) {
+	v.Check(validator.Between(cfg.port, 1, 65535), "port", "must be between 1 and 65535")
+	v.Check(validator.Between(cfg.grpc.port, 0, 65535), "grpc-port", "must be between 0 and 65535")
+	v.Check(cfg.grpc.port != cfg.port, "grpc-port", "must not be -port")
+	v.Check(validator.PermittedValue(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+
+	var level slog.Level
+	v.Check(level.UnmarshalText([]byte(cfg.log.level)) == nil, "log-level", "must be debug, info, warn or error")
+	v.Check(validator.PermittedValue(cfg.log.format, "", "text", "json"), "log-format", "must be text or json")
+	v.Check(cfg.log.maxSize >= 1, "log-max-size", "must be at least 1")
+	v.Check(cfg.log.maxAge >= 0, "log-max-age", "must not be negative")
+	v.Check(cfg.log.maxBackups >= 0, "log-max-backups", "must not be negative")
+
+	v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+	v.Check(cfg.db.maxOpenConns >= 1, "db-max-open-conns", "must be at least 1")
+	v.Check(cfg.db.maxIdleTime >= 0, "db-max-idle-time", "must not be negative")
+	v.Check(cfg.db.slowQueryThreshold >= 0, "db-slow-query-threshold", "must not be negative")
+
+	v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+	v.Check(cfg.limiter.burst >= 1, "limiter-burst", "must be at least 1")
+	v.Check(float64(cfg.limiter.burst) >= cfg.limiter.rps, "limiter-burst", "must not be less than -limiter-rps")
+
+	v.Check(validator.Between(cfg.chaos.errorRate, 0, 1), "chaos-error-rate", "must be between 0 and 1")
+	v.Check(cfg.chaos.maxLatency >= 0, "chaos-max-latency", "must not be negative")
+
+	v.Check(cfg.auth.maxFailures >= 0, "auth-max-failures", "must not be negative")
+	v.Check(cfg.auth.lockout > 0, "auth-lockout", "must be greater than zero")
+	v.Check(cfg.auth.maxLockout >= cfg.auth.lockout, "auth-max-lockout", "must not be less than -auth-lockout")
+	v.Check(validator.PermittedValue(cfg.kvstore.backend, "memory", "redis"), "kvstore", "must be memory or redis")
+	v.Check(cfg.kvstore.backend != "redis" || cfg.kvstore.redisURL != "", "redis-url", "must be provided when -kvstore=redis")
+
+	v.Check(cfg.cache.ttl >= 0, "cache-ttl", "must not be negative")
+	v.Check(cfg.movieCache.size >= 0, "movie-cache-size", "must not be negative")
+	v.Check(cfg.movieCache.size == 0 || cfg.movieCache.ttl > 0, "movie-cache-ttl", "must be greater than zero when -movie-cache-size is set")
+	v.Check(cfg.statsCacheTTL >= 0, "stats-cache-ttl", "must not be negative")
+	v.Check(cfg.eventsBuffer >= 0, "events-buffer", "must not be negative")
+
+	v.Check(validator.Between(cfg.shadow.sampleRate, 0, 1), "shadow-sample-rate", "must be between 0 and 1")
+	v.Check(cfg.webhooks.maxAttempts >= 1, "webhook-max-attempts", "must be at least 1")
+	v.Check(cfg.usage.monthlyQuota >= 0, "usage-monthly-quota", "must not be negative")
+	v.Check(!cfg.debug || cfg.env != "production", "debug", "must not be set in production")
+	v.Check(validator.PermittedValue(cfg.runtimeFormat, runtimeFormats...), "runtime-format", "must be string, number or human")
+	v.Check(cfg.compress.minSize >= 0, "compress-min-size", "must not be negative")
+
+	v.Check(cfg.maintenance.message != "", "maintenance-message", "must be provided")
+	v.Check(cfg.maintenance.retryAfter >= time.Second, "maintenance-retry-after", "must be at least 1s")
+
+	v.Check(cfg.tls.cert == "" || cfg.tls.key != "", "tls-key", "must be provided with -tls-cert")
+	v.Check(cfg.tls.key == "" || cfg.tls.cert != "", "tls-cert", "must be provided with -tls-key")
+	v.Check(cfg.autocert.domains == "" || cfg.tls.cert == "", "autocert-domains", "must not be set with -tls-cert")
+	v.Check(cfg.autocert.domains == "" || cfg.autocert.cache != "", "autocert-cache", "must be provided with -autocert-domains")
+	v.Check(cfg.admin.clientCA == "" || cfg.tls.cert != "" || cfg.autocert.domains != "", "admin-client-ca", "requires -tls-cert or -autocert-domains")
+	v.Check(cfg.autocert.domains == "" || cfg.autocert.httpAddr != "", "autocert-http-addr", "must be provided with -autocert-domains")
+
+	v.Check(cfg.maxRequestBody > 0, "max-request-body", "must be greater than zero")
+	v.Check(cfg.maxImportBody > 0, "max-import-body", "must be greater than zero")
+
+	since, sinceErr := time.Parse(time.DateOnly, cfg.v1Deprecation.since)
+	sunset, sunsetErr := time.Parse(time.DateOnly, cfg.v1Deprecation.sunset)
+	v.Check(cfg.v1Deprecation.since == "" || sinceErr == nil, "v1-deprecation", "must be a date such as 2027-01-31")
+	v.Check(cfg.v1Deprecation.sunset == "" || sunsetErr == nil, "v1-sunset", "must be a date such as 2027-06-30")
+	v.Check(cfg.v1Deprecation.sunset == "" || cfg.v1Deprecation.since != "", "v1-sunset", "requires -v1-deprecation")
+	if sinceErr == nil && sunsetErr == nil {
+		v.Check(sunset.After(since), "v1-sunset", "must be after -v1-deprecation")
+	}
+
+	v.Check(cfg.concurrency.maxInFlight >= 0, "max-in-flight", "must not be negative")
+	v.Check(cfg.concurrency.queueTimeout >= 0, "queue-timeout", "must not be negative")
+
+	v.Check(cfg.tenantDomain == strings.ToLower(strings.Trim(cfg.tenantDomain, ".")), "tenant-domain", "must be a lowercase domain name without leading or trailing dots")
+
+	_, err := parseTrustedProxies(cfg.trustedProxies)
+	v.Check(err == nil, "trusted-proxies", "must be a comma-separated list of CIDR ranges or addresses")
+
+	v.Check(cfg.pprof.addr == "" || isLoopbackAddr(cfg.pprof.addr), "pprof-addr", "must be a loopback address, such as localhost:6060")
+
+	v.Check(validator.PermittedValue(cfg.errorReporter.backend, "none", "sentry"), "error-reporter", "must be none or sentry")
+	v.Check(cfg.errorReporter.backend != "sentry" || cfg.errorReporter.sentryDSN != "", "sentry-dsn", "must be provided when -error-reporter=sentry")
+
+	v.Check(validator.PermittedValue(cfg.outbox.publisher, "none", "nats", "kafka"), "outbox-publisher", "must be none, nats or kafka")
+	v.Check(cfg.outbox.publisher != "nats" || cfg.outbox.natsURL != "", "nats-url", "must be provided when -outbox-publisher=nats")
+	v.Check(cfg.outbox.publisher != "kafka" || cfg.outbox.kafkaBrokers != "", "kafka-brokers", "must be provided when -outbox-publisher=kafka")
+	v.Check(cfg.outbox.retention > 0, "outbox-retention", "must be greater than zero")
+}
+
+// configErrors reports the problems found by validateConfig, one per line
+func configErrors(v *validator.Validator) error {
+	problems := make([]string, 0, len(v.Errors))
+	for name, messages := range v.Errors {
+		for _, message := range messages {
+			problems = append(problems, fmt.Sprintf("-%s: %s", name, message))
+		}
+	}
+	sort.Strings(problems)
+
+	return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+)
+
+// contextKey is a custom type for the keys used to store values in a request
+// context, which avoids collisions with keys set by other packages
+type contextKey string
+
+const (
+	routeContextKey  = contextKey("route")
+	loggerContextKey = contextKey("logger")
+)
+
+// contextSetRequestID returns a copy of the request with its ID added to its context.
+// The ID is stored under the key of the data package, so that it is carried into
+// the queries made for the request.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	return r.WithContext(data.WithRequestID(r.Context(), id))
+}
+
+// contextGetRequestID returns the ID of the request, or an empty string if it has none
+func (app *application) contextGetRequestID(r *http.Request) string {
+	return data.RequestID(r.Context())
+}
+
+// contextSetLogger returns a copy of the request with its logger added to its context
+func (app *application) contextSetLogger(r *http.Request, logger *slog.Logger) *http.Request {
+	ctx := context.WithValue(r.Context(), loggerContextKey, logger)
+	return r.WithContext(ctx)
+}
+
+// loggerFrom returns the logger of the request whose context is given, which
+// attaches its request ID, method, path, route and tenant to every record, or the
+// application's logger outside of a request
+func (app *application) loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return app.logger
+}
+
+// modelsFor returns the models for the queries made by a request, which carry its
+// request ID
+func (app *application) modelsFor(r *http.Request) data.Models {
+	return app.models.WithContext(r.Context())
+}
+
+// contextSetRoute returns a copy of the request with the route metadata added to its context
+func (app *application) contextSetRoute(r *http.Request, rt route) *http.Request {
+	ctx := context.WithValue(r.Context(), routeContextKey, rt)
+	return r.WithContext(ctx)
+}
+
+// contextGetRoute retrieves the route metadata from the request context. The boolean
+// is false for requests which did not match a registered route (e.g. 404 responses).
+func (app *application) contextGetRoute(r *http.Request) (route, bool) {
+	rt, ok := r.Context().Value(routeContextKey).(route)
+	return rt, ok
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jmoiron/sqlx"
+)
+
+// openDB opens a connection pool for the database at dsn with the pool settings of
+// the configuration, logging its slow queries, and publishes the statistics of the
+// pool under the given expvar name. Unless ping is false, it also checks that the
+// database is reachable.
+func openDB(cfg config, logger *slog.Logger, dsn, name string, ping bool) (*sqlx.DB, *pgxpool.Pool, error) {
+	db, pool, err := data.OpenDB(data.DBConfig{
+		DSN:                dsn,
+		MaxConns:           cfg.db.maxOpenConns,
+		MaxConnIdleTime:    cfg.db.maxIdleTime,
+		SlowQueryThreshold: cfg.db.slowQueryThreshold,
+		Logger:             logger.With("db", name),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ping {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err = db.PingContext(ctx)
+		if err != nil {
+			db.Close()
+			pool.Close()
+			return nil, nil, err
+		}
+	}
+
+	expvar.Publish(name, expvar.Func(func() any {
+		return poolStats(pool.Stat())
+	}))
+
+	return db, pool, nil
+}
+
+// poolStats converts the statistics of a pgx pool for expvar
+func poolStats(stat *pgxpool.Stat) map[string]any {
+	return map[string]any{
+		"max_conns":                  stat.MaxConns(),
+		"total_conns":                stat.TotalConns(),
+		"acquired_conns":             stat.AcquiredConns(),
+		"idle_conns":                 stat.IdleConns(),
+		"constructing_conns":         stat.ConstructingConns(),
+		"acquire_count":              stat.AcquireCount(),
+		"acquire_duration_ms":        stat.AcquireDuration().Milliseconds(),
+		"empty_acquire_count":        stat.EmptyAcquireCount(),
+		"canceled_acquire_count":     stat.CanceledAcquireCount(),
+		"new_conns_count":            stat.NewConnsCount(),
+		"max_lifetime_destroy_count": stat.MaxLifetimeDestroyCount(),
+		"max_idle_destroy_count":     stat.MaxIdleDestroyCount(),
+	}
+}
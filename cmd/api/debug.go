@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxDumpedBodyBytes caps how much of each body is logged by dumpBodies
+const maxDumpedBodyBytes = 4096
+
+// secretFieldRX matches JSON string fields whose names suggest they hold a secret,
+// such as "password" or "secret"
+var secretFieldRX = regexp.MustCompile(`(?i)("[^"]*(?:password|secret|token|authorization|api_key)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// secretHeaders are the headers whose values are never logged
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// dumpBodies logs the headers and bodies of every request and its response, to help
+// troubleshoot integrations, when -debug is set. Secret headers and JSON fields are
+// redacted, and bodies are cut at maxDumpedBodyBytes. Only the part of the request
+// body which the handler read is logged, so bodies are never buffered in full.
+func (app *application) dumpBodies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// WebSocket upgrades need the original ResponseWriter to hijack it
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reqBody := &cappedBuffer{max: maxDumpedBodyBytes}
+		if r.Body != nil {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, reqBody), r.Body}
+		}
+
+		dw := &dumpWriter{ResponseWriter: w, body: cappedBuffer{max: maxDumpedBodyBytes}}
+		next.ServeHTTP(dw, r)
+
+		app.loggerFrom(r.Context()).Info("debug dump",
+			"uri", r.URL.RequestURI(),
+			"request_headers", redactHeaders(r.Header),
+			"request_body", reqBody.redacted(),
+			"status", dw.status,
+			"response_headers", redactHeaders(w.Header()),
+			"response_body", dw.body.redacted(),
+		)
+	})
+}
+
+// redactHeaders formats headers for the log, without the values of secret headers
+func redactHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for name, values := range h {
+		headers[name] = strings.Join(values, ", ")
+	}
+	for _, name := range secretHeaders {
+		if _, ok := headers[name]; ok {
+			headers[name] = "[REDACTED]"
+		}
+	}
+	return headers
+}
+
+// cappedBuffer keeps the first max bytes written to it
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// redacted returns the contents of the buffer for the log, with the values of secret
+// JSON fields replaced
+func (b *cappedBuffer) redacted() string {
+	s := secretFieldRX.ReplaceAllString(b.buf.String(), `$1"[REDACTED]"`)
+	if b.truncated {
+		s += "...[truncated]"
+	}
+	return s
+}
+
+// dumpWriter keeps the status and the start of the body of a response for dumpBodies
+type dumpWriter struct {
+	http.ResponseWriter
+	status int
+	body   cappedBuffer
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (dw *dumpWriter) Unwrap() http.ResponseWriter {
+	return dw.ResponseWriter
+}
+
+func (dw *dumpWriter) WriteHeader(status int) {
+	if dw.status == 0 {
+		dw.status = status
+	}
+	dw.ResponseWriter.WriteHeader(status)
+}
+
+func (dw *dumpWriter) Write(b []byte) (int, error) {
+	if dw.status == 0 {
+		dw.status = http.StatusOK
+	}
+	dw.body.Write(b)
+	return dw.ResponseWriter.Write(b)
+}
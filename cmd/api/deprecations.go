@@ -0,0 +1,230 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+)
+
+// deprecation describes a field, parameter or endpoint which still works but which
+// clients should migrate away from.
+type deprecation struct {
+	description string
+	// since is when the feature was deprecated, sent in the Deprecation header
+	since time.Time
+	// sunset is when the feature is expected to stop working; zero if not planned yet
+	sunset time.Time
+}
+
+// deprecations is the single place where deprecated features are declared. Routes
+// refer to an entry by key through their deprecation metadata, and handlers which
+// detect use of a deprecated field call app.deprecated with its key.
+var deprecations = map[string]deprecation{
+	"movies.numeric-id": {
+		description: "referring to movies by numeric ID in the URL is deprecated, use the movie uuid instead",
+		since:       time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+// v1DeprecationKey is the deprecation of the v1 routes superseded by a v2 route,
+// whose dates are set by -v1-deprecation and -v1-sunset rather than in deprecations
+const v1DeprecationKey = "api.v1"
+
+// deprecation returns the deprecation with the given key. The v1 deprecation only
+// exists once -v1-deprecation is set.
+func (app *application) deprecation(key string) (deprecation, bool) {
+	if key != v1DeprecationKey {
+		d, ok := deprecations[key]
+		return d, ok
+	}
+
+	// the dates are checked by validateConfig
+	since, err := time.Parse(time.DateOnly, app.config.v1Deprecation.since)
+	if err != nil {
+		return deprecation{}, false
+	}
+	sunset, _ := time.Parse(time.DateOnly, app.config.v1Deprecation.sunset)
+
+	return deprecation{
+		description: "this version of the route is deprecated, use its /v2 version instead",
+		since:       since,
+		sunset:      sunset,
+	}, true
+}
+
+// deprecatedUsage counts uses of each deprecated feature across all clients
+var deprecatedUsage = expvar.NewMap("deprecated_usage")
+
+// maxDeprecationClients caps the number of clients whose use of a deprecated feature
+// is recorded, including otherClients, which the uses of the others are counted
+// under, so that the usage cannot grow without bound.
+const maxDeprecationClients = 100
+
+// otherClients is the client the uses of the clients beyond maxDeprecationClients are
+// counted under
+const otherClients = "other"
+
+// deprecationUsage records how often each client used each deprecated feature
+type deprecationUsage struct {
+	mu      sync.Mutex
+	clients map[string]map[string]*clientUsage
+}
+
+type clientUsage struct {
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+func newDeprecationUsage() *deprecationUsage {
+	return &deprecationUsage{clients: make(map[string]map[string]*clientUsage)}
+}
+
+func (d *deprecationUsage) record(key, client string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.clients[key] == nil {
+		d.clients[key] = make(map[string]*clientUsage)
+	}
+
+	clients := d.clients[key]
+	usage, ok := clients[client]
+	if !ok {
+		// the first eviction adds otherClients
+		for len(clients) >= maxDeprecationClients {
+			d.evict(clients)
+		}
+		usage = &clientUsage{}
+		clients[client] = usage
+	}
+	usage.Count++
+	usage.LastSeen = time.Now().UTC()
+}
+
+// evict makes room for a new client by folding the least used client, the least
+// recently seen of them on a tie, into otherClients. The clients which keep using a
+// feature stay, while a stream of one-off clients (such as from rotating addresses)
+// cycles through the last slots.
+func (d *deprecationUsage) evict(clients map[string]*clientUsage) {
+	var evicted string
+	for client, usage := range clients {
+		if client == otherClients {
+			continue
+		}
+		if least := clients[evicted]; least == nil || usage.Count < least.Count ||
+			(usage.Count == least.Count && usage.LastSeen.Before(least.LastSeen)) {
+			evicted = client
+		}
+	}
+
+	other, ok := clients[otherClients]
+	if !ok {
+		other = &clientUsage{}
+		clients[otherClients] = other
+	}
+	other.Count += clients[evicted].Count
+	if clients[evicted].LastSeen.After(other.LastSeen) {
+		other.LastSeen = clients[evicted].LastSeen
+	}
+	delete(clients, evicted)
+}
+
+// report returns a copy of the usage counts, keyed by deprecation and then client
+func (d *deprecationUsage) report() map[string]map[string]clientUsage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	report := make(map[string]map[string]clientUsage, len(d.clients))
+	for key, clients := range d.clients {
+		report[key] = make(map[string]clientUsage, len(clients))
+		for client, usage := range clients {
+			report[key][client] = *usage
+		}
+	}
+
+	return report
+}
+
+// deprecated marks the response as using the deprecated feature with the given key,
+// by setting the Deprecation, Sunset and Warning headers, and records the use for
+// the usage report. It panics on an unknown key, as that is a programming error.
+func (app *application) deprecated(w http.ResponseWriter, r *http.Request, key string) {
+	d, ok := app.deprecation(key)
+	if !ok {
+		panic(fmt.Sprintf("unknown deprecation %q", key))
+	}
+
+	w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.since.Unix()))
+	if !d.sunset.IsZero() {
+		w.Header().Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Add("Warning", fmt.Sprintf("299 - %q", d.description))
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/v1/"); ok && key == v1DeprecationKey {
+		w.Header().Add("Link", fmt.Sprintf("</v2/%s>; rel=\"successor-version\"", rest))
+	}
+
+	deprecatedUsage.Add(key, 1)
+	app.deprecations.record(key, app.clientKey(r))
+}
+
+// clientKey identifies the client making a request for per-client reporting: the
+// tenant of its API key, or its IP for anonymous requests only, as the clients
+// behind a NAT or a proxy share an IP and one client may use many
+func (app *application) clientKey(r *http.Request) string {
+	// resolveTenant has rejected unknown API keys
+	if r.Header.Get("X-API-Key") != "" {
+		return fmt.Sprintf("tenant:%d", data.TenantID(r.Context()))
+	}
+	return "ip:" + app.clientIP(r)
+}
+
+// deprecationsHandler lists every deprecated feature together with how often each
+// client has used it since the server started, so that client migrations can be
+// tracked before a feature is removed. The clients beyond maxDeprecationClients are
+// reported together as "other".
+func (app *application) deprecationsHandler(w http.ResponseWriter, r *http.Request) {
+	type entry struct {
+		Key         string                 `json:"key"`
+		Description string                 `json:"description"`
+		Since       time.Time              `json:"since"`
+		Sunset      *time.Time             `json:"sunset,omitempty"`
+		Usage       map[string]clientUsage `json:"usage"`
+	}
+
+	report := app.deprecations.report()
+
+	all := maps.Clone(deprecations)
+	if d, ok := app.deprecation(v1DeprecationKey); ok {
+		all[v1DeprecationKey] = d
+	}
+
+	entries := make([]entry, 0, len(all))
+	for key, d := range all {
+		e := entry{
+			Key:         key,
+			Description: d.description,
+			Since:       d.since,
+			Usage:       report[key],
+		}
+		if !d.sunset.IsZero() {
+			e.Sunset = &d.sunset
+		}
+		if e.Usage == nil {
+			e.Usage = map[string]clientUsage{}
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"deprecations": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
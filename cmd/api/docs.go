@@ -0,0 +1,64 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// docsFiles holds the API explorer: Swagger UI 4.15.5, with an index page and
+// initializer which load the specification served at /v1/openapi.json.
+//
+//go:embed docs
+var docsFiles embed.FS
+
+// docsCSP relaxes the Content-Security-Policy of secureHeaders just enough for the
+// explorer to load its own assets and call the API
+const docsCSP = "default-src 'none'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'"
+
+// docsURL returns the link to the operation of the request's route in the API
+// explorer, or to the explorer itself for requests which matched no route. It
+// returns an empty string if the explorer is disabled.
+func (app *application) docsURL(r *http.Request) string {
+	if !app.config.docs {
+		return ""
+	}
+
+	url := app.baseURL(r) + "/v1/docs"
+	if rt, ok := app.contextGetRoute(r); ok {
+		// the explorer's deep links name the operations of the default tag
+		url += "#/default/" + rt.name
+	}
+	return url
+}
+
+// docsHandler serves the index page of the API explorer
+func (app *application) docsHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveDocsFile(w, r, "index.html")
+}
+
+// docsAssetHandler serves the scripts, stylesheets and images of the API explorer
+func (app *application) docsAssetHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveDocsFile(w, r, chi.URLParam(r, "file"))
+}
+
+// serveDocsFile serves a file of the API explorer, or a 404 Not Found response if
+// the explorer is disabled or the file does not exist.
+func (app *application) serveDocsFile(w http.ResponseWriter, r *http.Request, name string) {
+	if !app.config.docs {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err := fs.Stat(docsFiles, "docs/"+name)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", docsCSP)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeFileFS(w, r, docsFiles, "docs/"+name)
+}
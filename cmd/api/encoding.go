@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackContentType is the media type of MessagePack responses
+const msgpackContentType = "application/msgpack"
+
+// encodingWriter carries the response encoding negotiated for a request down to
+// writeJSON, so that handlers can write the same envelopes whatever the encoding.
+type encodingWriter struct {
+	http.ResponseWriter
+	msgpack bool
+	jsonapi bool
+	// fields is the sparse fieldset requested with ?fields=, or nil for every field
+	fields []string
+	// runtimeFormat is the format of the runtimes in JSON responses
+	runtimeFormat string
+	// pretty is whether JSON responses are indented
+	pretty bool
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (ew *encodingWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// negotiateEncoding picks the encoding of the response from the Accept header of the
+// request. Clients which accept application/vnd.api+json get JSON:API documents,
+// clients which accept application/msgpack (or its older x- form) get MessagePack,
+// and everyone else JSON.
+//
+// It also reads the sparse fieldset of the request, which writeJSON applies to the
+// resources of the response whatever the encoding, and the format of the runtimes
+// and the indentation of JSON responses.
+//
+// Requests whose Accept header rules out every media type the route can respond
+// with get a 406 Not Acceptable response listing them, in JSON.
+//
+// It must wrap the handler directly, inside the timeout middleware, as
+// http.TimeoutHandler replaces the ResponseWriter it is given.
+func (app *application) negotiateEncoding(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &encodingWriter{
+			ResponseWriter: w,
+			jsonapi:        wantsJSONAPI(r),
+		}
+		ew.msgpack = !ew.jsonapi && wantsMsgpack(r)
+
+		if rt, ok := app.contextGetRoute(r); ok {
+			if types := responseTypes(rt); types != nil && !acceptsAny(r, types) {
+				app.notAcceptableResponse(w, r, types)
+				return
+			}
+		}
+
+		v := validator.New()
+		ew.fields = app.readFields(v, r)
+		ew.runtimeFormat = app.readRuntimeFormat(v, r)
+		ew.pretty = app.readPretty(v, r)
+		if !v.Valid() {
+			app.failedValidationResponse(ew, r, v.Errors)
+			return
+		}
+
+		// plain JSON responses are left unwrapped, as the ResponseWriter of a
+		// WebSocket upgrade must be a http.Hijacker
+		if !ew.jsonapi && !ew.msgpack && ew.fields == nil && ew.runtimeFormat == "string" &&
+			ew.pretty == app.config.prettyJSON {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(ew, r)
+	})
+}
+
+// readPretty reads whether the JSON of the response is indented from ?pretty=, as in
+// "?pretty=true", defaulting to -pretty-json
+func (app *application) readPretty(v *validator.Validator, r *http.Request) bool {
+	qs := r.URL.Query()
+	if !qs.Has("pretty") {
+		return app.config.prettyJSON
+	}
+
+	pretty, err := strconv.ParseBool(qs.Get("pretty"))
+	v.Check(err == nil, "pretty", "must be true or false")
+	return pretty
+}
+
+// jsonMediaTypes are the media types of the responses of routes which respond with
+// an envelope
+var jsonMediaTypes = []string{"application/json", jsonAPIContentType, msgpackContentType, "application/x-msgpack"}
+
+// responseTypes returns the media types in which the route can respond, as
+// documented in openAPIDocs, or nil if its responses have no body
+func responseTypes(rt route) []string {
+	doc := openAPIDocs[rt.name]
+	switch {
+	case doc.responseType != "":
+		return []string{doc.responseType}
+	case doc.streamType != "":
+		return append(slices.Clip(jsonMediaTypes), doc.streamType)
+	case doc.response != nil:
+		return jsonMediaTypes
+	}
+
+	return nil
+}
+
+// acceptsAny reports whether the Accept header of the request allows any of the
+// media types, either by name or by a range such as */* or application/*. A request
+// without an Accept header accepts every media type, and a versioned media type
+// such as application/vnd.greenlight.v1+json stands for application/json.
+func acceptsAny(r *http.Request, mediaTypes []string) bool {
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return true
+	}
+
+	for _, accept := range strings.Split(header, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		if versionMediaTypeRX.MatchString(mediaRange) {
+			mediaRange = "application/json"
+		}
+
+		for _, mediaType := range mediaTypes {
+			if mediaRange == "*/*" || mediaRange == mediaType ||
+				(strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// The notAcceptableResponse method will be used to send a 406 Not Acceptable status
+// code and JSON response when the client accepts none of the media types the route
+// can respond with.
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request, supported []string) {
+	message := fmt.Sprintf("the requested media types are not supported by this route; supported media types: %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
+// wantsMsgpack reports whether the Accept header of the request asks for MessagePack
+func wantsMsgpack(r *http.Request) bool {
+	return accepts(r, msgpackContentType, "application/x-msgpack")
+}
+
+// accepts reports whether the Accept header of the request lists any of the media
+// types. Quality values are not ranked; only a q of 0 rules a media type out.
+func accepts(r *http.Request, mediaTypes ...string) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || !slices.Contains(mediaTypes, mediaType) {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
+
+// marshalMsgpack encodes the envelope as MessagePack, naming fields by their json
+// tags so that the keys match the JSON responses. Types with custom JSON encodings
+// are sent as their underlying values (e.g. a runtime is a number of minutes).
+func marshalMsgpack(data envelope) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+
+	err := encoder.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -3,18 +3,62 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"runtime"
+
+	"github.com/aviagarwal1212/greenlight/internal/i18n"
+	"github.com/aviagarwal1212/greenlight/internal/reporter"
 )
 
-// the logError method is a generic helper for logging an error message
-// with the current request method and URL as attributes
+// serverErrorMessage is the message of 500 Internal Server Error responses, which
+// never reveal the underlying error
+const serverErrorMessage = "the server encountered a problem and could not process your request"
+
+// the logError method is a generic helper for logging an error message with the
+// logger of the request, adding the full URI to its attributes
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	app.loggerFrom(r.Context()).Error(err.Error(), "uri", r.URL.RequestURI())
+}
+
+// reportError sends an error, or a recovered panic, to the error reporter together
+// with the request and the stack of the caller
+func (app *application) reportError(r *http.Request, err error, panicked bool) {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(3, pcs)]
+
+	report := reporter.Report{
+		Err:       err,
+		Panic:     panicked,
+		Stack:     pcs,
+		Request:   r,
+		RequestID: app.contextGetRequestID(r),
+		// requests are not authenticated yet, so the user is left unset
+	}
+	if rt, ok := app.contextGetRoute(r); ok {
+		report.Route = rt.name
+	}
+
+	app.reporter.Report(report)
 }
 
 // The errorResponse method is a generic helper for sending JSON-formatted error
-// messages to the client with a given status code.
+// messages to the client with a given status code. Messages, and the messages of
+// field errors, are translated into the language the client prefers. The docs field
+// links to the documentation of the route, while the API explorer is enabled.
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+	lang := app.language(r)
+	switch m := message.(type) {
+	case string:
+		message = i18n.Translate(lang, m)
+	case map[string][]string:
+		message = i18n.TranslateAll(lang, m)
+	}
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+
 	env := envelope{"error": message}
+	if docs := app.docsURL(r); docs != "" {
+		env["docs"] = docs
+	}
 
 	err := app.writeJSON(w, status, env, nil)
 	if err != nil {
@@ -28,8 +72,8 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 // the errorResponse helper to send a 500 Internal Server Error status code and JSON response.
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
-	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.reportError(r, err, false)
+	app.errorResponse(w, r, http.StatusInternalServerError, serverErrorMessage)
 }
 
 // The notFoundResponse method will be used to send a 404 Status Not Found status code
@@ -53,12 +97,51 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 }
 
 // The failedValidationResponse method will be used to send a 422 Unprocessable Entity
-// status code and JSON response. It includes the validation errors in the response.
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+// status code and JSON response. It includes every validation error of each field in
+// the response.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string][]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
+// The unsupportedMediaTypeResponse method will be used to send a 415 Unsupported Media
+// Type status code and JSON response when the body of a request is not JSON.
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request body must be JSON, with a Content-Type of application/json"
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+
+// The rateLimitExceededResponse method will be used to send a 429 Too Many Requests
+// status code and JSON response.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// The invalidAuthenticationTokenResponse method will be used to send a 401 Unauthorized
+// status code and JSON response when the client's credentials are missing or invalid.
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The clientCertificateRequiredResponse method will be used to send a 403 Forbidden
+// status code and JSON response when a route needs a client certificate which the
+// client didn't present.
+func (app *application) clientCertificateRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a trusted client certificate is required to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// The notPermittedResponse method will be used to send a 403 Forbidden status code
+// and JSON response when the client is authenticated but lacks the needed permission.
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you do not have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
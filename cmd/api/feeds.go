@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// atomFeed and the types below model the subset of RFC 4287 (Atom) used by the
+// movies feed
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Links      []atomLink     `xml:"link"`
+	Summary    string         `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// moviesFeedHandler serves an Atom feed of the most recently added movies, so that
+// consumers can subscribe to new additions with any feed reader. The number of
+// entries can be set with ?limit= (1-100, default 20).
+func (app *application) moviesFeedHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 20, v)
+	v.Check(validator.Between(limit, 1, 100), "limit", "must be between 1 and 100")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, err := app.modelsFor(r).Movies.Recent(limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	baseURL := app.baseURL(r)
+
+	feed := atomFeed{
+		ID:      baseURL + "/v1/feeds/movies.atom",
+		Title:   "Greenlight: recently added movies",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "Greenlight"},
+		Links: []atomLink{
+			{Href: baseURL + "/v1/feeds/movies.atom", Rel: "self", Type: "application/atom+xml"},
+			{Href: baseURL + "/v1/movies/recent", Rel: "alternate", Type: "application/json"},
+		},
+	}
+
+	// the feed was last updated when its newest movie was added
+	if len(movies) > 0 {
+		feed.Updated = movies[0].CreatedAt.UTC().Format(time.RFC3339)
+	}
+
+	for _, movie := range movies {
+		created := movie.CreatedAt.UTC().Format(time.RFC3339)
+
+		entry := atomEntry{
+			ID:        "urn:uuid:" + movie.UUID,
+			Title:     movie.Title,
+			Updated:   created,
+			Published: created,
+			Links: []atomLink{
+				{Href: baseURL + "/v1/movies/" + movie.UUID, Rel: "alternate", Type: "application/json"},
+			},
+			Summary: fmt.Sprintf("%s (%d), %d mins, %s", movie.Title, movie.Year, movie.Runtime, strings.Join(movie.Genres, ", ")),
+		}
+		for _, genre := range movie.Genres {
+			entry.Categories = append(entry.Categories, atomCategory{Term: genre})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
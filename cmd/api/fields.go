@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// sparseFieldNames are the fields which ?fields= may select: the JSON fields of
+// every resource type written by the API
+var sparseFieldNames = func() []string {
+	var names []string
+	for _, v := range []any{data.Movie{}, data.Webhook{}, data.WebhookDelivery{}} {
+		t := reflect.TypeOf(v)
+		for i := range t.NumField() {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name != "" && name != "-" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}()
+
+// readFields reads the sparse fieldset of the request from ?fields=, a comma
+// separated list of the fields to return for each resource. It returns nil if the
+// parameter is not set.
+func (app *application) readFields(v *validator.Validator, r *http.Request) []string {
+	qs := r.URL.Query()
+	if !qs.Has("fields") {
+		return nil
+	}
+
+	fields := app.readCsv(qs, "fields", []string{})
+	v.Check(len(fields) > 0, "fields", "must contain at least 1 field")
+	for _, field := range fields {
+		if !validator.PermittedValue(field, sparseFieldNames...) {
+			v.AddError("fields", fmt.Sprintf("contains unknown field %q", field))
+		}
+	}
+
+	return fields
+}
+
+// applyFields returns a copy of the envelope in which the movies, webhooks and
+// deliveries only have the given fields (and their id). Other values are left as
+// they are.
+func applyFields(env envelope, fields []string) envelope {
+	sparse := make(envelope, len(env))
+	for key, value := range env {
+		sparse[key] = sparseValue(value, fields)
+	}
+	return sparse
+}
+
+func sparseValue(value any, fields []string) any {
+	switch value := value.(type) {
+	case *data.Movie, *data.Webhook, *data.WebhookDelivery:
+		return selectFields(value, fields)
+	case []*data.Movie:
+		return selectEach(value, fields)
+	case []*data.Webhook:
+		return selectEach(value, fields)
+	case []*data.WebhookDelivery:
+		return selectEach(value, fields)
+	default:
+		return value
+	}
+}
+
+func selectEach[T any](values []T, fields []string) []map[string]any {
+	selected := make([]map[string]any, len(values))
+	for i, value := range values {
+		selected[i] = selectFields(value, fields)
+	}
+	return selected
+}
+
+// selectFields returns the given fields of a pointer to a struct, and its id (the
+// uuid of a movie), keyed by their JSON names. The values keep their Go types, so
+// that they are encoded as they would be as part of the struct, and fields tagged
+// omitempty are left out when they are empty.
+func selectFields(v any, fields []string) map[string]any {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+
+	selected := make(map[string]any, len(fields)+1)
+	for i := range rt.NumField() {
+		name, opts, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if name != "id" && name != "uuid" && !slices.Contains(fields, name) {
+			continue
+		}
+
+		field := rv.Field(i)
+		if strings.Contains(opts, "omitempty") && isEmptyValue(field) {
+			continue
+		}
+		selected[name] = field.Interface()
+	}
+
+	return selected
+}
+
+// isEmptyValue reports whether encoding/json treats a value as empty for omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	default:
+		return v.IsZero()
+	}
+}
@@ -0,0 +1,637 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/i18n"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// graphqlSchema describes the GraphQL API served at POST /v1/graphql. Movies are
+// identified by their UUID or, as for the JSON API, by their numeric ID.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	movie(id: ID!): Movie
+	movies(filter: MovieFilter, page: PageInput): MoviePage!
+}
+
+type Mutation {
+	createMovie(input: CreateMovieInput!): Movie!
+	updateMovie(id: ID!, input: UpdateMovieInput!): Movie!
+	deleteMovie(id: ID!): ID!
+}
+
+type Movie {
+	id: ID!
+	uuid: ID!
+	title: String!
+	slug: String!
+	imdbId: String
+	year: Int!
+	# runtime in minutes
+	runtime: Int!
+	genres: [String!]!
+	links: MovieLinks!
+	version: Int!
+}
+
+type MovieLinks {
+	trailerUrl: String
+	homepage: String
+	wiki: String
+}
+
+type MoviePage {
+	movies: [Movie!]!
+	metadata: Metadata!
+}
+
+type Metadata {
+	currentPage: Int!
+	pageSize: Int!
+	firstPage: Int!
+	lastPage: Int!
+	totalRecords: Int!
+}
+
+input MovieFilter {
+	title: String
+	genres: [String!]
+}
+
+input PageInput {
+	page: Int
+	pageSize: Int
+	# one of id, title, year or runtime, prefixed with "-" for descending order
+	sort: String
+}
+
+input MovieLinksInput {
+	trailerUrl: String
+	homepage: String
+	wiki: String
+}
+
+input CreateMovieInput {
+	title: String!
+	imdbId: String
+	year: Int!
+	runtime: Int!
+	genres: [String!]!
+	links: MovieLinksInput
+}
+
+input UpdateMovieInput {
+	title: String
+	imdbId: String
+	year: Int
+	runtime: Int
+	genres: [String!]
+	links: MovieLinksInput
+}
+`
+
+// graphqlMaxDepth caps how deeply a GraphQL query may nest selections
+const graphqlMaxDepth = 10
+
+// newGraphQLSchema parses the GraphQL schema and binds it to the resolvers
+func newGraphQLSchema(app *application) (*graphql.Schema, error) {
+	return graphql.ParseSchema(graphqlSchema, &graphqlResolver{app: app},
+		graphql.UseFieldResolvers(),
+		graphql.MaxDepth(graphqlMaxDepth),
+	)
+}
+
+// graphqlHandler executes a GraphQL query or mutation. The expected JSON structure
+// for the request body is:
+//
+//	{
+//	  "query": "query ($id: ID!) { movie(id: $id) { title year } }",
+//	  "operationName": "",
+//	  "variables": {"id": "0b7f7a4e-4bb3-4c59-8d6c-6a3f5e3f7a10"}
+//	}
+//
+// As is usual for GraphQL, the response is always 200 OK once the request body has
+// been decoded, and any errors are reported in the "errors" member alongside the
+// data. Validation errors carry the failing fields in their extensions.
+func (app *application) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query         string         `json:"query"`
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+		Extensions    map[string]any `json:"extensions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Query != "", "query", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx := contextSetMovieLoader(r.Context(), app.newMovieLoader())
+
+	resp := app.graphql.Exec(ctx, input.Query, input.OperationName, input.Variables)
+
+	lang := app.language(r)
+	for _, e := range resp.Errors {
+		e.Message = i18n.Translate(lang, e.Message)
+		if fields, ok := e.Extensions["fields"].(map[string][]string); ok {
+			e.Extensions["fields"] = i18n.TranslateAll(lang, fields)
+		}
+	}
+
+	env := envelope{"data": resp.Data}
+	if len(resp.Errors) > 0 {
+		env["errors"] = resp.Errors
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieLoader batches the movie lookups made while resolving one GraphQL request, so
+// that a query selecting many movies (e.g. through aliases) costs one database query
+// instead of one per movie.
+type movieLoader = dataloader.Loader[string, *data.Movie]
+
+type movieLoaderContextKey struct{}
+
+// newMovieLoader returns a loader which looks movies up by ID or UUID with GetMany.
+// Keys are collected for a couple of milliseconds, as sibling fields are resolved
+// concurrently.
+func (app *application) newMovieLoader() *movieLoader {
+	return dataloader.NewBatchedLoader(app.loadMovies,
+		dataloader.WithWait[string, *data.Movie](2*time.Millisecond),
+		dataloader.WithBatchCapacity[string, *data.Movie](maxBulkItems),
+	)
+}
+
+// loadMovies is the batch function of the movie loader. It returns one result per
+// key, in key order, with a nil movie for keys which match none.
+func (app *application) loadMovies(ctx context.Context, keys []string) []*dataloader.Result[*data.Movie] {
+	var ids []int64
+	var uuids []string
+
+	for _, key := range keys {
+		if validator.Match(key, validator.UUIDRX) {
+			uuids = append(uuids, key)
+		} else if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	results := make([]*dataloader.Result[*data.Movie], len(keys))
+
+	movies, err := app.models.WithContext(ctx).Movies.GetMany(ids, uuids)
+	if err != nil {
+		for i := range results {
+			results[i] = &dataloader.Result[*data.Movie]{Error: err}
+		}
+		return results
+	}
+
+	found := make(map[string]*data.Movie, 2*len(movies))
+	for _, movie := range movies {
+		found[strconv.FormatInt(movie.ID, 10)] = movie
+		found[movie.UUID] = movie
+	}
+
+	for i, key := range keys {
+		results[i] = &dataloader.Result[*data.Movie]{Data: found[key]}
+	}
+
+	return results
+}
+
+func contextSetMovieLoader(ctx context.Context, loader *movieLoader) context.Context {
+	return context.WithValue(ctx, movieLoaderContextKey{}, loader)
+}
+
+func contextGetMovieLoader(ctx context.Context) *movieLoader {
+	loader, ok := ctx.Value(movieLoaderContextKey{}).(*movieLoader)
+	if !ok {
+		panic("missing movie loader value in request context")
+	}
+
+	return loader
+}
+
+// graphqlError is returned by resolvers for errors which the client can act on. Its
+// code and fields are sent in the extensions of the GraphQL error.
+type graphqlError struct {
+	message string
+	code    string
+	fields  map[string][]string
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+func (e *graphqlError) Extensions() map[string]any {
+	ext := map[string]any{"code": e.code}
+	if e.fields != nil {
+		ext["fields"] = e.fields
+	}
+
+	return ext
+}
+
+var (
+	errGraphQLNotFound     = &graphqlError{message: "the requested resource could not be found", code: "NOT_FOUND"}
+	errGraphQLEditConflict = &graphqlError{message: "unable to update the record due to an edit conflict, please try again", code: "EDIT_CONFLICT"}
+)
+
+// graphqlValidationError reports the validation errors of an input
+func graphqlValidationError(errs map[string][]string) error {
+	return &graphqlError{message: "the input failed validation", code: "FAILED_VALIDATION", fields: errs}
+}
+
+// resolverError converts an error from the models into the error returned to the
+// client. Unexpected errors are logged and replaced by a generic message.
+func (app *application) resolverError(ctx context.Context, err error) error {
+	var gqlErr *graphqlError
+
+	switch {
+	case errors.As(err, &gqlErr):
+		return err
+	case errors.Is(err, data.ErrRecordNotFound):
+		return errGraphQLNotFound
+	case errors.Is(err, data.ErrEditConflict):
+		return errGraphQLEditConflict
+	case errors.Is(err, data.ErrDuplicateIMDbID):
+		return graphqlValidationError(map[string][]string{"imdbId": {"a movie with this IMDb ID already exists"}})
+	default:
+		app.loggerFrom(ctx).Error(err.Error())
+		return &graphqlError{message: "the server encountered a problem and could not process your request", code: "INTERNAL"}
+	}
+}
+
+// graphqlResolver is the root resolver of the GraphQL schema
+type graphqlResolver struct {
+	app *application
+}
+
+func (res *graphqlResolver) Movie(ctx context.Context, args struct{ ID graphql.ID }) (*movieResolver, error) {
+	key := strings.ToLower(string(args.ID))
+
+	movie, err := contextGetMovieLoader(ctx).Load(ctx, key)()
+	if err != nil {
+		return nil, res.app.resolverError(ctx, err)
+	}
+	if movie == nil {
+		return nil, nil
+	}
+
+	return &movieResolver{movie}, nil
+}
+
+type graphqlMovieFilter struct {
+	Title  *string
+	Genres *[]string
+}
+
+type graphqlPageInput struct {
+	Page     *int32
+	PageSize *int32
+	Sort     *string
+}
+
+func (res *graphqlResolver) Movies(ctx context.Context, args struct {
+	Filter *graphqlMovieFilter
+	Page   *graphqlPageInput
+}) (*moviePageResolver, error) {
+	title := ""
+	genres := []string{}
+	if args.Filter != nil {
+		if args.Filter.Title != nil {
+			title = *args.Filter.Title
+		}
+		if args.Filter.Genres != nil {
+			genres = *args.Filter.Genres
+		}
+	}
+
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "id",
+		SortSafelist: []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"},
+	}
+	if args.Page != nil {
+		if args.Page.Page != nil {
+			filters.Page = int(*args.Page.Page)
+		}
+		if args.Page.PageSize != nil {
+			filters.PageSize = int(*args.Page.PageSize)
+		}
+		if args.Page.Sort != nil {
+			filters.Sort = *args.Page.Sort
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		return nil, graphqlValidationError(v.Errors)
+	}
+
+	movies, metadata, err := res.app.models.WithContext(ctx).Movies.GetAll(title, genres, filters)
+	if err != nil {
+		return nil, res.app.resolverError(ctx, err)
+	}
+
+	// later movie(id) lookups in the same request can reuse the listed movies
+	loader := contextGetMovieLoader(ctx)
+	page := &moviePageResolver{metadata: metadata}
+	for _, movie := range movies {
+		loader.Prime(ctx, movie.UUID, movie)
+		loader.Prime(ctx, strconv.FormatInt(movie.ID, 10), movie)
+		page.movies = append(page.movies, &movieResolver{movie})
+	}
+
+	return page, nil
+}
+
+type graphqlLinksInput struct {
+	TrailerURL *string
+	Homepage   *string
+	Wiki       *string
+}
+
+func (res *graphqlResolver) CreateMovie(ctx context.Context, args struct {
+	Input struct {
+		Title   string
+		IMDbID  *string
+		Year    int32
+		Runtime int32
+		Genres  []string
+		Links   *graphqlLinksInput
+	}
+}) (*movieResolver, error) {
+	in := args.Input
+	movie := &data.Movie{
+		Title:   in.Title,
+		Year:    in.Year,
+		Runtime: data.Runtime(in.Runtime),
+		Genres:  in.Genres,
+	}
+	if in.IMDbID != nil {
+		movie.IMDbID = *in.IMDbID
+	}
+	applyLinksInput(&movie.Links, in.Links)
+
+	v := validator.New()
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		return nil, graphqlValidationError(v.Errors)
+	}
+
+	err := res.app.models.WithContext(ctx).Movies.Insert(movie)
+	if err != nil {
+		return nil, res.app.resolverError(ctx, err)
+	}
+
+	res.app.publishMovieEvent(ctx, "movie.created", movie)
+
+	return &movieResolver{movie}, nil
+}
+
+func (res *graphqlResolver) UpdateMovie(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input struct {
+		Title   *string
+		IMDbID  *string
+		Year    *int32
+		Runtime *int32
+		Genres  *[]string
+		Links   *graphqlLinksInput
+	}
+}) (*movieResolver, error) {
+	movie, err := res.getMovie(ctx, args.ID)
+	if err != nil {
+		return nil, res.app.resolverError(ctx, err)
+	}
+
+	in := args.Input
+	if in.Title != nil {
+		movie.Title = *in.Title
+	}
+	if in.IMDbID != nil {
+		movie.IMDbID = *in.IMDbID
+	}
+	if in.Year != nil {
+		movie.Year = *in.Year
+	}
+	if in.Runtime != nil {
+		movie.Runtime = data.Runtime(*in.Runtime)
+	}
+	if in.Genres != nil {
+		movie.Genres = *in.Genres
+	}
+	applyLinksInput(&movie.Links, in.Links)
+
+	v := validator.New()
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		return nil, graphqlValidationError(v.Errors)
+	}
+
+	err = res.app.models.WithContext(ctx).Movies.Update(movie)
+	if err != nil {
+		return nil, res.app.resolverError(ctx, err)
+	}
+
+	res.app.publishMovieEvent(ctx, "movie.updated", movie)
+
+	return &movieResolver{movie}, nil
+}
+
+func (res *graphqlResolver) DeleteMovie(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	movie, err := res.getMovie(ctx, args.ID)
+	if err != nil {
+		return "", res.app.resolverError(ctx, err)
+	}
+
+	err = res.app.models.WithContext(ctx).Movies.Delete(movie.ID)
+	if err != nil {
+		return "", res.app.resolverError(ctx, err)
+	}
+
+	res.app.publishMovieEvent(ctx, "movie.deleted", movieDeletedEvent{UUID: movie.UUID, Version: movie.Version})
+
+	return args.ID, nil
+}
+
+// getMovie retrieves a movie for a mutation from the primary, bypassing the loader
+// as the movie is about to change
+func (res *graphqlResolver) getMovie(ctx context.Context, id graphql.ID) (*data.Movie, error) {
+	models := res.app.models.WithContext(ctx).Primary()
+
+	key := strings.ToLower(string(id))
+	if validator.Match(key, validator.UUIDRX) {
+		return getMovie(models, movieRef{uuid: key})
+	}
+
+	n, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return getMovie(models, movieRef{id: n})
+}
+
+// applyLinksInput sets the links which are present in the input; an empty string
+// clears a link
+func applyLinksInput(links *data.MovieLinks, in *graphqlLinksInput) {
+	if in == nil {
+		return
+	}
+	if in.TrailerURL != nil {
+		links.TrailerURL = *in.TrailerURL
+	}
+	if in.Homepage != nil {
+		links.Homepage = *in.Homepage
+	}
+	if in.Wiki != nil {
+		links.Wiki = *in.Wiki
+	}
+}
+
+// movieResolver resolves the fields of the Movie type
+type movieResolver struct {
+	movie *data.Movie
+}
+
+// ID returns the UUID of the movie, like UUID, as the sequential ID isn't public
+func (r *movieResolver) ID() graphql.ID {
+	return graphql.ID(r.movie.UUID)
+}
+
+func (r *movieResolver) UUID() graphql.ID {
+	return graphql.ID(r.movie.UUID)
+}
+
+func (r *movieResolver) Title() string {
+	return r.movie.Title
+}
+
+func (r *movieResolver) Slug() string {
+	return r.movie.Slug
+}
+
+func (r *movieResolver) IMDbID() *string {
+	return optionalString(r.movie.IMDbID)
+}
+
+func (r *movieResolver) Year() int32 {
+	return r.movie.Year
+}
+
+func (r *movieResolver) Runtime() int32 {
+	return int32(r.movie.Runtime)
+}
+
+func (r *movieResolver) Genres() []string {
+	if r.movie.Genres == nil {
+		return []string{}
+	}
+
+	return r.movie.Genres
+}
+
+func (r *movieResolver) Links() *movieLinksResolver {
+	return &movieLinksResolver{r.movie.Links}
+}
+
+func (r *movieResolver) Version() int32 {
+	return r.movie.Version
+}
+
+// movieLinksResolver resolves the fields of the MovieLinks type
+type movieLinksResolver struct {
+	links data.MovieLinks
+}
+
+func (r *movieLinksResolver) TrailerURL() *string {
+	return optionalString(r.links.TrailerURL)
+}
+
+func (r *movieLinksResolver) Homepage() *string {
+	return optionalString(r.links.Homepage)
+}
+
+func (r *movieLinksResolver) Wiki() *string {
+	return optionalString(r.links.Wiki)
+}
+
+// moviePageResolver resolves the fields of the MoviePage type
+type moviePageResolver struct {
+	movies   []*movieResolver
+	metadata data.Metadata
+}
+
+func (r *moviePageResolver) Movies() []*movieResolver {
+	if r.movies == nil {
+		return []*movieResolver{}
+	}
+
+	return r.movies
+}
+
+func (r *moviePageResolver) Metadata() *metadataResolver {
+	return &metadataResolver{r.metadata}
+}
+
+// metadataResolver resolves the fields of the Metadata type
+type metadataResolver struct {
+	metadata data.Metadata
+}
+
+func (r *metadataResolver) CurrentPage() int32 {
+	return int32(r.metadata.CurrentPage)
+}
+
+func (r *metadataResolver) PageSize() int32 {
+	return int32(r.metadata.PageSize)
+}
+
+func (r *metadataResolver) FirstPage() int32 {
+	return int32(r.metadata.FirstPage)
+}
+
+func (r *metadataResolver) LastPage() int32 {
+	return int32(r.metadata.LastPage)
+}
+
+func (r *metadataResolver) TotalRecords() int32 {
+	return int32(r.metadata.TotalRecords)
+}
+
+// optionalString returns nil for an empty string, so that unset values are null
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/grpc/moviesv1"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// serveGRPC serves the gRPC MovieService on -grpc-port, over TLS with tlsConfig
+// unless it is nil. It runs in the API process, so that the writes made through it
+// invalidate the caches and reach the event streams and webhooks like those of the
+// HTTP handlers.
+func (app *application) serveGRPC(tlsConfig *tls.Config) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(app.grpcRecoverPanic, app.grpcLogRequest, app.grpcAuthenticate),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	moviesv1.RegisterMovieServiceServer(srv, &movieServer{app: app})
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", app.config.grpc.port))
+	if err != nil {
+		app.logger.Error(err.Error(), "server", "grpc")
+		return
+	}
+
+	app.logger.Info("starting gRPC server", "addr", listener.Addr().String(), "tls", tlsConfig != nil)
+	err = srv.Serve(listener)
+	app.logger.Error(err.Error(), "server", "grpc")
+}
+
+// grpcRecoverPanic turns a panic in a handler into an INTERNAL error, so that one
+// bad call does not take the server down
+func (app *application) grpcRecoverPanic(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			app.logger.Error(fmt.Sprintf("%s", p), "method", info.FullMethod, "stack", string(debug.Stack()))
+			err = status.Error(codes.Internal, "the server encountered a problem and could not process your request")
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// grpcLogRequest logs the method, status code and duration of every call
+func (app *application) grpcLogRequest(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	app.logger.Info("request", "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+
+	return resp, err
+}
+
+// grpcAuthenticate resolves the tenant of a call from its credentials, as
+// resolveTenant and requireAdmin do for HTTP requests: an API key in the x-api-key
+// metadata selects its tenant, and the admin token, as a bearer token in the
+// authorization metadata, the default tenant. The service is meant for internal
+// services, so calls without credentials are rejected. Failed authentications count
+// toward the same lockouts of the client IP as over HTTP.
+func (app *application) grpcAuthenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	apiKey := firstValue(md, "x-api-key")
+	token, _ := strings.CutPrefix(firstValue(md, "authorization"), "Bearer ")
+
+	scheme := authSchemeAPIKey
+	switch {
+	case apiKey != "":
+	case token != "" && app.config.admin.token != "":
+		scheme = authSchemeAdminToken
+	default:
+		return nil, status.Error(codes.Unauthenticated, "invalid or missing authentication token")
+	}
+
+	ip := grpcClientIP(ctx)
+	lockout, err := app.authLockedOut(ctx, ip, scheme)
+	if err != nil {
+		// fail open, like the rate limiter
+		app.logger.Error(err.Error(), "method", info.FullMethod)
+	}
+	if lockout > 0 {
+		return nil, authLockedOutStatus(lockout)
+	}
+
+	if scheme == authSchemeAdminToken {
+		if !app.isAdminToken(token) {
+			app.authFailed(ctx, ip, scheme)
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing authentication token")
+		}
+		app.authSucceeded(ctx, ip, scheme)
+
+		return handler(ctx, req)
+	}
+
+	tenant, err := app.models.WithContext(ctx).Tenants.GetByAPIKey(apiKey)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.authFailed(ctx, ip, scheme)
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		return nil, app.errorStatus(err)
+	}
+
+	return handler(data.WithTenant(ctx, tenant.ID), req)
+}
+
+// firstValue returns the first value of the metadata key, or an empty string
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcClientIP returns the IP address of the peer of a call
+func grpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// authLockedOutStatus returns the RESOURCE_EXHAUSTED status of a call from a client
+// which is locked out for the given duration, with a RetryInfo detail
+func authLockedOutStatus(lockout time.Duration) error {
+	message := "too many failed authentication attempts, please try again later"
+
+	st, err := status.New(codes.ResourceExhausted, message).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(lockout.Round(time.Second) + time.Second),
+	})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, message)
+	}
+
+	return st.Err()
+}
+
+// movieServer implements moviesv1.MovieServiceServer on top of the data models.
+// Validation and error handling follow the JSON API, with its error responses
+// mapped onto gRPC status codes.
+type movieServer struct {
+	moviesv1.UnimplementedMovieServiceServer
+	app *application
+}
+
+func (s *movieServer) GetMovie(ctx context.Context, req *moviesv1.GetMovieRequest) (*moviesv1.GetMovieResponse, error) {
+	movie, err := s.getMovie(s.app.models.WithContext(ctx), req.GetMovie())
+	if err != nil {
+		return nil, s.app.errorStatus(err)
+	}
+
+	return &moviesv1.GetMovieResponse{Movie: movieToProto(movie)}, nil
+}
+
+func (s *movieServer) ListMovies(ctx context.Context, req *moviesv1.ListMoviesRequest) (*moviesv1.ListMoviesResponse, error) {
+	filters := data.Filters{
+		Page:         int(req.GetPage()),
+		PageSize:     int(req.GetPageSize()),
+		Sort:         req.GetSort(),
+		SortSafelist: []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"},
+	}
+	if filters.Page == 0 {
+		filters.Page = 1
+	}
+	if filters.PageSize == 0 {
+		filters.PageSize = 20
+	}
+	if filters.Sort == "" {
+		filters.Sort = "id"
+	}
+
+	v := validator.New()
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		return nil, invalidArgument(v.Errors)
+	}
+
+	genres := req.GetGenres()
+	if genres == nil {
+		genres = []string{}
+	}
+
+	movies, metadata, err := s.app.models.WithContext(ctx).Movies.GetAll(req.GetTitle(), genres, filters)
+	if err != nil {
+		return nil, s.app.errorStatus(err)
+	}
+
+	resp := &moviesv1.ListMoviesResponse{
+		Movies: make([]*moviesv1.Movie, len(movies)),
+		Metadata: &moviesv1.Metadata{
+			CurrentPage:  int32(metadata.CurrentPage),
+			PageSize:     int32(metadata.PageSize),
+			FirstPage:    int32(metadata.FirstPage),
+			LastPage:     int32(metadata.LastPage),
+			TotalRecords: int32(metadata.TotalRecords),
+		},
+	}
+	for i, movie := range movies {
+		resp.Movies[i] = movieToProto(movie)
+	}
+
+	return resp, nil
+}
+
+func (s *movieServer) CreateMovie(ctx context.Context, req *moviesv1.CreateMovieRequest) (*moviesv1.CreateMovieResponse, error) {
+	movie := &data.Movie{
+		Title:   req.GetTitle(),
+		IMDbID:  req.GetImdbId(),
+		Year:    req.GetYear(),
+		Runtime: data.Runtime(req.GetRuntime()),
+		Genres:  req.GetGenres(),
+		Links: data.MovieLinks{
+			TrailerURL: req.GetLinks().GetTrailerUrl(),
+			Homepage:   req.GetLinks().GetHomepage(),
+			Wiki:       req.GetLinks().GetWiki(),
+		},
+	}
+
+	v := validator.New()
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		return nil, invalidArgument(v.Errors)
+	}
+
+	err := s.app.models.WithContext(ctx).Movies.Insert(movie)
+	if err != nil {
+		return nil, s.app.errorStatus(err)
+	}
+
+	s.app.publishMovieEvent(ctx, "movie.created", movie)
+
+	return &moviesv1.CreateMovieResponse{Movie: movieToProto(movie)}, nil
+}
+
+func (s *movieServer) UpdateMovie(ctx context.Context, req *moviesv1.UpdateMovieRequest) (*moviesv1.UpdateMovieResponse, error) {
+	movie, err := s.getMovie(s.app.models.WithContext(ctx).Primary(), req.GetMovie())
+	if err != nil {
+		return nil, s.app.errorStatus(err)
+	}
+
+	if req.ExpectedVersion != nil && req.GetExpectedVersion() != movie.Version {
+		return nil, s.app.errorStatus(data.ErrEditConflict)
+	}
+
+	if req.Title != nil {
+		movie.Title = req.GetTitle()
+	}
+	if req.ImdbId != nil {
+		movie.IMDbID = req.GetImdbId()
+	}
+	if req.Year != nil {
+		movie.Year = req.GetYear()
+	}
+	if req.Runtime != nil {
+		movie.Runtime = data.Runtime(req.GetRuntime())
+	}
+	if req.Genres != nil {
+		movie.Genres = req.GetGenres().GetValues()
+	}
+	if links := req.GetLinks(); links != nil {
+		if links.TrailerUrl != nil {
+			movie.Links.TrailerURL = links.GetTrailerUrl()
+		}
+		if links.Homepage != nil {
+			movie.Links.Homepage = links.GetHomepage()
+		}
+		if links.Wiki != nil {
+			movie.Links.Wiki = links.GetWiki()
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		return nil, invalidArgument(v.Errors)
+	}
+
+	err = s.app.models.WithContext(ctx).Movies.Update(movie)
+	if err != nil {
+		return nil, s.app.errorStatus(err)
+	}
+
+	s.app.publishMovieEvent(ctx, "movie.updated", movie)
+
+	return &moviesv1.UpdateMovieResponse{Movie: movieToProto(movie)}, nil
+}
+
+func (s *movieServer) DeleteMovie(ctx context.Context, req *moviesv1.DeleteMovieRequest) (*moviesv1.DeleteMovieResponse, error) {
+	movie, err := s.getMovie(s.app.models.WithContext(ctx).Primary(), req.GetMovie())
+	if err != nil {
+		return nil, s.app.errorStatus(err)
+	}
+
+	err = s.app.models.WithContext(ctx).Movies.Delete(movie.ID)
+	if err != nil {
+		return nil, s.app.errorStatus(err)
+	}
+
+	s.app.publishMovieEvent(ctx, "movie.deleted", movieDeletedEvent{UUID: movie.UUID, Version: movie.Version})
+
+	return &moviesv1.DeleteMovieResponse{}, nil
+}
+
+// getMovie retrieves the movie identified by ref from the models by its UUID
+func (s *movieServer) getMovie(models data.Models, ref *moviesv1.MovieRef) (*data.Movie, error) {
+	uuid := ref.GetUuid()
+	if uuid == "" {
+		return nil, invalidArgument(map[string][]string{"movie": {"must be provided"}})
+	}
+	if !validator.Match(uuid, validator.UUIDRX) {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return models.Movies.GetByUUID(strings.ToLower(uuid))
+}
+
+// errorStatus maps an error from the models onto a gRPC status. Unexpected errors
+// are logged and reported as INTERNAL without their details.
+func (app *application) errorStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "the requested resource could not be found")
+	case errors.Is(err, data.ErrEditConflict):
+		return status.Error(codes.Aborted, "unable to update the record due to an edit conflict, please try again")
+	case errors.Is(err, data.ErrDuplicateIMDbID):
+		return status.Error(codes.AlreadyExists, "a movie with this IMDb ID already exists")
+	default:
+		app.logger.Error(err.Error())
+		return status.Error(codes.Internal, "the server encountered a problem and could not process your request")
+	}
+}
+
+// invalidArgument returns an INVALID_ARGUMENT status carrying the validation errors
+// as BadRequest field violations
+func invalidArgument(errs map[string][]string) error {
+	fields := make([]string, 0, len(errs))
+	for field := range errs {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	details := &errdetails.BadRequest{}
+	for _, field := range fields {
+		for _, message := range errs[field] {
+			details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field,
+				Description: message,
+			})
+		}
+	}
+
+	st, err := status.New(codes.InvalidArgument, "the request failed validation").WithDetails(details)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "the request failed validation")
+	}
+
+	return st.Err()
+}
+
+// movieToProto converts a movie from the models into its protobuf message
+func movieToProto(movie *data.Movie) *moviesv1.Movie {
+	return &moviesv1.Movie{
+		Uuid:    movie.UUID,
+		Title:   movie.Title,
+		Slug:    movie.Slug,
+		ImdbId:  movie.IMDbID,
+		Year:    movie.Year,
+		Runtime: int32(movie.Runtime),
+		Genres:  movie.Genres,
+		Links: &moviesv1.MovieLinks{
+			TrailerUrl: movie.Links.TrailerURL,
+			Homepage:   movie.Links.Homepage,
+			Wiki:       movie.Links.Wiki,
+		},
+		Version: movie.Version,
+	}
+}
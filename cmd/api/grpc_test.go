@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCAuthenticate(t *testing.T) {
+	app := &application{logger: slog.New(slog.NewTextHandler(io.Discard, nil)), kv: kvstore.NewMemory()}
+	app.config.admin.token = "s3cr3t-admin-token"
+	app.config.auth.maxFailures = 2
+	app.config.auth.lockout = time.Minute
+	app.config.auth.maxLockout = time.Hour
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greenlight.movies.v1.MovieService/GetMovie"}
+
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want codes.Code
+	}{
+		{"no credentials", nil, codes.Unauthenticated},
+		{"admin token", metadata.Pairs("authorization", "Bearer s3cr3t-admin-token"), codes.OK},
+		{"wrong admin token", metadata.Pairs("authorization", "Bearer guess"), codes.Unauthenticated},
+		{"wrong admin token again", metadata.Pairs("authorization", "Bearer guess"), codes.Unauthenticated},
+		{"locked out", metadata.Pairs("authorization", "Bearer s3cr3t-admin-token"), codes.ResourceExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+
+			_, err := app.grpcAuthenticate(ctx, nil, info, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,167 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
 )
 
+// healthState is the state of a dependency or background job
+type healthState string
+
+const (
+	healthOK       healthState = "ok"
+	healthDegraded healthState = "degraded"
+	healthDown     healthState = "down"
+)
+
+const (
+	// healthPingTimeout bounds each dependency check of the healthcheck
+	healthPingTimeout = 500 * time.Millisecond
+	// slowPingThreshold is the ping latency above which a dependency is degraded
+	slowPingThreshold = 100 * time.Millisecond
+	// busyPoolThreshold is the fraction of a connection pool in use above which the
+	// database is degraded
+	busyPoolThreshold = 0.9
+)
+
+// healthCheck is the outcome of the check of a dependency or background job
+type healthCheck struct {
+	Status    healthState    `json:"status"`
+	LatencyMS *int64         `json:"latency_ms,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// healthCheckHandler reports the status of the server together with the state of
+// its dependencies and background jobs. The server is available when they are all
+// ok, degraded when any of them isn't, and unavailable, with a 503 response, when the
+// database is down.
 func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	build := readBuildInfo()
+
+	checks := app.checkDependencies(r.Context())
+	for name, check := range app.jobs.health() {
+		checks["job:"+name] = check
+	}
+
+	status, code := "available", http.StatusOK
+	for _, check := range checks {
+		if check.Status != healthOK {
+			status = "degraded"
+		}
+	}
+	if checks["database"].Status == healthDown {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
 	env := envelope{
-		"status": "available",
+		"status": status,
 		"system_info": map[string]string{
 			"environment": app.config.env,
-			"version":     version,
+			"version":     build.version,
+			"commit":      build.commit,
+			"build_time":  build.buildTime,
+			"go_version":  build.goVersion,
 		},
+		"checks": checks,
 	}
 
-	err := app.writeJSON(w, http.StatusOK, env, nil)
+	err := app.writeJSON(w, code, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// checkDependencies checks the database, its read replica if any, and the kvstore
+// concurrently
+func (app *application) checkDependencies(ctx context.Context) map[string]healthCheck {
+	checks := make(map[string]healthCheck)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	check := func(name string, fn func(ctx context.Context) healthCheck) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, healthPingTimeout)
+			defer cancel()
+
+			c := fn(ctx)
+			mu.Lock()
+			checks[name] = c
+			mu.Unlock()
+		}()
+	}
+
+	if app.db != nil {
+		check("database", app.checkDatabase)
+	}
+	if app.replica != nil {
+		check("replica", func(ctx context.Context) healthCheck {
+			return pingCheck(ctx, app.replica.PingContext)
+		})
+	}
+	if app.kv != nil {
+		check("kvstore", func(ctx context.Context) healthCheck {
+			return pingCheck(ctx, func(ctx context.Context) error {
+				_, err := app.kv.Get(ctx, "health:ping")
+				if errors.Is(err, kvstore.ErrNotFound) {
+					return nil
+				}
+				return err
+			})
+		})
+	}
+
+	wg.Wait()
+	return checks
+}
+
+// checkDatabase pings the database and reports the utilization of its pool
+func (app *application) checkDatabase(ctx context.Context) healthCheck {
+	check := pingCheck(ctx, app.db.PingContext)
+
+	if app.dbPool != nil {
+		stat := app.dbPool.Stat()
+		utilization := float64(stat.AcquiredConns()) / float64(stat.MaxConns())
+
+		check.Details = map[string]any{
+			"max_conns":      stat.MaxConns(),
+			"total_conns":    stat.TotalConns(),
+			"acquired_conns": stat.AcquiredConns(),
+			"idle_conns":     stat.IdleConns(),
+			"utilization":    utilization,
+		}
+		if check.Status == healthOK && utilization >= busyPoolThreshold {
+			check.Status = healthDegraded
+		}
+	}
+
+	return check
+}
+
+// pingCheck checks a dependency with ping, which is down if the ping fails and
+// degraded if it is slow
+func pingCheck(ctx context.Context, ping func(context.Context) error) healthCheck {
+	start := time.Now()
+	err := ping(ctx)
+	latency := time.Since(start)
+
+	ms := latency.Milliseconds()
+	check := healthCheck{Status: healthOK, LatencyMS: &ms}
+	switch {
+	case err != nil:
+		check.Status = healthDown
+		check.Error = err.Error()
+	case latency > slowPingThreshold:
+		check.Status = healthDegraded
+	}
+
+	return check
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/aviagarwal1212/greenlight/internal/i18n"
 	"github.com/aviagarwal1212/greenlight/internal/validator"
 	"github.com/go-chi/chi/v5"
 )
@@ -27,28 +29,131 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// movieRef identifies a movie from the {id} URL parameter, which may hold either
+// the internal numeric ID or the public UUID.
+type movieRef struct {
+	id   int64
+	uuid string
+}
+
+// readMovieRef reads the {id} URL parameter as a UUID if it has the form of one,
+// and as a numeric ID otherwise
+func (app *application) readMovieRef(r *http.Request) (movieRef, error) {
+	param := chi.URLParamFromCtx(r.Context(), "id")
+	if validator.Match(param, validator.UUIDRX) {
+		return movieRef{uuid: strings.ToLower(param)}, nil
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		return movieRef{}, err
+	}
+
+	return movieRef{id: id}, nil
+}
+
+// readSlugParam returns the slug parameter from the request URL
+func (app *application) readSlugParam(r *http.Request) string {
+	return chi.URLParamFromCtx(r.Context(), "slug")
+}
+
+// writeJSON writes the envelope as the response body, as JSON unless the
+// negotiateEncoding middleware chose MessagePack or JSON:API for the request. The
+// resources of the envelope are trimmed to the sparse fieldset of the request, if
+// there is one. The JSON is compact unless the request asks for it indented.
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+	if ew, ok := w.(*encodingWriter); ok {
+		if ew.jsonapi {
+			return app.writeJSONAPI(w, status, data, ew.fields, headers)
+		}
+		if ew.fields != nil {
+			data = applyFields(data, ew.fields)
+		}
+		if ew.msgpack {
+			return app.writeMsgpack(w, status, data, headers)
+		}
+		if ew.runtimeFormat != "string" {
+			data = formatRuntimes(data, ew.runtimeFormat)
+		}
+	}
+
+	return app.encodeJSON(w, status, "application/json", data, headers)
+}
+
+// encodeJSON encodes v straight to the response, indented with tabs if the request
+// asked for it with ?pretty=true, or by default with -pretty-json, and compact
+// otherwise. The status and headers are only sent with the body, so that an error
+// encoding v can still be answered with an error response.
+func (app *application) encodeJSON(w http.ResponseWriter, status int, contentType string, v any, headers http.Header) error {
+	pretty := app.config.prettyJSON
+	if ew, ok := w.(*encodingWriter); ok {
+		pretty = ew.pretty
+	}
+
+	// json.Encoder encodes the whole value into a pooled buffer before writing it in
+	// one go, so nothing is written if it fails
+	encoder := json.NewEncoder(&headerWriter{w: w, status: status, contentType: contentType, headers: headers})
+	if pretty {
+		encoder.SetIndent("", "\t")
+	}
+
+	return encoder.Encode(v)
+}
+
+// headerWriter writes the status and headers of a response before the first write
+// of its body
+type headerWriter struct {
+	w           http.ResponseWriter
+	status      int
+	contentType string
+	headers     http.Header
+	wroteHeader bool
+}
+
+func (hw *headerWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		for key, value := range hw.headers {
+			hw.w.Header()[key] = value
+		}
+
+		hw.w.Header().Set("Content-Type", hw.contentType)
+		hw.w.WriteHeader(hw.status)
+		hw.wroteHeader = true
+	}
+
+	// like an error encoding the body, an error writing it (e.g. to a client which
+	// has gone away) cannot be answered once the headers are sent
+	hw.w.Write(b)
+	return len(b), nil
+}
+
+func (app *application) writeMsgpack(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+	body, err := marshalMsgpack(data)
 	if err != nil {
 		return err
 	}
-	js = append(js, '\n')
 
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", msgpackContentType)
 	w.WriteHeader(status)
-	w.Write(js)
+	w.Write(body)
 
 	return nil
 }
 
+// bodyTooLarge returns the error reported for a request body over its size limit,
+// and advertises the limit in the X-Max-Request-Body header of the response
+func bodyTooLarge(w http.ResponseWriter, err *http.MaxBytesError) error {
+	w.Header().Set("X-Max-Request-Body", strconv.FormatInt(err.Limit, 10))
+	return fmt.Errorf("body must not be larger than %d bytes", err.Limit)
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
-	// restrict request body to 1MB or return http.MaxBytesError
-	max_bytes := 1_048_576
-	r.Body = http.MaxBytesReader(w, r.Body, int64(max_bytes))
+	// restrict request body to -max-request-body or return http.MaxBytesError
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.maxRequestBody)
 
 	decoder := json.NewDecoder(r.Body)
 	// if JSON from the client contains any fields which can not be mapped to the target destination,
@@ -87,7 +192,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
 		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+			return bodyTooLarge(w, maxBytesError)
 
 		default:
 			return err
@@ -104,6 +209,68 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+// jsonFields records the fields of a JSON object body which were present, by their
+// path from the root such as "links.wiki", and whether each was sent as null
+type jsonFields map[string]bool
+
+// readJSONFields decodes the request body into dst like readJSON, and also returns
+// the fields present in it, so that an update can tell a field sent as null from an
+// absent one; both decode into a nil pointer or a zero value.
+func (app *application) readJSONFields(w http.ResponseWriter, r *http.Request, dst any) (jsonFields, error) {
+	js, err := io.ReadAll(http.MaxBytesReader(w, r.Body, app.config.maxRequestBody))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, bodyTooLarge(w, maxBytesError)
+		}
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(js))
+
+	err = app.readJSON(w, r, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	// readJSON has decoded the body into a struct, so it is an object or null
+	var object map[string]any
+	err = json.Unmarshal(js, &object)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(jsonFields)
+	fields.collect("", object)
+	return fields, nil
+}
+
+func (f jsonFields) collect(parent string, object map[string]any) {
+	for name, value := range object {
+		key := name
+		if parent != "" {
+			key = parent + "." + name
+		}
+
+		f[key] = value == nil
+		if nested, ok := value.(map[string]any); ok {
+			f.collect(key, nested)
+		}
+	}
+}
+
+// null reports whether the field with the given path was sent as null
+func (f jsonFields) null(key string) bool {
+	return f[key]
+}
+
+// checkNotNull records a validation error for each of the given fields which was sent
+// as null, for the fields an update cannot clear
+func (f jsonFields) checkNotNull(v *validator.Validator, keys ...string) {
+	for _, key := range keys {
+		v.Check(!f.null(key), key, "must not be null")
+	}
+}
+
 // readString() helper returns a string value from the query parameter string,
 // or the provided default value
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
@@ -144,3 +311,38 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 	return num
 }
+
+// baseURL returns the scheme and host the client used to reach the server, for
+// building absolute links (e.g. in feeds)
+func (app *application) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// language returns the language of the messages sent to the client, negotiated from
+// the Accept-Language header of the request
+func (app *application) language(r *http.Request) string {
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// background runs fn in a new goroutine which is tracked by the application's wait
+// group, recovering from any panic so that it cannot crash the server.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+)
+
+// discardWriter is a ResponseWriter which throws the response away, so that the
+// benchmarks measure the encoding rather than a growing recorder
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// benchmarkMovies returns a listing of n movies with every field set
+func benchmarkMovies(n int) envelope {
+	movies := make([]*data.Movie, n)
+	for i := range movies {
+		movies[i] = &data.Movie{
+			ID:      int64(i + 1),
+			UUID:    fmt.Sprintf("0b7f7a4e-4bb3-4c59-8d6c-%012d", i),
+			Title:   fmt.Sprintf("Movie number %d", i),
+			Slug:    fmt.Sprintf("movie-number-%d", i),
+			IMDbID:  fmt.Sprintf("tt%07d", i),
+			Year:    1950 + int32(i%75),
+			Runtime: data.Runtime(80 + i%90),
+			Genres:  data.Genres{"drama", "sci-fi", "thriller"},
+			Links: data.MovieLinks{
+				TrailerURL: "https://example.com/trailers/" + fmt.Sprint(i),
+				Homepage:   "https://example.com/movies/" + fmt.Sprint(i),
+				Wiki:       "https://en.wikipedia.org/wiki/Movie_" + fmt.Sprint(i),
+			},
+			Version: 1,
+		}
+	}
+
+	return envelope{
+		"movies":   movies,
+		"metadata": data.Metadata{CurrentPage: 1, PageSize: n, FirstPage: 1, LastPage: 1, TotalRecords: n},
+	}
+}
+
+// BenchmarkWriteJSON measures writeJSON, which encodes a listing straight to the
+// response, against marshaling it into a byte slice first as it used to
+func BenchmarkWriteJSON(b *testing.B) {
+	env := benchmarkMovies(1000)
+
+	for _, pretty := range []bool{false, true} {
+		app := &application{}
+		app.config.prettyJSON = pretty
+
+		b.Run(fmt.Sprintf("encoder/pretty=%t", pretty), func(b *testing.B) {
+			w := &discardWriter{header: make(http.Header)}
+			b.ReportAllocs()
+
+			for range b.N {
+				err := app.writeJSON(w, http.StatusOK, env, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("marshal/pretty=%t", pretty), func(b *testing.B) {
+			w := &discardWriter{header: make(http.Header)}
+			b.ReportAllocs()
+
+			for range b.N {
+				var js []byte
+				var err error
+				if pretty {
+					js, err = json.MarshalIndent(env, "", "\t")
+				} else {
+					js, err = json.Marshal(env)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+				js = append(js, '\n')
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write(js)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/i18n"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+const (
+	// maxImportRows caps the number of movies in a single import file
+	maxImportRows = 1000
+)
+
+// importFormats maps the accepted Content-Types of an import file to its format
+var importFormats = map[string]string{
+	"text/csv":              "csv",
+	"application/x-ndjson":  "jsonl",
+	"application/jsonl":     "jsonl",
+	"application/jsonlines": "jsonl",
+}
+
+// csvImportColumns are the columns an import CSV may contain, in any order. Only
+// the title column is required.
+var csvImportColumns = []string{"title", "imdb_id", "year", "runtime", "genres", "trailer_url", "homepage", "wiki"}
+
+// importRow is one movie read from an import file, identified by its line number
+type importRow struct {
+	line   int
+	input  movieInput
+	errors map[string][]string
+}
+
+// importRowResult reports the outcome for one row of an import file
+type importRowResult struct {
+	Line   int                 `json:"line"`
+	Status string              `json:"status"`
+	Movie  *data.Movie         `json:"movie,omitempty"`
+	Errors map[string][]string `json:"errors,omitempty"`
+}
+
+// importSummary counts the rows of an import file by their outcome
+type importSummary struct {
+	DryRun  bool `json:"dry_run"`
+	Rows    int  `json:"rows"`
+	Created int  `json:"created"`
+	Skipped int  `json:"skipped"`
+	Invalid int  `json:"invalid"`
+	Failed  int  `json:"failed"`
+}
+
+// importMoviesFileHandler creates movies from an uploaded CSV or JSON-lines file. The
+// file is the request body, and its format is taken from the Content-Type header
+// (text/csv or application/x-ndjson), or from ?format=csv|jsonl.
+//
+// A CSV file starts with a header row naming its columns, out of title, imdb_id,
+// year, runtime, genres, trailer_url, homepage and wiki. The runtime is a number of
+// minutes, or in any format of data.ParseRuntime (e.g. "102 mins" or "1h 42m"), and
+// genres are separated by "|":
+//
+//	title,year,runtime,genres,imdb_id
+//	Casablanca,1942,102,drama|romance,tt0034583
+//
+// A JSON-lines file holds one movie per line in the same format as for
+// createMovieHandler.
+//
+// Every row is validated on its own. Valid rows are created, invalid rows are
+// reported with their validation errors, and rows whose imdb_id is already taken (by
+// an existing movie or an earlier row) are skipped. With ?dry_run=true nothing is
+// created, and the rows are reported as "would_create" or "would_skip" instead.
+//
+// The response contains a summary of the counts and one result per row.
+func (app *application) importMoviesFileHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	dryRun, err := strconv.ParseBool(app.readString(qs, "dry_run", "false"))
+	v.Check(err == nil, "dry_run", "must be true or false")
+
+	format := app.readString(qs, "format", "")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format = importFormats[mediaType]
+	}
+	v.Check(validator.PermittedValue(format, "csv", "jsonl"), "format", "must be csv or jsonl, or set by a text/csv or application/x-ndjson Content-Type")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.maxImportBody)
+
+	var rows []importRow
+	if format == "csv" {
+		rows, err = readImportCSV(r.Body)
+	} else {
+		rows, err = readImportJSONLines(r.Body, int(app.config.maxImportBody))
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = bodyTooLarge(w, maxBytesError)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v.Check(validator.MinItems(rows, 1), "file", "must contain at least 1 movie")
+	v.Check(validator.MaxItems(rows, maxImportRows), "file", fmt.Sprintf("must not contain more than %d movies", maxImportRows))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results := make([]importRowResult, len(rows))
+	movies := make([]*data.Movie, len(rows))
+	var imdbIDs []string
+
+	for i, row := range rows {
+		results[i].Line = row.line
+		if row.errors != nil {
+			results[i].Status = "invalid"
+			results[i].Errors = i18n.TranslateAll(app.language(r), row.errors)
+			continue
+		}
+
+		movie := row.input.movie()
+
+		mv := validator.New()
+		if data.ValidateMovie(mv, movie); !mv.Valid() {
+			results[i].Status = "invalid"
+			results[i].Errors = i18n.TranslateAll(app.language(r), mv.Errors)
+			continue
+		}
+
+		movies[i] = movie
+		if movie.IMDbID != "" {
+			imdbIDs = append(imdbIDs, movie.IMDbID)
+		}
+	}
+
+	existing := map[string]bool{}
+	if len(imdbIDs) > 0 {
+		existing, err = app.modelsFor(r).Movies.ExistingIMDbIDs(imdbIDs)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	var valid []*data.Movie
+	var validIndexes []int
+
+	for i, movie := range movies {
+		if movie == nil {
+			continue
+		}
+		if movie.IMDbID != "" {
+			if existing[movie.IMDbID] {
+				results[i].Status = "skipped"
+				continue
+			}
+			existing[movie.IMDbID] = true
+		}
+
+		valid = append(valid, movie)
+		validIndexes = append(validIndexes, i)
+	}
+
+	if dryRun {
+		for _, i := range validIndexes {
+			results[i].Status = "would_create"
+		}
+		for i := range results {
+			if results[i].Status == "skipped" {
+				results[i].Status = "would_skip"
+			}
+		}
+	} else if len(valid) > 0 {
+		errs, err := app.insertImported(r, valid)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for n, i := range validIndexes {
+			switch {
+			case errors.Is(errs[n], data.ErrDuplicateIMDbID):
+				// another request created the movie since the lookup above
+				results[i].Status = "skipped"
+			case errs[n] != nil:
+				app.logError(r, errs[n])
+				results[i].Status = "failed"
+			default:
+				results[i].Status = "created"
+				results[i].Movie = valid[n]
+			}
+		}
+	}
+
+	summary := importSummary{DryRun: dryRun, Rows: len(results)}
+	for _, result := range results {
+		switch result.Status {
+		case "created", "would_create":
+			summary.Created++
+		case "skipped", "would_skip":
+			summary.Skipped++
+		case "invalid":
+			summary.Invalid++
+		case "failed":
+			summary.Failed++
+		}
+		if result.Status == "created" {
+			app.publishMovieEvent(r.Context(), "movie.created", result.Movie)
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"summary": summary, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// insertImported inserts the movies of an import with a single COPY. If another
+// request created one of the movies since their IMDb IDs were looked up, the COPY
+// fails as a whole, and the movies are inserted one by one instead so that only the
+// duplicates are skipped. It returns one error per movie, as InsertEach.
+func (app *application) insertImported(r *http.Request, movies []*data.Movie) ([]error, error) {
+	err := app.modelsFor(r).Movies.InsertMany(movies)
+	switch {
+	case errors.Is(err, data.ErrDuplicateIMDbID):
+		return app.modelsFor(r).Movies.InsertEach(movies)
+	case err != nil:
+		return nil, err
+	}
+
+	return make([]error, len(movies)), nil
+}
+
+// readImportCSV reads the movies of a CSV import file. Errors in a single row are
+// recorded on the row; an error is only returned if the file as a whole is unusable.
+func readImportCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, fmt.Errorf("body contains badly-formed CSV: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.PermittedValue(name, csvImportColumns...) {
+			return nil, fmt.Errorf("CSV header contains unknown column %q", name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("CSV header contains duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("CSV header must contain a title column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: line}
+
+		switch {
+		case errors.Is(err, csv.ErrFieldCount):
+			row.errors = map[string][]string{"row": {fmt.Sprintf("must have %d fields", len(header))}}
+		case err != nil:
+			return nil, fmt.Errorf("body contains badly-formed CSV: %w", err)
+		default:
+			row.input, row.errors = csvMovieInput(columns, record)
+		}
+
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return rows, nil
+		}
+	}
+}
+
+// csvMovieInput converts a CSV record into a movie input, returning the errors for
+// fields which cannot be converted
+func csvMovieInput(columns map[string]int, record []string) (movieInput, map[string][]string) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	v := validator.New()
+	input := movieInput{
+		Title:  field("title"),
+		IMDbID: field("imdb_id"),
+		Links: data.MovieLinks{
+			TrailerURL: field("trailer_url"),
+			Homepage:   field("homepage"),
+			Wiki:       field("wiki"),
+		},
+	}
+
+	if year := field("year"); year != "" {
+		n, err := strconv.ParseInt(year, 10, 32)
+		v.Check(err == nil, "year", "must be an integer")
+		input.Year = int32(n)
+	}
+
+	if runtime := field("runtime"); runtime != "" {
+		n, err := strconv.ParseInt(runtime, 10, 32)
+		if err == nil {
+			input.Runtime = data.Runtime(n)
+		} else {
+			input.Runtime, err = data.ParseRuntime(runtime)
+			v.Check(err == nil, "runtime", "must be a number of minutes")
+		}
+	}
+
+	if genres := field("genres"); genres != "" {
+		for _, genre := range strings.Split(genres, "|") {
+			input.Genres = append(input.Genres, strings.TrimSpace(genre))
+		}
+	}
+
+	if !v.Valid() {
+		return input, v.Errors
+	}
+
+	return input, nil
+}
+
+// readImportJSONLines reads the movies of a JSON-lines import file. Blank lines are
+// ignored, and a line which cannot be decoded is recorded as an invalid row. Lines
+// may be up to maxLine bytes long.
+func readImportJSONLines(body io.Reader, maxLine int) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		row := importRow{line: line}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&row.input)
+		if err == nil && decoder.More() {
+			err = errors.New("line must contain a single JSON value")
+		}
+		if err != nil {
+			row.errors = map[string][]string{"row": {err.Error()}}
+		}
+
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return rows, nil
+		}
+	}
+
+	return rows, scanner.Err()
+}
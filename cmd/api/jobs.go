@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// jobTracker records the outcome of the runs of the background jobs, for the
+// healthcheck
+type jobTracker struct {
+	mu      sync.Mutex
+	started time.Time
+	jobs    map[string]*jobRuns
+}
+
+// jobRuns holds the last outcomes of a job which runs every interval
+type jobRuns struct {
+	interval    time.Duration
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{started: time.Now(), jobs: make(map[string]*jobRuns)}
+}
+
+// register declares a job which is expected to run every interval
+func (t *jobTracker) register(name string, interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.jobs[name] = &jobRuns{interval: interval}
+}
+
+// succeeded records a successful run of a job
+func (t *jobTracker) succeeded(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if job, ok := t.jobs[name]; ok {
+		job.lastSuccess = time.Now()
+	}
+}
+
+// failed records a failed run of a job
+func (t *jobTracker) failed(name string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if job, ok := t.jobs[name]; ok {
+		job.lastFailure = time.Now()
+		job.lastError = err.Error()
+	}
+}
+
+// health reports on every job. A job is ok if it succeeded within three of its
+// intervals and hasn't failed since, degraded if it succeeded within ten, and down
+// otherwise. Until a job first succeeds, the time since startup is used.
+func (t *jobTracker) health() map[string]healthCheck {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	checks := make(map[string]healthCheck, len(t.jobs))
+	for name, job := range t.jobs {
+		since := job.lastSuccess
+		if since.IsZero() {
+			since = t.started
+		}
+		age := time.Since(since)
+
+		check := healthCheck{Status: healthOK, Details: map[string]any{}}
+		switch {
+		case age > 10*job.interval:
+			check.Status = healthDown
+		case age > 3*job.interval || job.lastFailure.After(job.lastSuccess):
+			check.Status = healthDegraded
+		}
+
+		if !job.lastSuccess.IsZero() {
+			check.Details["last_success"] = job.lastSuccess.UTC().Format(time.RFC3339)
+		}
+		if job.lastFailure.After(job.lastSuccess) {
+			check.Error = job.lastError
+		}
+
+		checks[name] = check
+	}
+
+	return checks
+}
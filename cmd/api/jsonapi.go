@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+)
+
+// jsonAPIContentType is the media type of JSON:API documents
+const jsonAPIContentType = "application/vnd.api+json"
+
+// jsonAPIDocument is the top level of a JSON:API response. Exactly one of Data and
+// Errors is set, except for responses without a primary resource, which only carry
+// Meta.
+type jsonAPIDocument struct {
+	Data    any            `json:"data,omitempty"`
+	Errors  []jsonAPIError `json:"errors,omitempty"`
+	Meta    map[string]any `json:"meta,omitempty"`
+	JSONAPI map[string]any `json:"jsonapi"`
+}
+
+// jsonAPIResource is a resource object, such as a movie
+type jsonAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]any                 `json:"attributes"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships,omitempty"`
+	Links         *jsonAPILinks                  `json:"links,omitempty"`
+}
+
+type jsonAPILinks struct {
+	Self string `json:"self"`
+}
+
+// jsonAPIRelationship links a resource to another one by its identifier
+type jsonAPIRelationship struct {
+	Data jsonAPIIdentifier `json:"data"`
+}
+
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// jsonPointerReplacer turns the path of a field in a validation error, such as
+// "genres[2]", into the segments of a JSON pointer, such as "genres/2"
+var jsonPointerReplacer = strings.NewReplacer(".", "/", "[", "/", "]", "")
+
+// jsonAPIError is an error object. Validation errors carry a pointer to the
+// invalid attribute in Source, and the about link points at the documentation.
+type jsonAPIError struct {
+	Status string            `json:"status"`
+	Title  string            `json:"title"`
+	Detail string            `json:"detail,omitempty"`
+	Source map[string]string `json:"source,omitempty"`
+	Meta   any               `json:"meta,omitempty"`
+	Links  map[string]string `json:"links,omitempty"`
+}
+
+// wantsJSONAPI reports whether the Accept header of the request asks for JSON:API
+func wantsJSONAPI(r *http.Request) bool {
+	return accepts(r, jsonAPIContentType)
+}
+
+// writeJSONAPI writes the envelope as a JSON:API document. Error responses become
+// error objects, the movies, webhooks or deliveries of the envelope become the
+// primary data, and the rest of the envelope (pagination metadata and the like)
+// becomes the meta object. The attributes of the resources are limited to the
+// sparse fieldset, if it is not nil.
+func (app *application) writeJSONAPI(w http.ResponseWriter, status int, env envelope, fields []string, headers http.Header) error {
+	doc, err := toJSONAPI(status, env, fields)
+	if err != nil {
+		return err
+	}
+
+	return app.encodeJSON(w, status, jsonAPIContentType, doc, headers)
+}
+
+// toJSONAPI converts the envelope of a response with the given status into a JSON:API
+// document
+func toJSONAPI(status int, env envelope, fields []string) (*jsonAPIDocument, error) {
+	doc := &jsonAPIDocument{JSONAPI: map[string]any{"version": "1.1"}}
+
+	if message, ok := env["error"]; ok && status >= 400 {
+		doc.Errors = jsonAPIErrors(status, message)
+		if docs, ok := env["docs"].(string); ok {
+			for i := range doc.Errors {
+				doc.Errors[i].Links = map[string]string{"about": docs}
+			}
+		}
+		return doc, nil
+	}
+
+	// the keys are sorted so that the primary data is picked deterministically
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := env[key]
+
+		if doc.Data == nil {
+			resources, ok, err := jsonAPIResources(value, fields)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				doc.Data = resources
+				continue
+			}
+		}
+
+		if doc.Meta == nil {
+			doc.Meta = make(map[string]any)
+		}
+		if key == "metadata" {
+			// pagination metadata is kept apart from the rest of meta, under page
+			if metadata, ok := value.(data.Metadata); ok {
+				doc.Meta["page"] = metadata
+				continue
+			}
+		}
+		doc.Meta[key] = value
+	}
+
+	return doc, nil
+}
+
+// jsonAPIResources converts a value of an envelope into a resource object or an
+// array of them, and reports whether it is a resource at all
+func jsonAPIResources(value any, fields []string) (any, bool, error) {
+	switch value := value.(type) {
+	case *data.Movie:
+		return jsonAPIOne(value, fields, jsonAPIMovie)
+	case []*data.Movie:
+		return jsonAPIMany(value, fields, jsonAPIMovie)
+	case *data.Webhook:
+		return jsonAPIOne(value, fields, jsonAPIWebhook)
+	case []*data.Webhook:
+		return jsonAPIMany(value, fields, jsonAPIWebhook)
+	case *data.WebhookDelivery:
+		return jsonAPIOne(value, fields, jsonAPIDelivery)
+	case []*data.WebhookDelivery:
+		return jsonAPIMany(value, fields, jsonAPIDelivery)
+	default:
+		return nil, false, nil
+	}
+}
+
+func jsonAPIOne[T any](value T, fields []string, convert func(T) (*jsonAPIResource, error)) (any, bool, error) {
+	resource, err := convert(value)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if fields != nil {
+		maps.DeleteFunc(resource.Attributes, func(name string, _ any) bool {
+			return !slices.Contains(fields, name)
+		})
+	}
+
+	return resource, true, nil
+}
+
+func jsonAPIMany[T any](values []T, fields []string, convert func(T) (*jsonAPIResource, error)) (any, bool, error) {
+	// an empty listing is an empty array, not a missing one
+	resources := make([]any, 0, len(values))
+	for _, value := range values {
+		resource, _, err := jsonAPIOne(value, fields, convert)
+		if err != nil {
+			return nil, true, err
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, true, nil
+}
+
+func jsonAPIMovie(movie *data.Movie) (*jsonAPIResource, error) {
+	return newJSONAPIResource("movies", movie.UUID, movie, "/v1/movies/"+movie.UUID)
+}
+
+func jsonAPIWebhook(webhook *data.Webhook) (*jsonAPIResource, error) {
+	return newJSONAPIResource("webhooks", strconv.FormatInt(webhook.ID, 10), webhook, fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+}
+
+func jsonAPIDelivery(delivery *data.WebhookDelivery) (*jsonAPIResource, error) {
+	resource, err := newJSONAPIResource("webhook-deliveries", strconv.FormatInt(delivery.ID, 10), delivery, "")
+	if err != nil {
+		return nil, err
+	}
+
+	delete(resource.Attributes, "webhook_id")
+	resource.Relationships = map[string]jsonAPIRelationship{
+		"webhook": {Data: jsonAPIIdentifier{Type: "webhooks", ID: strconv.FormatInt(delivery.WebhookID, 10)}},
+	}
+
+	return resource, nil
+}
+
+// newJSONAPIResource builds a resource object whose attributes are the JSON fields
+// of v, without its id, and whose self link is self, if given.
+func newJSONAPIResource(typ, id string, v any, self string) (*jsonAPIResource, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes map[string]any
+	err = json.Unmarshal(js, &attributes)
+	if err != nil {
+		return nil, err
+	}
+	delete(attributes, "id")
+
+	resource := &jsonAPIResource{
+		Type:       typ,
+		ID:         id,
+		Attributes: attributes,
+	}
+	if self != "" {
+		resource.Links = &jsonAPILinks{Self: self}
+	}
+
+	return resource, nil
+}
+
+// jsonAPIErrors converts the message of an error response into error objects. Each
+// error of a field becomes an error object of its own, pointing at the invalid
+// attribute.
+func jsonAPIErrors(status int, message any) []jsonAPIError {
+	code := strconv.Itoa(status)
+	title := http.StatusText(status)
+
+	switch message := message.(type) {
+	case string:
+		return []jsonAPIError{{Status: code, Title: title, Detail: message}}
+
+	case map[string][]string:
+		fields := make([]string, 0, len(message))
+		for field := range message {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		errs := make([]jsonAPIError, 0, len(fields))
+		for _, field := range fields {
+			// errors about the body as a whole point at the primary data
+			pointer := "/data"
+			if field != "body" {
+				pointer = "/data/attributes/" + jsonPointerReplacer.Replace(field)
+			}
+
+			for _, detail := range message[field] {
+				errs = append(errs, jsonAPIError{
+					Status: code,
+					Title:  "Invalid Attribute",
+					Detail: detail,
+					Source: map[string]string{"pointer": pointer},
+				})
+			}
+		}
+		return errs
+
+	default:
+		// errors with a structured message, such as the results of a failed bulk
+		// request, keep it as their meta
+		return []jsonAPIError{{Status: code, Title: title, Meta: message}}
+	}
+}
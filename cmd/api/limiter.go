@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
+)
+
+// rateLimiter limits requests per client and rate-limit class by counting them in
+// fixed windows held in the kvstore, so that every instance sharing a store also
+// shares the limits. A client may make up to burst requests per window, where the
+// window is the time it takes to accrue burst requests at the configured rate.
+type rateLimiter struct {
+	store kvstore.Store
+	rate  atomic.Pointer[rateLimit]
+}
+
+// rateLimit is the number of requests allowed per window
+type rateLimit struct {
+	limit  int64
+	window time.Duration
+}
+
+func newRateLimiter(store kvstore.Store, rps float64, burst int) *rateLimiter {
+	l := &rateLimiter{store: store}
+	l.setRate(rps, burst)
+	return l
+}
+
+// setRate changes the rate of the limiter. Requests counted at the previous rate
+// are counted again from zero, as the window changes with the rate.
+func (l *rateLimiter) setRate(rps float64, burst int) {
+	window := time.Second
+	if rps > 0 {
+		window = time.Duration(float64(burst) / rps * float64(time.Second))
+	}
+
+	l.rate.Store(&rateLimit{limit: int64(burst), window: window})
+}
+
+// allow reports whether a request from the given client ip in the given rate-limit
+// class may proceed. Every class has its own count per client, so that for example
+// write traffic cannot exhaust a client's read allowance.
+func (l *rateLimiter) allow(ctx context.Context, class, ip string) (bool, error) {
+	rate := l.rate.Load()
+
+	windowStart := time.Now().UnixNano() / int64(rate.window)
+	key := fmt.Sprintf("ratelimit:%s:%s:%d:%d", class, ip, rate.window, windowStart)
+
+	count, err := l.store.Incr(ctx, key, rate.window)
+	if err != nil {
+		return false, err
+	}
+
+	return count <= rate.limit, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
+)
+
+// authFailureWindow is how long failed authentications are counted, from the first
+// of them
+const authFailureWindow = 24 * time.Hour
+
+// The schemes of the credentials whose failed authentications are counted
+const (
+	authSchemeAdminToken = "admin_token"
+	authSchemeAPIKey     = "api_key"
+)
+
+// authLockout returns how long a client is locked out after its nth failed
+// authentication: not at all until -auth-max-failures, then for -auth-lockout,
+// doubling with each further failure up to -auth-max-lockout
+func (app *application) authLockout(failures int64) time.Duration {
+	cfg := app.config.auth
+	if cfg.maxFailures == 0 || failures < int64(cfg.maxFailures) {
+		return 0
+	}
+
+	lockout := cfg.lockout
+	for n := failures - int64(cfg.maxFailures); n > 0 && lockout < cfg.maxLockout; n-- {
+		lockout *= 2
+	}
+	return min(lockout, cfg.maxLockout)
+}
+
+// authSubject returns the kvstore key suffix of the client IP for the given scheme.
+// Failures are only counted per IP: counting them for the admin token as well would
+// let anyone lock out the admin by guessing wrong.
+func authSubject(ip, scheme string) string {
+	return scheme + ":" + ip
+}
+
+// authLockedOut returns how much longer the client IP is locked out from
+// authenticating with the given scheme, or zero if it is not. The credentials of a
+// locked out client are not checked, so that guessing them right during the lockout
+// doesn't tell. The HTTP and gRPC servers share the lockouts.
+func (app *application) authLockedOut(ctx context.Context, ip, scheme string) (time.Duration, error) {
+	if app.config.auth.maxFailures == 0 {
+		return 0, nil
+	}
+
+	subject := authSubject(ip, scheme)
+	value, err := app.kv.Get(ctx, "authlock:"+subject)
+	switch {
+	case errors.Is(err, kvstore.ErrNotFound):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+
+	until, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("authlock:%s: %w", subject, err)
+	}
+	return max(0, time.Until(time.Unix(until, 0))), nil
+}
+
+// authFailed counts a failed authentication of the client IP with the given scheme,
+// and locks it out once it has failed -auth-max-failures times. Each failure and
+// lockout is logged as a security event.
+func (app *application) authFailed(ctx context.Context, ip, scheme string) {
+	if app.config.auth.maxFailures == 0 {
+		return
+	}
+
+	logger := app.loggerFrom(ctx).With("scheme", scheme, "ip", ip)
+	subject := authSubject(ip, scheme)
+
+	failures, err := app.kv.Incr(ctx, "authfail:"+subject, authFailureWindow)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	logger.Warn("authentication failed", "event", "auth.failure", "failures", failures)
+
+	lockout := app.authLockout(failures)
+	if lockout == 0 {
+		return
+	}
+
+	until := time.Now().Add(lockout)
+	err = app.kv.Set(ctx, "authlock:"+subject, []byte(strconv.FormatInt(until.Unix(), 10)), lockout)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	logger.Warn("authentication locked out", "event", "auth.lockout", "failures", failures, "lockout", lockout.String())
+}
+
+// authSucceeded forgets the failed authentications of the client IP with the given
+// scheme. It is only called for credentials which cannot be guessed by whoever holds
+// them, such as the admin token; a valid API key says nothing about the other keys
+// its client may be trying.
+func (app *application) authSucceeded(ctx context.Context, ip, scheme string) {
+	if app.config.auth.maxFailures == 0 {
+		return
+	}
+
+	err := app.kv.Delete(ctx, "authfail:"+authSubject(ip, scheme))
+	if err != nil {
+		app.loggerFrom(ctx).Error(err.Error())
+	}
+}
+
+// The authLockedOutResponse method will be used to send a 429 Too Many Requests
+// status code and JSON response when the client has failed to authenticate too many
+// times, and is locked out for the given duration.
+func (app *application) authLockedOutResponse(w http.ResponseWriter, r *http.Request, lockout time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(lockout.Seconds())+1))
+
+	message := "too many failed authentication attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
@@ -3,18 +3,26 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
+	"net/netip"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/events"
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
+	"github.com/aviagarwal1212/greenlight/internal/reporter"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-const version = "1.0.0"
-
 type config struct {
 	port int
 	env  string
@@ -23,60 +31,386 @@ type config struct {
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  time.Duration
+		// slowQueryThreshold is the duration above which queries are logged
+		slowQueryThreshold time.Duration
+		// replicaDSN is the DSN of a read replica used for movie reads, if not empty
+		replicaDSN string
+		// migrate applies the pending migrations at startup
+		migrate bool
+	}
+	// log configures the logger
+	log struct {
+		level string
+		// format is text or json; defaults to json in production and text otherwise
+		format string
+		// output is the file logs are written to, rotated by size, in addition to
+		// stdout unless stdout is false
+		output     string
+		stdout     bool
+		maxSize    int
+		maxAge     time.Duration
+		maxBackups int
+	}
+	// tls holds the certificate and key the API terminates TLS with; it serves
+	// plain HTTP when they are empty
+	tls struct {
+		cert string
+		key  string
+	}
+	// autocert obtains the certificates of domains from Let's Encrypt instead,
+	// answering HTTP-01 challenges at httpAddr
+	autocert struct {
+		domains  string
+		email    string
+		cache    string
+		httpAddr string
+	}
+	// trustedProxies lists the CIDR ranges of the proxies whose forwarding headers
+	// are believed when resolving client IPs
+	trustedProxies string
+	// tenantDomain is the domain whose subdomains name the tenant of a request, as
+	// in acme.movies.example.com; tenants are only named by API key if it is empty
+	tenantDomain string
+	// maxRequestBody caps the size of request bodies, except for the import files
+	// capped by maxImportBody
+	maxRequestBody int64
+	maxImportBody  int64
+	// concurrency caps the requests handled at once, queuing the excess for at most
+	// queueTimeout before shedding it; maxInFlight 0 disables the cap
+	concurrency struct {
+		maxInFlight  int
+		queueTimeout time.Duration
+	}
+	// v1Deprecation holds the dates, as YYYY-MM-DD, from which the v1 routes
+	// superseded by v2 routes are deprecated and expected to stop working
+	v1Deprecation struct {
+		since  string
+		sunset string
+	}
+	// middlewareProfile selects the middleware stack; defaults to env
+	middlewareProfile string
+	limiter           struct {
+		rps   float64
+		burst int
+	}
+	chaos struct {
+		errorRate  float64
+		maxLatency time.Duration
+	}
+	// admin holds the credentials for routes with the admin permission
+	admin struct {
+		token string
+		// clientCA is the PEM bundle of the CAs whose client certificates admin and
+		// debug requests must also present, if not empty
+		clientCA string
+	}
+	// auth configures the lockout of clients which fail to authenticate
+	auth struct {
+		maxFailures int
+		lockout     time.Duration
+		maxLockout  time.Duration
+	}
+	// kvstore selects the store for shared short-lived state (e.g. rate limit counters)
+	kvstore struct {
+		backend  string
+		redisURL string
+	}
+	// cache configures the response cache of the routes marked as cached
+	cache struct {
+		ttl time.Duration
+	}
+	// movieCache configures the in-process cache of movies read by ID
+	movieCache struct {
+		size int
+		ttl  time.Duration
+	}
+	// statsCacheTTL is how long the catalog statistics are cached
+	statsCacheTTL time.Duration
+	// eventsBuffer is how many change events are kept per channel for resuming streams
+	eventsBuffer int
+	// shadow configures canary reads against a second database
+	shadow struct {
+		dsn        string
+		sampleRate float64
+	}
+	// webhooks configures the delivery of webhook events
+	webhooks struct {
+		maxAttempts int
+	}
+	// runtimeFormat is the format of the runtimes in JSON responses, string, number
+	// or human, unless the request asks for one in its Accept header
+	runtimeFormat string
+	// prettyJSON indents JSON responses, unless the request asks otherwise with
+	// ?pretty=
+	prettyJSON bool
+	// compress configures response compression
+	compress struct {
+		minSize int
+	}
+	// maintenance configures maintenance mode, which can also be toggled at runtime
+	maintenance struct {
+		enabled    bool
+		message    string
+		retryAfter time.Duration
+	}
+	// pprof exposes the profiling endpoints, on the API behind the admin token if
+	// enabled, and without authentication on a loopback listener at addr if set
+	pprof struct {
+		enabled bool
+		addr    string
+	}
+	// grpc configures the gRPC server of the movie service
+	grpc struct {
+		port int
+	}
+	// errorReporter selects the service server errors and panics are reported to
+	errorReporter struct {
+		backend   string
+		sentryDSN string
+	}
+	// docs enables the API explorer at /v1/docs
+	docs bool
+	// debug logs the bodies of requests and responses
+	debug bool
+	// outbox configures the message broker the outbox is published to
+	outbox struct {
+		publisher    string
+		natsURL      string
+		kafkaBrokers string
+		retention    time.Duration
+	}
+	// usage configures the metering of the requests made with API keys
+	usage struct {
+		monthlyQuota int64
 	}
 }
 
 type application struct {
 	config config
 	logger *slog.Logger
-	models data.Models
+	// logLevel is the minimum level of the logger, set from the settings
+	logLevel *slog.LevelVar
+	// settings holds the snapshot of the runtime settings, and settingsMu serializes
+	// their updates
+	settings   atomic.Pointer[settings]
+	settingsMu sync.Mutex
+	models     data.Models
+	// db, dbPool and replica are the database handles behind models, for the
+	// healthcheck; replica is nil when no read replica is configured
+	db       *sqlx.DB
+	dbPool   *pgxpool.Pool
+	replica  *sqlx.DB
+	kv       kvstore.Store
+	reporter reporter.Reporter
+	limiter  *rateLimiter
+	// inFlight is the semaphore of limitConcurrency, with -max-in-flight slots
+	inFlight chan struct{}
+	// trustedProxies holds the parsed -trusted-proxies
+	trustedProxies []netip.Prefix
+	deprecations   *deprecationUsage
+	// shadow holds models backed by the shadow database, or nil when shadow reads are disabled
+	shadow    *data.Models
+	changelog *changelog
+	events    *events.Broker
+	graphql   *graphql.Schema
+	webhooks  *webhookDispatcher
+	outbox    *outboxRelay
+	jobs      *jobTracker
+	usage     *usageMeter
+	wg        sync.WaitGroup
+}
+
+// command is a subcommand of the binary
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
 }
 
+// commands lists the subcommands of the binary
+var commands = []command{
+	{"serve", "Serve the API (the default when no command is given)", runServe},
+	{"migrate", "Manage the database schema with the embedded migrations", runMigrate},
+	{"seed", "Load a dataset of movies into the database", runSeed},
+	{"routes", "Print the route table", runRoutes},
+	{"smoke", "Run the end-to-end smoke test against a live deployment", runSmoke},
+	{"openapi", "Write the OpenAPI specification, for go generate", runOpenAPI},
+	{"version", "Print the version and build information", runVersion},
+}
+
+// main runs the subcommand named by the first argument:
+//
+//	api [command] [flags] [arguments]
+//
+// Without a command, or when the first argument is a flag, it serves the API;
+// -version is a shorthand for the version command.
 func main() {
-	// parse configuration flags
+	name, args := "serve", os.Args[1:]
+	switch {
+	case len(args) > 0 && (args[0] == "-version" || args[0] == "--version"):
+		name = "version"
+	case len(args) > 0 && !strings.HasPrefix(args[0], "-"):
+		name, args = args[0], args[1:]
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			os.Exit(cmd.run(args))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\nusage: api [command] [flags]\n\ncommands:\n", name)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	os.Exit(2)
+}
+
+// parseConfig registers the configuration flags on fs, next to any flags of the
+// command itself, and parses args. Every command which touches the database loads
+// its configuration this way, so that they all accept the same settings.
+//
+// Each setting is taken from the first of these which sets it: the command line
+// flag, the GREENLIGHT_<FLAG> environment variable (e.g. GREENLIGHT_DB_DSN for
+// -db-dsn), the -config file, and the default of the flag. The resulting
+// configuration is validated as a whole.
+func parseConfig(fs *flag.FlagSet, args []string) (config, error) {
 	var cfg config
-	flag.IntVar(&cfg.port, "port", 4000, "API server port")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development | staging | production)")
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgreSQL DSN")
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections ")
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections ")
-	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
-	flag.Parse()
-
-	// setup logger
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-
-	// connect to database
-	db, err := sqlx.Connect("postgres", cfg.db.dsn)
+	configFile := fs.String("config", "", "YAML configuration file (see config.example.yaml)")
+	fs.IntVar(&cfg.port, "port", 4000, "API server port")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development | staging | production)")
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections ")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections (ignored, idle connections are closed after -db-max-idle-time)")
+	fs.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
+	fs.DurationVar(&cfg.db.slowQueryThreshold, "db-slow-query-threshold", 500*time.Millisecond, "Duration above which queries are logged as slow (disabled if 0)")
+	fs.BoolVar(&cfg.db.migrate, "migrate", false, "Apply pending database migrations at startup")
+	fs.StringVar(&cfg.db.replicaDSN, "db-replica-dsn", "", "PostgreSQL DSN of a read replica for movie reads (disabled if empty)")
+	fs.StringVar(&cfg.log.level, "log-level", "info", "Minimum level of the logged records (debug | info | warn | error)")
+	fs.StringVar(&cfg.log.format, "log-format", "", "Log format (text | json); defaults to json in production and text otherwise")
+	fs.StringVar(&cfg.log.output, "log-output", "", "File to write logs to, in addition to stdout (disabled if empty)")
+	fs.BoolVar(&cfg.log.stdout, "log-stdout", true, "Write logs to stdout when -log-output is set")
+	fs.IntVar(&cfg.log.maxSize, "log-max-size", 100, "Size in megabytes at which the log file is rotated")
+	fs.DurationVar(&cfg.log.maxAge, "log-max-age", 7*24*time.Hour, "How long rotated log files are kept, rounded up to days (kept forever if 0)")
+	fs.IntVar(&cfg.log.maxBackups, "log-max-backups", 10, "Number of rotated log files kept (all if 0)")
+	fs.Int64Var(&cfg.maxRequestBody, "max-request-body", 1_048_576, "Maximum size in bytes of a request body")
+	fs.Int64Var(&cfg.maxImportBody, "max-import-body", 5<<20, "Maximum size in bytes of a movie import file")
+	fs.IntVar(&cfg.concurrency.maxInFlight, "max-in-flight", 1000, "Maximum number of requests handled at once, not counting SSE and WebSocket streams (unlimited if 0)")
+	fs.DurationVar(&cfg.concurrency.queueTimeout, "queue-timeout", 100*time.Millisecond, "How long a request waits for one of -max-in-flight before it is shed")
+	fs.StringVar(&cfg.trustedProxies, "trusted-proxies", "", "Comma-separated CIDR ranges of the proxies trusted to set X-Forwarded-For and X-Real-IP")
+	fs.StringVar(&cfg.tenantDomain, "tenant-domain", "", "Domain whose subdomains select the tenant of a request, e.g. movies.example.com (disabled if empty)")
+	fs.StringVar(&cfg.v1Deprecation.since, "v1-deprecation", "", "Date (YYYY-MM-DD) from which the v1 routes superseded by v2 routes are deprecated (not deprecated if empty)")
+	fs.StringVar(&cfg.v1Deprecation.sunset, "v1-sunset", "", "Date (YYYY-MM-DD) after which the deprecated v1 routes are expected to stop working")
+	fs.StringVar(&cfg.middlewareProfile, "middleware-profile", "", "Middleware profile (defaults to the environment)")
+	fs.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	fs.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	fs.Float64Var(&cfg.chaos.errorRate, "chaos-error-rate", 0.01, "Fraction of requests failed by chaos injection (0 to 1)")
+	fs.DurationVar(&cfg.chaos.maxLatency, "chaos-max-latency", 200*time.Millisecond, "Maximum latency added by chaos injection")
+	fs.StringVar(&cfg.admin.token, "admin-token", "", "Bearer token for admin routes (admin routes are disabled if empty)")
+	fs.StringVar(&cfg.admin.clientCA, "admin-client-ca", "", "PEM bundle of the CAs whose client certificates admin and /debug requests must present (disabled if empty)")
+	fs.IntVar(&cfg.auth.maxFailures, "auth-max-failures", 5, "Number of failed authentications after which a client IP is locked out (disabled if 0)")
+	fs.DurationVar(&cfg.auth.lockout, "auth-lockout", 30*time.Second, "How long a client is first locked out for, doubling with each further failed authentication")
+	fs.DurationVar(&cfg.auth.maxLockout, "auth-max-lockout", time.Hour, "Maximum duration of a lockout")
+	fs.StringVar(&cfg.kvstore.backend, "kvstore", "memory", "Key-value store for limiter and cache state (memory | redis)")
+	fs.StringVar(&cfg.kvstore.redisURL, "redis-url", "", "Redis URL, used when -kvstore=redis")
+	fs.DurationVar(&cfg.cache.ttl, "cache-ttl", 0, "How long responses of cached routes are cached (disabled if 0)")
+	fs.IntVar(&cfg.movieCache.size, "movie-cache-size", 0, "Number of movies cached in process by ID (disabled if 0)")
+	fs.DurationVar(&cfg.movieCache.ttl, "movie-cache-ttl", 10*time.Second, "How long movies are cached in process")
+	fs.DurationVar(&cfg.statsCacheTTL, "stats-cache-ttl", 30*time.Second, "How long catalog statistics are cached")
+	fs.IntVar(&cfg.eventsBuffer, "events-buffer", 1000, "Number of change events kept per channel for stream resumption")
+	fs.StringVar(&cfg.shadow.dsn, "shadow-db-dsn", "", "PostgreSQL DSN for shadow reads (disabled if empty)")
+	fs.Float64Var(&cfg.shadow.sampleRate, "shadow-sample-rate", 0.01, "Fraction of reads repeated against the shadow database (0 to 1)")
+	fs.IntVar(&cfg.webhooks.maxAttempts, "webhook-max-attempts", 8, "Maximum number of attempts at a webhook delivery")
+	fs.StringVar(&cfg.runtimeFormat, "runtime-format", "string", "Format of runtimes in JSON responses, unless requested with the runtime parameter of Accept (string | number | human)")
+	fs.BoolVar(&cfg.prettyJSON, "pretty-json", false, "Indent JSON responses, unless requested otherwise with ?pretty=")
+	fs.IntVar(&cfg.compress.minSize, "compress-min-size", 1024, "Minimum size in bytes of a compressed response")
+	fs.BoolVar(&cfg.maintenance.enabled, "maintenance", false, "Start in maintenance mode, answering every route but the healthcheck and admin routes with 503")
+	fs.StringVar(&cfg.maintenance.message, "maintenance-message", "the server is undergoing maintenance, please try again later", "Error message of the responses sent in maintenance mode")
+	fs.DurationVar(&cfg.maintenance.retryAfter, "maintenance-retry-after", 5*time.Minute, "Retry-After sent with the responses in maintenance mode")
+	fs.StringVar(&cfg.tls.cert, "tls-cert", "", "PEM certificate chain to serve HTTPS with (plain HTTP if empty)")
+	fs.StringVar(&cfg.tls.key, "tls-key", "", "PEM private key of -tls-cert")
+	fs.StringVar(&cfg.autocert.domains, "autocert-domains", "", "Comma-separated domains to serve HTTPS for with certificates from Let's Encrypt (disabled if empty)")
+	fs.StringVar(&cfg.autocert.email, "autocert-email", "", "Contact email of the Let's Encrypt account, for expiry notices")
+	fs.StringVar(&cfg.autocert.cache, "autocert-cache", "autocert-cache", "Directory the Let's Encrypt certificates are cached in")
+	fs.StringVar(&cfg.autocert.httpAddr, "autocert-http-addr", ":80", "Address answering the HTTP-01 challenges and redirecting to HTTPS")
+	fs.BoolVar(&cfg.pprof.enabled, "pprof", false, "Serve the pprof profiles at /debug/pprof/ to admin clients")
+	fs.StringVar(&cfg.pprof.addr, "pprof-addr", "", "Loopback address serving the pprof profiles without authentication, e.g. localhost:6060 (disabled if empty)")
+	fs.IntVar(&cfg.grpc.port, "grpc-port", 0, "gRPC server port of the movie service (disabled if 0)")
+	fs.StringVar(&cfg.errorReporter.backend, "error-reporter", "none", "Service server errors and panics are reported to (none | sentry)")
+	fs.StringVar(&cfg.errorReporter.sentryDSN, "sentry-dsn", "", "Sentry DSN, used when -error-reporter=sentry")
+	fs.BoolVar(&cfg.docs, "docs", true, "Serve the API explorer at /v1/docs")
+	fs.BoolVar(&cfg.debug, "debug", false, "Log the bodies of requests and responses, with secrets redacted (not allowed in production)")
+	fs.StringVar(&cfg.outbox.publisher, "outbox-publisher", "none", "Message broker movie events are published to (none | nats | kafka)")
+	fs.StringVar(&cfg.outbox.natsURL, "nats-url", "", "NATS URL, used when -outbox-publisher=nats")
+	fs.StringVar(&cfg.outbox.kafkaBrokers, "kafka-brokers", "", "Comma-separated Kafka broker addresses, used when -outbox-publisher=kafka")
+	fs.DurationVar(&cfg.outbox.retention, "outbox-retention", 24*time.Hour, "How long published outbox messages are kept")
+	fs.Int64Var(&cfg.usage.monthlyQuota, "usage-monthly-quota", 0, "Number of requests each API key may make per calendar month, in UTC (unlimited if 0)")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = applyConfigLayers(fs, *configFile)
 	if err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
-	}
-	db.SetMaxIdleConns(cfg.db.maxIdleConns)
-	db.SetMaxOpenConns(cfg.db.maxOpenConns)
-	db.SetConnMaxIdleTime(cfg.db.maxIdleTime)
-	defer db.Close()
-	logger.Info("database connection pool established")
-
-	// setup application struct
-	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModel(db),
-	}
-
-	// setup http server
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
-	}
-
-	logger.Info("starting server", "addr", srv.Addr, "env", cfg.env)
-	err = srv.ListenAndServe()
-	logger.Error(err.Error())
-	os.Exit(1)
+		fmt.Fprintln(fs.Output(), err)
+		return cfg, err
+	}
+
+	v := validator.New()
+	if validateConfig(v, cfg); !v.Valid() {
+		err = configErrors(v)
+		fmt.Fprintln(fs.Output(), err)
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// newLogger creates the logger of a command with the format and level of the
+// configuration, and returns it with its level, which can be changed while it runs
+func newLogger(cfg config) (*slog.Logger, *slog.LevelVar) {
+	level := new(slog.LevelVar)
+	level.Set(logLevel(cfg.log.level))
+	opts := &slog.HandlerOptions{Level: level}
+
+	format := cfg.log.format
+	if format == "" && cfg.env == "production" {
+		format = "json"
+	}
+
+	out := logOutput(cfg)
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(out, opts)), level
+	}
+	return slog.New(slog.NewTextHandler(out, opts)), level
+}
+
+// logOutput returns the writer logs are written to: stdout, the -log-output file, or
+// both. The file is rotated once it reaches -log-max-size, and rotated files are
+// removed after -log-max-age or once there are more than -log-max-backups of them,
+// so that the logs of a server without a log collector don't fill the disk.
+func logOutput(cfg config) io.Writer {
+	if cfg.log.output == "" {
+		return os.Stdout
+	}
+
+	file := &lumberjack.Logger{
+		Filename:   cfg.log.output,
+		MaxSize:    cfg.log.maxSize,
+		MaxAge:     int((cfg.log.maxAge + 24*time.Hour - 1) / (24 * time.Hour)),
+		MaxBackups: cfg.log.maxBackups,
+	}
+
+	if cfg.log.stdout {
+		return io.MultiWriter(os.Stdout, file)
+	}
+	return file
+}
+
+// logLevel parses the name of a log level, such as "warn", which must be valid
+func logLevel(name string) slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(name))
+	return level
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// mergeMovieHandler folds a duplicate movie into the movie of the URL, and deletes the
+// duplicate. The expected JSON structure for the request body is the ID or UUID of
+// the duplicate:
+//
+//	{"duplicate": "0b7f7a4e-4bb3-4c59-8d6c-6a3f5e3f7a10"}
+//
+// The movie keeps its details, taking the IMDb ID, links and views of the duplicate
+// which it lacks. Requests for the duplicate by its ID or UUID are redirected to the
+// movie afterwards. The response contains the updated movie.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	ref, err := app.readMovieRef(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Duplicate any `json:"duplicate"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the duplicate is named by its UUID, or by its numeric ID as a number or string
+	var duplicateRef movieRef
+	switch value := input.Duplicate.(type) {
+	case string:
+		if validator.Match(value, validator.UUIDRX) {
+			duplicateRef.uuid = strings.ToLower(value)
+		} else if id, err := strconv.ParseInt(value, 10, 64); err == nil && id > 0 {
+			duplicateRef.id = id
+		}
+	case float64:
+		if value >= 1 && value == math.Trunc(value) {
+			duplicateRef.id = int64(value)
+		}
+	}
+
+	v := validator.New()
+
+	v.Check(input.Duplicate != nil, "duplicate", "must be provided")
+	v.Check(input.Duplicate == nil || duplicateRef != (movieRef{}), "duplicate", "must be a movie id or uuid")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	models := app.modelsFor(r).Primary()
+
+	movie, err := getMovie(models, ref)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	duplicate, err := getMovie(models, duplicateRef)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("duplicate", "must be an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if v.Check(duplicate.ID != movie.ID, "duplicate", "must not be the movie itself"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	merged, err := models.Movies.Merge(movie.ID, duplicate.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			// one of the movies was deleted since it was read
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publishMovieEvent(r.Context(), "movie.deleted", movieDeletedEvent{UUID: duplicate.UUID, Version: duplicate.Version})
+	app.publishMovieEvent(r.Context(), "movie.updated", merged)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": merged}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redirectMergedMovie redirects a request for a movie which was not found to the
+// movie it was merged into, if it was merged, with a 301 Moved Permanently response.
+// It reports whether it has sent a response.
+func (app *application) redirectMergedMovie(w http.ResponseWriter, r *http.Request, ref movieRef) bool {
+	movie, err := app.modelsFor(r).Movies.Redirect(ref.id, ref.uuid)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return true
+		}
+		return false
+	}
+
+	// the movie is named the same way as in the request
+	key := strconv.FormatInt(movie.ID, 10)
+	if ref.uuid != "" {
+		key = movie.UUID
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", path.Join(path.Dir(r.URL.Path), key))
+
+	err = app.writeJSON(w, http.StatusMovedPermanently, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+	return true
+}
@@ -1,19 +1,312 @@
 package main
 
 import (
+	"bytes"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"mime"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
 )
 
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
-			if err := recover(); err != nil {
+			if rec := recover(); rec != nil {
+				err := fmt.Errorf("%s", rec)
+				app.logError(r, err)
+				app.reportError(r, err, true)
+
 				w.Header().Set("Connection", "close")
-				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
+				app.errorResponse(w, r, http.StatusInternalServerError, serverErrorMessage)
 			}
 		}()
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requestIDRX matches the request IDs accepted from clients
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestID gives every request an ID, sent back in the X-Request-ID header and
+// attached to the logs about the request by the logger of loggerFrom. An ID sent by
+// the client (or a proxy in front of the API) in the same header is kept if it is
+// well formed.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			b := make([]byte, 16)
+			crand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestID(r, id)
+
+		logger := app.logger.With("request_id", id, "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, app.contextSetLogger(r, logger))
+	})
+}
+
+// withRoute stores the metadata of the matched route in the request context so
+// that later middleware, handlers, and error helpers can refer to it, and adds the
+// route name to the logger of the request.
+func (app *application) withRoute(rt route) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = app.contextSetLogger(r, app.loggerFrom(r.Context()).With("route", rt.name))
+			next.ServeHTTP(w, app.contextSetRoute(r, rt))
+		})
+	}
+}
+
+// timeoutGrace is the time left after a route's timeout to write its response
+const timeoutGrace = 2 * time.Second
+
+// timeout cancels the handler and sends a 503 Service Unavailable response if
+// it does not complete within the timeout of the route.
+//
+// NDJSON requests to the routes which stream them are passed straight through, as
+// http.TimeoutHandler buffers the whole response and cannot flush it. They bound
+// themselves with ndjsonTimeout instead, which the write deadline of the connection
+// is set to, so that a client which stops reading cannot hold the stream open.
+//
+// The read deadline of the connection is extended to d when it is longer than the
+// server's ReadTimeout, so that a large body (e.g. an import file) can be uploaded
+// for as long as the route may run. The write deadline is extended to outlast d
+// when the server's WriteTimeout wouldn't, so that the response, or the 503, can
+// still be sent.
+func (app *application) timeout(rt route) func(http.Handler) http.Handler {
+	d := rt.timeout
+	message := `{"error": "the server took too long to process your request"}`
+
+	return func(next http.Handler) http.Handler {
+		timeoutHandler := http.TimeoutHandler(next, d, message)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+
+			if rt.ndjson && wantsNDJSON(r) {
+				rc.SetWriteDeadline(time.Now().Add(ndjsonTimeout + timeoutGrace))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if d > serverReadTimeout {
+				rc.SetReadDeadline(time.Now().Add(d))
+			}
+			if d+timeoutGrace > serverWriteTimeout {
+				rc.SetWriteDeadline(time.Now().Add(d + timeoutGrace))
+			}
+
+			// the handler's own Content-Type overrides this one when it finishes in time
+			w.Header().Set("Content-Type", "application/json")
+			timeoutHandler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// secureHeaders sets headers which harden API responses when they are rendered
+// or cached by browsers and intermediaries.
+func (app *application) secureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "deny")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit limits each client to the configured requests per second within the
+// rate-limit class of the route, and sends a 429 Too Many Requests response once
+// the client's bucket is empty.
+func (app *application) rateLimit(rt route) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.limiter.allow(r.Context(), rt.rateLimitClass, app.clientIP(r))
+			if err != nil {
+				// fail open, so that an unavailable store doesn't take the API down with it
+				app.logError(r, err)
+				allowed = true
+			}
+
+			if !allowed {
+				app.rateLimitExceededResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// chaos injects random latency and failures into requests, so that clients can
+// be exercised against a misbehaving server during development.
+func (app *application) chaos(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.chaos.maxLatency > 0 {
+			time.Sleep(rand.N(app.config.chaos.maxLatency))
+		}
+
+		if rand.Float64() < app.config.chaos.errorRate {
+			app.serverErrorResponse(w, r, errors.New("chaos: injected failure"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprecatedRoute flags every response of a deprecated route with the headers of
+// the given deprecations entry and records the use.
+func (app *application) deprecatedRoute(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.deprecated(w, r, key)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAdmin only lets requests through that carry the configured admin token as
+// a bearer token. Admin routes are disabled entirely when no token is configured.
+// Client IPs which present a wrong token too many times are locked out; the token
+// itself never is, so that nobody can lock out the admin by guessing wrong.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.admin.token == "" {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		lockout, err := app.authLockedOut(r.Context(), app.clientIP(r), authSchemeAdminToken)
+		if err != nil {
+			// fail open, like the rate limiter
+			app.logError(r, err)
+		}
+		if lockout > 0 {
+			app.authLockedOutResponse(w, r, lockout)
+			return
+		}
+
+		if !app.isAdminToken(token) {
+			app.authFailed(r.Context(), app.clientIP(r), authSchemeAdminToken)
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		app.authSucceeded(r.Context(), app.clientIP(r), authSchemeAdminToken)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdminToken reports whether token is the configured admin token. It compares
+// hashes in constant time, so that neither the token's contents nor its length can
+// be learned from response timings.
+func (app *application) isAdminToken(token string) bool {
+	given := sha256.Sum256([]byte(token))
+	expected := sha256.Sum256([]byte(app.config.admin.token))
+	return subtle.ConstantTimeCompare(given[:], expected[:]) == 1
+}
+
+// requireClientCert only lets requests through that were made with a client
+// certificate verified against -admin-client-ca, when it is set. It guards the admin
+// and debug routes together with requireAdmin.
+func (app *application) requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.admin.clientCA == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			app.clientCertificateRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireJSON rejects a request with a body whose Content-Type is not JSON with a 415
+// Unsupported Media Type response, rather than letting the handler fail to decode
+// it. Parameters such as charset are allowed, as are JSON-based media types such as
+// application/vnd.api+json and application/merge-patch+json.
+func (app *application) requireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// an empty body is reported by the handler
+		if r.ContentLength != 0 {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+				app.unsupportedMediaTypeResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateBody checks the JSON body of a request against the request body schema in
+// the route's openAPIDocs entry before the handler runs, and sends the field-level
+// errors in a 422 Unprocessable Entity response if it does not conform. Bodies which
+// are not valid JSON are passed on, for the handler to report as a bad request.
+func (app *application) validateBody(body schema, shallow bool) func(http.Handler) http.Handler {
+	if shallow {
+		body = maps.Clone(body)
+		delete(body, "items")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			js, err := io.ReadAll(http.MaxBytesReader(w, r.Body, app.config.maxRequestBody))
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+				if errors.As(err, &maxBytesError) {
+					app.badRequestResponse(w, r, bodyTooLarge(w, maxBytesError))
+					return
+				}
+				app.badRequestResponse(w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(js))
+
+			decoder := json.NewDecoder(bytes.NewReader(js))
+			decoder.UseNumber()
+
+			var value any
+			if decoder.Decode(&value) == nil && !decoder.More() {
+				v := validator.New()
+				if validator.ValidateSchema(v, body, openAPISchemas, value, "body"); !v.Valid() {
+					app.failedValidationResponse(w, r, v.Errors)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
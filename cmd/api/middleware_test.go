@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutNDJSON(t *testing.T) {
+	app := &application{}
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+
+	tests := []struct {
+		name   string
+		ndjson bool
+		accept string
+		want   int
+	}{
+		{"json", false, "application/json", http.StatusServiceUnavailable},
+		{"ndjson on a route which doesn't stream", false, ndjsonContentType, http.StatusServiceUnavailable},
+		{"json on a streaming route", true, "application/json", http.StatusServiceUnavailable},
+		{"ndjson on a streaming route", true, ndjsonContentType, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := route{timeout: 10 * time.Millisecond, ndjson: tt.ndjson}
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+
+			app.timeout(rt)(slow).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d; want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
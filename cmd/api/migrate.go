@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/migrate"
+	"github.com/aviagarwal1212/greenlight/migrations"
+)
+
+// migrateTimeout bounds a migration run, which may rebuild indexes of large tables
+const migrateTimeout = 10 * time.Minute
+
+// runMigrate implements "api migrate", which manages the schema of the database with
+// the migrations embedded in the binary. It returns the process exit code.
+//
+//	api migrate [flags] up
+//	api migrate [flags] down [N]
+//	api migrate [flags] version
+//	api migrate [flags] force VERSION
+//
+// It accepts the configuration flags of serve, of which it uses the database ones.
+// down reverts the last N migrations, 1 by default. force records the version of a
+// database repaired by hand after a failed migration, without running any.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		return 2
+	}
+
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: api migrate [flags] up | down [N] | version | force VERSION")
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		return usage()
+	}
+	command, operand := fs.Arg(0), fs.Arg(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	logger, _ := newLogger(cfg)
+	db, pool, err := openDB(cfg, logger, cfg.db.dsn, "db_pool", true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer pool.Close()
+	defer db.Close()
+
+	m, err := migrate.New(db.DB, migrations.FS)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch command {
+	case "up":
+		applied, err := m.Up(ctx)
+		printMigrations("applied", applied)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	case "down":
+		steps := 1
+		if operand != "" {
+			steps, err = strconv.Atoi(operand)
+			if err != nil || steps < 1 {
+				return usage()
+			}
+		}
+
+		reverted, err := m.Down(ctx, steps)
+		printMigrations("reverted", reverted)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	case "version":
+		version, dirty, err := m.Version(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if dirty {
+			fmt.Println(version, "(dirty)")
+		} else {
+			fmt.Println(version)
+		}
+
+	case "force":
+		version, err := strconv.ParseUint(operand, 10, 64)
+		if err != nil {
+			return usage()
+		}
+
+		err = m.Force(ctx, version)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	default:
+		return usage()
+	}
+
+	return 0
+}
+
+// printMigrations lists the migrations applied or reverted by a command
+func printMigrations(verb string, ms []*migrate.Migration) {
+	for _, m := range ms {
+		fmt.Printf("%s %d_%s\n", verb, m.Version, m.Name)
+	}
+}
+
+// migrateUp applies the pending migrations at startup, when -migrate is set. Every
+// instance may do so, as the migrations are applied under a lock.
+func migrateUp(db *sql.DB, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.Up(ctx)
+	for _, migration := range applied {
+		logger.Info("migration applied", "version", migration.Version, "name", migration.Name)
+	}
+	return err
+}
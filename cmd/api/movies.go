@@ -1,14 +1,42 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aviagarwal1212/greenlight/internal/data"
 	"github.com/aviagarwal1212/greenlight/internal/validator"
+	"github.com/go-chi/chi/v5"
 )
 
+// movieInput holds the fields a client provides when creating a movie
+type movieInput struct {
+	Title   string          `json:"title"`
+	IMDbID  string          `json:"imdb_id"`
+	Year    int32           `json:"year"`
+	Runtime data.Runtime    `json:"runtime"`
+	Genres  []string        `json:"genres"`
+	Links   data.MovieLinks `json:"links"`
+}
+
+// movie returns a new movie instance with the data from the input
+func (input movieInput) movie() *data.Movie {
+	return &data.Movie{
+		Title:   input.Title,
+		IMDbID:  input.IMDbID,
+		Year:    input.Year,
+		Runtime: input.Runtime,
+		Genres:  input.Genres,
+		Links:   input.Links,
+	}
+}
+
 // createMovieHandler handles the creation of a new movie.
 // It reads and decodes the JSON request body into an input struct,
 // validates the input data, and if valid, writes the input data back to the response.
@@ -20,20 +48,23 @@ import (
 //
 //	{
 //	  "title": "Movie Title",
+//	  "imdb_id": "tt0111161",
 //	  "year": 2023,
 //	  "runtime": 120,
-//	  "genres": ["genre1", "genre2"]
+//	  "genres": ["genre1", "genre2"],
+//	  "links": {
+//	    "trailer_url": "https://example.com/trailer",
+//	    "homepage": "https://example.com",
+//	    "wiki": "https://en.wikipedia.org/wiki/Movie_Title"
+//	  }
 //	}
 //
+// The imdb_id, the links object and each of its fields are optional.
+//
 // The response will contain the same structure if the input data is valid.
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Define an input struct to hold the expected data from the request body.
-	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
-	}
+	var input movieInput
 
 	// Read and decode the JSON request body into the input struct.
 	err := app.readJSON(w, r, &input)
@@ -43,12 +74,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Create a new movie instance using the data from the input struct.
-	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
-	}
+	movie := input.movie()
 
 	// Initialize a new validator and validate the movie instance.
 	v := validator.New()
@@ -58,15 +84,23 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Insert movie into database
-	err = app.models.Movies.Insert(movie)
+	err = app.modelsFor(r).Movies.Insert(movie)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateIMDbID):
+			v.AddError("imdb_id", "a movie with this IMDb ID already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	app.publishMovieEvent(r.Context(), "movie.created", movie)
+
 	// Include location header to the newly-created movie
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%s", movie.UUID))
 
 	// Write a JSON response with a 201 Status Created code
 	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
@@ -75,7 +109,46 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-// showMovieHandler handles the retrieval of a movie by its ID.
+// getMovie retrieves the movie identified by ref, using the public UUID when one was given
+func getMovie(models data.Models, ref movieRef) (*data.Movie, error) {
+	if ref.uuid != "" {
+		return models.Movies.GetByUUID(ref.uuid)
+	}
+
+	return models.Movies.Get(ref.id)
+}
+
+// moviesChannel is the events channel for changes to the movies of the default
+// tenant; the other tenants have a channel of their own (see tenantChannel)
+const moviesChannel = "movies"
+
+// tenantChannel returns the events channel for changes to the movies of the tenant
+// carried by ctx
+func tenantChannel(ctx context.Context) string {
+	tenantID := data.TenantID(ctx)
+	if tenantID == data.DefaultTenantID {
+		return moviesChannel
+	}
+	return fmt.Sprintf("%s:%d", moviesChannel, tenantID)
+}
+
+// movieDeletedEvent is the payload of movie.deleted events
+type movieDeletedEvent struct {
+	UUID    string `json:"uuid"`
+	Version int32  `json:"version"`
+}
+
+// publishMovieEvent notifies subscribers of the channel of the tenant carried by ctx
+// of a change, and invalidates the response cache
+func (app *application) publishMovieEvent(ctx context.Context, eventType string, payload any) {
+	app.invalidateResponses()
+	if app.webhooks != nil {
+		app.webhooks.watch(data.TenantID(ctx))
+	}
+	app.events.Publish(tenantChannel(ctx), eventType, payload)
+}
+
+// showMovieHandler handles the retrieval of a movie by its ID or UUID.
 // It reads the ID parameter from the request URL, and if the ID is valid,
 // it retrieves the movie instance from the database and writes it back to the response.
 //
@@ -84,19 +157,28 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 // If there is any other error, a server error response is sent.
 // If there is an error writing the JSON response, a server error response is sent.
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
+	ref, err := app.readMovieRef(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
+	if ref.uuid == "" {
+		app.deprecated(w, r, "movies.numeric-id")
+	}
 
-	// Retrieve the movie instance from the database by its ID.
+	// Retrieve the movie instance from the database by its ID or UUID.
 	// If the movie is not found, send a 404 Not Found response.
 	// If there is any other error, send a 500 Internal Server Error response.
-	movie, err := app.models.Movies.Get(id)
+	movie, err := getMovie(app.modelsFor(r), ref)
+	app.shadowRead(r, "movies.show", movie, err, func(m data.Models) (any, error) {
+		return getMovie(m, ref)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			if app.redirectMergedMovie(w, r, ref) {
+				return
+			}
 			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -104,6 +186,8 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	app.recordView(r, movie)
+
 	// Write the movie instance to the response as JSON.
 	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
@@ -111,8 +195,54 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// recordView counts a view of the movie for the trending listing in the background,
+// so that it doesn't delay the response. HEAD requests are not views.
+func (app *application) recordView(r *http.Request, movie *data.Movie) {
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	logger := app.loggerFrom(r.Context())
+	app.background(func() {
+		err := app.models.Views.Record(movie.ID)
+		if err != nil {
+			logger.Error(err.Error(), "movie_id", movie.ID)
+		}
+	})
+}
+
+// showMovieBySlugHandler handles the retrieval of a movie by its slug, e.g.
+// GET /v1/movies/slug/the-breakfast-club.
+//
+// If the movie is not found, a not found response is sent.
+// If there is any other error, a server error response is sent.
+func (app *application) showMovieBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	slug := app.readSlugParam(r)
+
+	movie, err := app.modelsFor(r).Movies.GetBySlug(slug)
+	app.shadowRead(r, "movies.showBySlug", movie, err, func(m data.Models) (any, error) {
+		return m.Movies.GetBySlug(slug)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.recordView(r, movie)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // updateMovieHandler handles the update of an existing movie.
-// It reads the ID parameter from the request URL, retrieves the movie instance from the database,
+// It reads the ID (or UUID) parameter from the request URL, retrieves the movie instance from the database,
 // reads and decodes the JSON request body into an input struct, updates the movie instance with the input data,
 // validates the updated movie instance, and if valid, writes the updated movie instance back to the response.
 //
@@ -129,16 +259,30 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 //	  "title": "Updated Movie Title",
 //	  "year": 2023,
 //	  "runtime": 120,
-//	  "genres": ["genre1", "genre2"]
+//	  "genres": ["genre1", "genre2"],
+//	  "links": {
+//	    "trailer_url": "https://example.com/trailer"
+//	  }
 //	}
+//
+// Every field is optional, including the individual links, so a client can PATCH
+// a single link without resending the others. Setting the imdb_id, the links or a
+// link to null clears it, as does setting the imdb_id or a link to "". The other
+// fields cannot be null.
+//
+// The slug is not changed when the title is edited. Sending "regenerate_slug": true
+// generates a new slug from the (possibly updated) title.
 func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
+	ref, err := app.readMovieRef(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
+	if ref.uuid == "" {
+		app.deprecated(w, r, "movies.numeric-id")
+	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := getMovie(app.modelsFor(r).Primary(), ref)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -151,54 +295,167 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	var input struct {
 		Title   *string       `json:"title"`
+		IMDbID  *string       `json:"imdb_id"`
 		Year    *int32        `json:"year"`
 		Runtime *data.Runtime `json:"runtime"`
 		Genres  []string      `json:"genres"`
+		Links   *struct {
+			TrailerURL *string `json:"trailer_url"`
+			Homepage   *string `json:"homepage"`
+			Wiki       *string `json:"wiki"`
+		} `json:"links"`
+		RegenerateSlug bool `json:"regenerate_slug"`
 	}
 
-	err = app.readJSON(w, r, &input)
+	fields, err := app.readJSONFields(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
+	v := validator.New()
+	if fields.checkNotNull(v, "title", "year", "runtime", "genres", "regenerate_slug"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	if input.Year != nil {
 		movie.Year = *input.Year
 	}
 	if input.Title != nil {
 		movie.Title = *input.Title
 	}
+	if fields.null("imdb_id") {
+		movie.IMDbID = ""
+	}
+	if input.IMDbID != nil {
+		movie.IMDbID = *input.IMDbID
+	}
 	if input.Runtime != nil {
 		movie.Runtime = *input.Runtime
 	}
 	if input.Genres != nil {
 		movie.Genres = input.Genres
 	}
+	if fields.null("links") {
+		movie.Links = data.MovieLinks{}
+	}
+	if input.Links != nil {
+		if fields.null("links.trailer_url") {
+			movie.Links.TrailerURL = ""
+		}
+		if fields.null("links.homepage") {
+			movie.Links.Homepage = ""
+		}
+		if fields.null("links.wiki") {
+			movie.Links.Wiki = ""
+		}
+		if input.Links.TrailerURL != nil {
+			movie.Links.TrailerURL = *input.Links.TrailerURL
+		}
+		if input.Links.Homepage != nil {
+			movie.Links.Homepage = *input.Links.Homepage
+		}
+		if input.Links.Wiki != nil {
+			movie.Links.Wiki = *input.Links.Wiki
+		}
+	}
+	if input.RegenerateSlug {
+		// an empty slug tells the model to generate a new one from the title
+		movie.Slug = ""
+	}
 
-	v := validator.New()
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.modelsFor(r).Movies.Update(movie)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateIMDbID):
+			v.AddError("imdb_id", "a movie with this IMDb ID already exists")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	app.publishMovieEvent(r.Context(), "movie.updated", movie)
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-// deleteMovieHandler handles the deletion of a movie by its ID.
+// upsertMovieByIMDbIDHandler creates or replaces the movie with the IMDb ID given in
+// the URL, which lets importers sync their catalog without first looking up whether
+// each movie exists. The request body has the same structure as for createMovieHandler;
+// an imdb_id in the body is optional but must match the one in the URL.
+//
+// A newly created movie is returned with a 201 Status Created code and a Location
+// header, and a replaced movie with a 200 OK code.
+func (app *application) upsertMovieByIMDbIDHandler(w http.ResponseWriter, r *http.Request) {
+	imdbID := chi.URLParamFromCtx(r.Context(), "imdb_id")
+	if !validator.Match(imdbID, data.IMDbIDRX) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input movieInput
+
+	fields, err := app.readJSONFields(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	// the movie is replaced, so a required field sent as null is an error rather than
+	// a zero value
+	fields.checkNotNull(v, "title", "year", "runtime", "genres")
+	v.Check(input.IMDbID == "" || input.IMDbID == imdbID, "imdb_id", "must match the IMDb ID in the URL")
+
+	input.IMDbID = imdbID
+	movie := input.movie()
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	inserted, err := app.modelsFor(r).Movies.Upsert(movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !inserted {
+		app.publishMovieEvent(r.Context(), "movie.updated", movie)
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publishMovieEvent(r.Context(), "movie.created", movie)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%s", movie.UUID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMovieHandler handles the deletion of a movie by its ID or UUID.
 // It reads the ID parameter from the request URL, and if the ID is valid,
 // it deletes the movie instance from the database and writes a success message back to the response.
 //
@@ -215,13 +472,29 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 //	  "message": "movie deleted successfully"
 //	}
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
+	ref, err := app.readMovieRef(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
+	if ref.uuid == "" {
+		app.deprecated(w, r, "movies.numeric-id")
+	}
 
-	err = app.models.Movies.Delete(id)
+	// the movie is looked up first to resolve a UUID to the internal ID, and so that
+	// the deletion event can carry its UUID and version
+	movie, err := getMovie(app.modelsFor(r).Primary(), ref)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.modelsFor(r).Movies.Delete(movie.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -233,24 +506,432 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	app.publishMovieEvent(r.Context(), "movie.deleted", movieDeletedEvent{UUID: movie.UUID, Version: movie.Version})
+
 	err = app.writeJSON(w, http.StatusNoContent, envelope{"message": "movie deleted successfully"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// listMovieHandler lists movies, optionally filtered by ?title= (full-text search)
+// and ?genres= (comma-separated, all must match), paginated with ?page= and
+// ?page_size= and ordered with ?sort= (id, title, year or runtime, prefixed with "-"
+// for descending order).
+//
+// When ?ids= is given (a comma-separated list of movie IDs or UUIDs), the movies
+// with those IDs are returned instead, as for POST /v1/movies/batch-get.
+//
+// Clients which send "Accept: application/x-ndjson" get the whole listing streamed as
+// newline-delimited JSON instead, one movie per line and without pagination, which
+// makes it suitable for exporting the catalog.
 func (app *application) listMovieHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title    string
-		Genres   []string
-		Page     int
-		PageSize int
-		Sort     string
+		Title  string
+		Genres []string
+		data.Filters
 	}
 
 	v := validator.New()
 
 	qs := r.URL.Query()
+
+	if qs.Has("ids") {
+		keys := app.validateMovieKeys(v, app.readCsv(qs, "ids", []string{}))
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.writeMovieBatch(w, r, keys)
+		return
+	}
+
 	input.Title = app.readString(qs, "title", "")
 	input.Genres = app.readCsv(qs, "genres", []string{})
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if wantsNDJSON(r) {
+		app.streamMovies(w, r, input.Title, input.Genres, input.Filters)
+		return
+	}
+
+	movies, metadata, err := app.modelsFor(r).Movies.GetAll(input.Title, input.Genres, input.Filters)
+	app.shadowRead(r, "movies.list", shadowPage{movies, metadata}, err, func(m data.Models) (any, error) {
+		movies, metadata, err := m.Movies.GetAll(input.Title, input.Genres, input.Filters)
+		return shadowPage{movies, metadata}, err
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// streamMovies writes every movie matching the title and genres as NDJSON, one movie
+// per line, reading them from the database as they are written. The page and
+// page_size of filters are ignored, as the stream holds the whole listing.
+//
+// Errors which occur after the first line has been sent cannot be reported to the
+// client, so they are logged and the stream is cut short.
+func (app *application) streamMovies(w http.ResponseWriter, r *http.Request, title string, genres []string, filters data.Filters) {
+	ctx, cancel := context.WithTimeout(r.Context(), ndjsonTimeout)
+	defer cancel()
+
+	var nw *ndjsonWriter
+
+	var fields []string
+	if ew, ok := w.(*encodingWriter); ok {
+		fields = ew.fields
+	}
+
+	err := app.modelsFor(r).Movies.Each(ctx, title, genres, filters, func(movie *data.Movie) error {
+		if nw == nil {
+			nw = newNDJSONWriter(w)
+		}
+		if fields != nil {
+			return nw.write(selectFields(movie, fields))
+		}
+		return nw.write(movie)
+	})
+
+	switch {
+	case nw == nil && err != nil:
+		app.serverErrorResponse(w, r, err)
+	case nw == nil:
+		// no movies matched, so send an empty stream
+		newNDJSONWriter(w)
+	case err != nil:
+		app.logError(r, err)
+	default:
+		err = nw.flush()
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+}
+
+// batchGetMoviesHandler returns multiple movies in one round trip. The expected JSON
+// structure for the request body is:
+//
+//	{
+//	  "ids": [1, 2, "0b7f7a4e-4bb3-4c59-8d6c-6a3f5e3f7a10"]
+//	}
+//
+// Movies are returned in the order of the request, and IDs without a movie are
+// listed in the not_found metadata.
+func (app *application) batchGetMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []any `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	keys := app.validateMovieKeys(v, app.movieKeysFromJSON(v, input.IDs))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.writeMovieBatch(w, r, keys)
+}
+
+// movieKeysFromJSON converts a decoded JSON array of numeric IDs and UUID strings into
+// strings for validateMovieKeys
+func (app *application) movieKeysFromJSON(v *validator.Validator, values []any) []string {
+	keys := make([]string, 0, len(values))
+
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			keys = append(keys, value)
+		case float64:
+			if value != math.Trunc(value) {
+				v.AddError("ids", "must only contain movie ids or uuids")
+				continue
+			}
+			keys = append(keys, strconv.FormatInt(int64(value), 10))
+		default:
+			v.AddError("ids", "must only contain movie ids or uuids")
+		}
+	}
+
+	return keys
+}
+
+// validateMovieKeys checks a list of movie IDs or UUIDs given by the client and
+// returns them normalized and de-duplicated, in request order
+func (app *application) validateMovieKeys(v *validator.Validator, keys []string) []string {
+	v.Check(validator.MinItems(keys, 1), "ids", "must contain at least 1 id")
+	v.Check(validator.MaxItems(keys, 100), "ids", "must not contain more than 100 ids")
+
+	seen := make(map[string]bool, len(keys))
+	normalized := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if !validator.Match(key, validator.UUIDRX) {
+			id, err := strconv.ParseInt(key, 10, 64)
+			if err != nil || id < 1 {
+				v.AddError("ids", "must only contain movie ids or uuids")
+				continue
+			}
+			key = strconv.FormatInt(id, 10)
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			normalized = append(normalized, key)
+		}
+	}
+
+	return normalized
+}
+
+// writeMovieBatch fetches the movies identified by keys in a single query and sends
+// them in the order of keys, listing the keys without a movie as not_found
+func (app *application) writeMovieBatch(w http.ResponseWriter, r *http.Request, keys []string) {
+	var ids []int64
+	var uuids []string
+
+	for _, key := range keys {
+		if validator.Match(key, validator.UUIDRX) {
+			uuids = append(uuids, key)
+			continue
+		}
+		id, _ := strconv.ParseInt(key, 10, 64)
+		ids = append(ids, id)
+	}
+
+	found, err := app.modelsFor(r).Movies.GetMany(ids, uuids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	byKey := make(map[string]*data.Movie, 2*len(found))
+	for _, movie := range found {
+		byKey[strconv.FormatInt(movie.ID, 10)] = movie
+		byKey[movie.UUID] = movie
+	}
+
+	movies := make([]*data.Movie, 0, len(keys))
+	notFound := []string{}
+
+	for _, key := range keys {
+		movie, ok := byKey[key]
+		if !ok {
+			notFound = append(notFound, key)
+			continue
+		}
+		movies = append(movies, movie)
+	}
+
+	env := envelope{
+		"movies":   movies,
+		"metadata": map[string]any{"not_found": notFound},
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// recentMoviesHandler lists the most recently added movies, newest first.
+// The number of movies can be set with ?limit= (1-100, default 20).
+//
+// Responses may be cached by clients and proxies for a minute.
+func (app *application) recentMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 20, v)
+	v.Check(validator.Between(limit, 1, 100), "limit", "must be between 1 and 100")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, err := app.modelsFor(r).Movies.Recent(limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=60")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// trendingMoviesHandler lists the most viewed movies over a sliding window ending now,
+// together with their view counts. The window can be set with ?window= as a duration
+// between 1h and 720h (default 168h, i.e. one week) and the number of movies with
+// ?limit= (1-100, default 20).
+//
+// Responses may be cached by clients and proxies for five minutes.
+func (app *application) trendingMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	limit := app.readInt(qs, "limit", 20, v)
+	v.Check(validator.Between(limit, 1, 100), "limit", "must be between 1 and 100")
+
+	window, err := time.ParseDuration(app.readString(qs, "window", "168h"))
+	if err != nil {
+		v.AddError("window", "must be a duration such as 24h")
+	}
+	v.Check(validator.Between(window, time.Hour, 720*time.Hour), "window", "must be between 1h and 720h")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, err := app.modelsFor(r).Views.Trending(window, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	env := envelope{
+		"movies":   movies,
+		"metadata": map[string]string{"window": window.String()},
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// similarMoviesHandler lists the movies most similar to the movie identified by the
+// {id} parameter, ranked by genre overlap and release year proximity. The ranking
+// details for each movie are included in the metadata, keyed by movie uuid. The
+// number of movies can be set with ?limit= (1-50, default 10).
+func (app *application) similarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	ref, err := app.readMovieRef(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	if ref.uuid == "" {
+		app.deprecated(w, r, "movies.numeric-id")
+	}
+
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+	v.Check(validator.Between(limit, 1, 50), "limit", "must be between 1 and 50")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := getMovie(app.modelsFor(r), ref)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	similar, err := app.modelsFor(r).Movies.Similar(movie, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	type score struct {
+		Score        float64  `json:"score"`
+		SharedGenres []string `json:"shared_genres"`
+		YearDistance int32    `json:"year_distance"`
+	}
+
+	movies := make([]*data.Movie, 0, len(similar))
+	scores := make(map[string]score, len(similar))
+	for _, s := range similar {
+		movies = append(movies, s.Movie)
+		scores[s.Movie.UUID] = score{
+			Score:        s.Score,
+			SharedGenres: s.SharedGenres,
+			YearDistance: s.YearDistance,
+		}
+	}
+
+	env := envelope{
+		"movies": movies,
+		"metadata": map[string]any{
+			"similar_to": movie.UUID,
+			"scores":     scores,
+		},
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// suggestMoviesHandler returns up to 10 lightweight title suggestions for typeahead
+// UIs, e.g. GET /v1/movies/suggest?q=ala. The number of suggestions can be lowered
+// with ?limit=.
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(app.readString(qs, "q", ""))
+	v.Check(q != "", "q", "must be provided")
+	v.Check(validator.MaxLength(q, 100), "q", "must not be more than 100 bytes long")
+
+	limit := app.readInt(qs, "limit", 10, v)
+	v.Check(validator.Between(limit, 1, 10), "limit", "must be between 1 and 10")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.modelsFor(r).Movies.Suggest(q, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=60")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
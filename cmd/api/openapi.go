@@ -0,0 +1,724 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+//go:generate go run . openapi -o openapi.json
+
+// openAPIData is the OpenAPI 3 specification of the API, generated from the route
+// table and openAPIDocs by go generate. The tests fail if it is out of date.
+//
+//go:embed openapi.json
+var openAPIData []byte
+
+// schema is a JSON Schema, as used by OpenAPI 3.0 and by validateBody
+type schema = validator.Schema
+
+// ref refers to a schema of the components section by name
+func ref(name string) schema {
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+// object is the schema of a JSON object with the given properties
+func object(properties map[string]schema, required ...string) schema {
+	s := schema{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// arrayOf is the schema of a JSON array of items
+func arrayOf(items schema) schema {
+	return schema{"type": "array", "items": items}
+}
+
+// nullable is the schema which also allows null, for the fields which an update
+// clears when they are null
+func nullable(s schema) schema {
+	s = maps.Clone(s)
+	s["nullable"] = true
+	return s
+}
+
+// envelopeOf is the schema of a response object with the given properties, all of
+// which are always present
+func envelopeOf(properties map[string]schema) schema {
+	required := make([]string, 0, len(properties))
+	for name := range properties {
+		required = append(required, name)
+	}
+	slices.Sort(required)
+	return object(properties, required...)
+}
+
+var (
+	stringSchema  = schema{"type": "string"}
+	integerSchema = schema{"type": "integer"}
+	booleanSchema = schema{"type": "boolean"}
+	dateTime      = schema{"type": "string", "format": "date-time"}
+	uriSchema     = schema{"type": "string", "format": "uri", "maxLength": 2048}
+	// linkSchema is an optional URL, which is cleared by an empty string
+	linkSchema = schema{"type": "string", "maxLength": 2048, "description": "An absolute http or https URL, or an empty string if the link is not set"}
+	// imdbIDSchema is an optional IMDb title ID, which is cleared by an empty string
+	imdbIDSchema = schema{"type": "string", "pattern": `^(tt[0-9]{7,10})?$`, "example": "tt0111161"}
+	// movieKey is a numeric movie ID or a movie UUID, which may also be sent as a
+	// string
+	movieKey = schema{"oneOf": []schema{{"type": "integer", "minimum": 1}, {"type": "string"}}}
+	// docsLink is the link of an error response to the documentation of the route
+	docsLink  = schema{"type": "string", "format": "uri", "description": "Link to the documentation of the route in the API explorer, if it is enabled"}
+	movieKeys = schema{"type": "array", "items": movieKey, "minItems": 1, "maxItems": 100}
+)
+
+// openAPISchemas are the schemas shared between operations
+var openAPISchemas = map[string]schema{
+	"Settings": envelopeOf(map[string]schema{
+		"log_level":               stringSchema,
+		"limiter_rps":             schema{"type": "number"},
+		"limiter_burst":           integerSchema,
+		"maintenance":             booleanSchema,
+		"maintenance_message":     stringSchema,
+		"maintenance_retry_after": integerSchema,
+	}),
+	"Runtime": {
+		"oneOf": []schema{
+			{"type": "string", "pattern": `^([0-9]+ mins?|[0-9]+h( ?[0-9]+m)?|[0-9]+m)$`},
+			{"type": "integer"},
+		},
+		"description": "A runtime in minutes, in the format \"<minutes> mins\", as hours and minutes such as \"1h 42m\", or as a number. Responses use the string format unless the server is configured otherwise, or the request asks for a format with the runtime parameter of its Accept header, as in \"application/json; runtime=number\" (or runtime=human for \"1h 42m\")",
+		"example":     "102 mins",
+	},
+	"MovieLinks": object(map[string]schema{
+		"trailer_url": linkSchema,
+		"homepage":    linkSchema,
+		"wiki":        linkSchema,
+	}),
+	"Movie": object(map[string]schema{
+		"uuid":    {"type": "string", "format": "uuid"},
+		"title":   stringSchema,
+		"slug":    stringSchema,
+		"imdb_id": imdbIDSchema,
+		"year":    integerSchema,
+		"runtime": ref("Runtime"),
+		"genres":  arrayOf(stringSchema),
+		"links":   ref("MovieLinks"),
+		"version": integerSchema,
+	}, "uuid", "title", "slug", "links", "version"),
+	"MovieInput": object(map[string]schema{
+		"title":   {"type": "string", "maxLength": 500},
+		"imdb_id": imdbIDSchema,
+		"year":    {"type": "integer", "minimum": 1888},
+		"runtime": ref("Runtime"),
+		"genres":  {"type": "array", "items": stringSchema, "minItems": 1, "maxItems": 5, "uniqueItems": true},
+		"links":   ref("MovieLinks"),
+	}, "title", "year", "runtime", "genres"),
+	"MovieUpdate": object(map[string]schema{
+		"title":   {"type": "string", "maxLength": 500},
+		"imdb_id": nullable(imdbIDSchema),
+		"year":    {"type": "integer", "minimum": 1888},
+		"runtime": ref("Runtime"),
+		"genres":  {"type": "array", "items": stringSchema, "minItems": 1, "maxItems": 5, "uniqueItems": true},
+		"links": nullable(object(map[string]schema{
+			"trailer_url": nullable(linkSchema),
+			"homepage":    nullable(linkSchema),
+			"wiki":        nullable(linkSchema),
+		})),
+		"regenerate_slug": booleanSchema,
+	}),
+	"Metadata": object(map[string]schema{
+		"current_page":  integerSchema,
+		"page_size":     integerSchema,
+		"first_page":    integerSchema,
+		"last_page":     integerSchema,
+		"total_records": integerSchema,
+	}),
+	"Webhook": object(map[string]schema{
+		"id":          integerSchema,
+		"created_at":  dateTime,
+		"url":         uriSchema,
+		"event_types": arrayOf(stringSchema),
+		"version":     integerSchema,
+	}, "id", "created_at", "url", "event_types", "version"),
+	"Tenant": object(map[string]schema{
+		"id":         integerSchema,
+		"created_at": dateTime,
+		"name":       stringSchema,
+		"slug":       stringSchema,
+	}, "id", "created_at", "name", "slug"),
+	"WebhookDelivery": object(map[string]schema{
+		"id":              integerSchema,
+		"webhook_id":      integerSchema,
+		"event_id":        stringSchema,
+		"event_type":      stringSchema,
+		"payload":         {"type": "object"},
+		"status":          {"type": "string", "enum": []string{"pending", "succeeded", "failed"}},
+		"attempts":        integerSchema,
+		"response_code":   {"type": "integer", "nullable": true},
+		"last_error":      stringSchema,
+		"next_attempt_at": dateTime,
+		"created_at":      dateTime,
+		"updated_at":      dateTime,
+	}, "id", "webhook_id", "event_id", "event_type", "payload", "status", "attempts", "response_code", "next_attempt_at", "created_at", "updated_at"),
+	"FieldErrors": {
+		"type":                 "object",
+		"description":          "Error messages keyed by the name of the invalid field, with every failed rule of the field",
+		"additionalProperties": arrayOf(stringSchema),
+	},
+	"Error": object(map[string]schema{
+		"error": stringSchema,
+		"docs":  docsLink,
+	}, "error"),
+	"ValidationError": object(map[string]schema{
+		"error": ref("FieldErrors"),
+		"docs":  docsLink,
+	}, "error"),
+}
+
+// openAPIParam is a query parameter of an operation
+type openAPIParam struct {
+	name        string
+	description string
+	schema      schema
+}
+
+// openAPIDoc documents a route of the route table. Path parameters are taken from
+// the route pattern, and the error responses from the other fields.
+type openAPIDoc struct {
+	summary string
+	query   []openAPIParam
+	// body is the schema of the JSON request body, if the route reads one. Bodies
+	// are checked against it by validateBody before the handler runs.
+	body schema
+	// shallowBody limits validateBody to the top level of an array body, for
+	// handlers which report invalid items themselves
+	shallowBody bool
+	// bodyTypes lists the media types of a non-JSON request body
+	bodyTypes []string
+	// status is the status code of a successful response
+	status int
+	// response is the schema of the successful JSON response, if there is one
+	response schema
+	// responseType is the media type of a non-JSON successful response
+	responseType string
+	// streamType is the media type in which the JSON response can be streamed
+	// instead, if the Accept header asks for it
+	streamType string
+}
+
+var (
+	pageParams = []openAPIParam{
+		{"page", "Page number, from 1", schema{"type": "integer", "minimum": 1, "default": 1}},
+		{"page_size", "Number of results per page", schema{"type": "integer", "minimum": 1, "maximum": 100, "default": 20}},
+	}
+	// fieldsParam is accepted by every route, and documented for the GET routes
+	fieldsParam = openAPIParam{"fields", "Comma-separated fields to return for each resource (the id, or the uuid of a movie, is always returned)", stringSchema}
+	// prettyParam is accepted by every route, and documented for the routes with a
+	// response body
+	prettyParam = openAPIParam{"pretty", "Indent the JSON of the response (true or false, defaulting to the configuration of the server)", booleanSchema}
+	limitParam  = openAPIParam{"limit", "Maximum number of results", schema{"type": "integer", "minimum": 1, "default": 20}}
+	movieEnv    = envelopeOf(map[string]schema{"movie": ref("Movie")})
+	moviesEnv   = envelopeOf(map[string]schema{"movies": arrayOf(ref("Movie"))})
+	messageEnv  = envelopeOf(map[string]schema{"message": stringSchema})
+	webhookEnv  = envelopeOf(map[string]schema{"webhook": ref("Webhook")})
+	settingsEnv = envelopeOf(map[string]schema{"settings": ref("Settings")})
+	anyObject   = schema{"type": "object"}
+)
+
+// openAPIDocs documents every route of the route table, by route name
+var openAPIDocs = map[string]openAPIDoc{
+	"healthcheck": {
+		summary: "Report the status of the server, its dependencies and background jobs (503 when unavailable)",
+		response: envelopeOf(map[string]schema{
+			"status":      {"type": "string", "enum": []string{"available", "degraded", "unavailable"}},
+			"system_info": {"type": "object", "additionalProperties": stringSchema},
+			"checks": {"type": "object", "additionalProperties": schema{
+				"type": "object",
+				"properties": map[string]schema{
+					"status":     {"type": "string", "enum": []string{"ok", "degraded", "down"}},
+					"latency_ms": integerSchema,
+					"error":      stringSchema,
+					"details":    anyObject,
+				},
+				"required": []string{"status"},
+			}},
+		}),
+	},
+	"changelog": {
+		summary: "List the changes to the API, newest first",
+		query: []openAPIParam{
+			{"area", "Only list changes to this area", schema{"type": "string", "enum": changelogAreas}},
+			{"since", "Only list changes made on or after this date", schema{"type": "string", "format": "date"}},
+		},
+		response: anyObject,
+	},
+	"openapi": {
+		summary:  "Get this OpenAPI specification",
+		response: anyObject,
+	},
+	"docs": {
+		summary:      "Get the interactive API explorer",
+		responseType: "text/html",
+	},
+	"docs.asset": {
+		summary:      "Get a script, stylesheet or image of the API explorer",
+		responseType: "application/octet-stream",
+	},
+	"settings.show": {
+		summary:  "Get the runtime settings",
+		response: settingsEnv,
+	},
+	"settings.update": {
+		summary: "Change some of the runtime settings without a restart",
+		body: object(map[string]schema{
+			"log_level":               schema{"type": "string", "enum": []string{"debug", "info", "warn", "error"}},
+			"limiter_rps":             schema{"type": "number"},
+			"limiter_burst":           schema{"type": "integer", "minimum": 1},
+			"maintenance":             booleanSchema,
+			"maintenance_message":     schema{"type": "string", "minLength": 1},
+			"maintenance_retry_after": schema{"type": "integer", "minimum": 1},
+		}),
+		response: settingsEnv,
+	},
+	"deprecations.list": {
+		summary:  "List the usage of deprecated routes",
+		response: anyObject,
+	},
+	"events.stream": {
+		summary:      "Stream movie change events as Server-Sent Events",
+		query:        []openAPIParam{{"last_event_id", "ID of the last event received, to resume the stream", stringSchema}},
+		responseType: "text/event-stream",
+	},
+	"feeds.movies": {
+		summary:      "Get an Atom feed of recently added movies",
+		query:        []openAPIParam{limitParam},
+		responseType: "application/atom+xml",
+	},
+	"graphql": {
+		summary: "Run a GraphQL query or mutation",
+		body: object(map[string]schema{
+			"query":         stringSchema,
+			"operationName": stringSchema,
+			"variables":     anyObject,
+		}, "query"),
+		response: anyObject,
+	},
+	"movies.list": {
+		summary: "List movies",
+		query: append([]openAPIParam{
+			{"ids", "Comma-separated movie IDs or UUIDs to fetch, instead of filtering", stringSchema},
+			{"title", "Full-text search on the title", stringSchema},
+			{"genres", "Comma-separated genres, all of which must match", stringSchema},
+			{"sort", "Sort field, prefixed with - for descending order", schema{"type": "string", "enum": []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}, "default": "id"}},
+		}, pageParams...),
+		response:   envelopeOf(map[string]schema{"movies": arrayOf(ref("Movie")), "metadata": ref("Metadata")}),
+		streamType: ndjsonContentType,
+	},
+	"movies.batchGet": {
+		summary:  "Get many movies by ID or UUID",
+		body:     object(map[string]schema{"ids": movieKeys}, "ids"),
+		response: envelopeOf(map[string]schema{"movies": arrayOf(ref("Movie")), "metadata": anyObject}),
+	},
+	"movies.create": {
+		summary:  "Create a movie",
+		body:     ref("MovieInput"),
+		status:   http.StatusCreated,
+		response: movieEnv,
+	},
+	"movies.bulkCreate": {
+		summary: "Create many movies",
+		query: []openAPIParam{
+			{"mode", "Whether to create only if all movies are valid, or every valid movie", schema{"type": "string", "enum": []string{"atomic", "best_effort"}, "default": "atomic"}},
+		},
+		body:        schema{"type": "array", "items": ref("MovieInput"), "minItems": 1, "maxItems": maxBulkItems},
+		shallowBody: true,
+		status:      http.StatusCreated,
+		response:    envelopeOf(map[string]schema{"results": arrayOf(anyObject)}),
+	},
+	"movies.importFile": {
+		summary: "Create movies from a CSV or JSON-lines file",
+		query: []openAPIParam{
+			{"format", "Format of the file, if not set by the Content-Type", schema{"type": "string", "enum": []string{"csv", "jsonl"}}},
+			{"dry_run", "Report the outcome without creating any movie", schema{"type": "boolean", "default": false}},
+		},
+		bodyTypes: []string{"text/csv", "application/x-ndjson"},
+		response:  envelopeOf(map[string]schema{"summary": anyObject, "results": arrayOf(anyObject)}),
+	},
+	"movies.upsertByIMDb": {
+		summary:  "Create or replace the movie with an IMDb ID",
+		body:     ref("MovieInput"),
+		response: movieEnv,
+	},
+	"movies.recent": {
+		summary:  "List the most recently added movies",
+		query:    []openAPIParam{limitParam},
+		response: moviesEnv,
+	},
+	"movies.trending": {
+		summary: "List the most viewed movies of a recent window",
+		query: []openAPIParam{
+			limitParam,
+			{"window", "Duration of the window, e.g. 24h", schema{"type": "string", "default": "168h"}},
+		},
+		response: envelopeOf(map[string]schema{"movies": arrayOf(ref("Movie")), "metadata": anyObject}),
+	},
+	"movies.suggest": {
+		summary: "Suggest movie titles for a search prefix",
+		query: []openAPIParam{
+			{"q", "Search prefix", stringSchema},
+			{"limit", "Maximum number of suggestions", schema{"type": "integer", "minimum": 1, "default": 10}},
+		},
+		response: envelopeOf(map[string]schema{"suggestions": arrayOf(anyObject)}),
+	},
+	"movies.watch": {
+		summary: "Stream movie change events over a WebSocket",
+		query:   []openAPIParam{{"last_event_id", "ID of the last event received, to resume the stream", stringSchema}},
+		status:  http.StatusSwitchingProtocols,
+	},
+	"movies.stats": {
+		summary:  "Get statistics about the catalog",
+		response: envelopeOf(map[string]schema{"stats": anyObject}),
+	},
+	"movies.bulkDelete": {
+		summary: "Delete many movies by ID or by filter",
+		body: object(map[string]schema{
+			"ids": movieKeys,
+			"filter": object(map[string]schema{
+				"title":       stringSchema,
+				"genres":      arrayOf(stringSchema),
+				"year_before": integerSchema,
+				"year_after":  integerSchema,
+			}),
+			"max": schema{"type": "integer", "minimum": 1, "maximum": 100000, "default": 1000},
+		}),
+		response: envelopeOf(map[string]schema{"deleted": integerSchema}),
+	},
+	"usage.show": {
+		summary: "Get the usage of the tenant of the API key in the current month",
+		response: envelopeOf(map[string]schema{"usage": object(map[string]schema{
+			"month":     {"type": "string", "example": "2026-10"},
+			"requests":  integerSchema,
+			"quota":     integerSchema,
+			"remaining": integerSchema,
+			"resets_at": dateTime,
+			"days": arrayOf(object(map[string]schema{
+				"day":      {"type": "string", "format": "date"},
+				"requests": integerSchema,
+			}, "day", "requests")),
+		}, "month", "requests", "resets_at", "days")}),
+	},
+	"movies.merge": {
+		summary:  "Merge a duplicate movie into a movie",
+		body:     object(map[string]schema{"duplicate": movieKey}, "duplicate"),
+		response: movieEnv,
+	},
+	"movies.show": {
+		summary:  "Get a movie by ID or UUID, or redirect from a movie merged into another with 301 Moved Permanently",
+		response: movieEnv,
+	},
+	"movies.showBySlug": {
+		summary:  "Get a movie by slug",
+		response: movieEnv,
+	},
+	"movies.similar": {
+		summary:  "List the movies most similar to a movie",
+		query:    []openAPIParam{{"limit", "Maximum number of results", schema{"type": "integer", "minimum": 1, "default": 10}}},
+		response: envelopeOf(map[string]schema{"movies": arrayOf(ref("Movie")), "metadata": anyObject}),
+	},
+	"movies.update": {
+		summary:  "Update some fields of a movie",
+		body:     ref("MovieUpdate"),
+		response: movieEnv,
+	},
+	"movies.delete": {
+		summary: "Delete a movie",
+		status:  http.StatusNoContent,
+	},
+	"tenants.list": {
+		summary:  "List the tenants",
+		response: envelopeOf(map[string]schema{"tenants": arrayOf(ref("Tenant"))}),
+	},
+	"tenants.create": {
+		summary: "Add a tenant with a catalog of its own",
+		body: object(map[string]schema{
+			"name": schema{"type": "string", "maxLength": 200},
+			"slug": schema{"type": "string", "pattern": `^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`, "example": "acme"},
+		}, "name", "slug"),
+		status:   http.StatusCreated,
+		response: envelopeOf(map[string]schema{"tenant": ref("Tenant"), "api_key": stringSchema}),
+	},
+	"webhooks.list": {
+		summary:  "List webhooks",
+		response: envelopeOf(map[string]schema{"webhooks": arrayOf(ref("Webhook"))}),
+	},
+	"webhooks.create": {
+		summary: "Subscribe a URL to movie events",
+		body: object(map[string]schema{
+			"url":         uriSchema,
+			"event_types": arrayOf(stringSchema),
+			"secret":      schema{"type": "string", "minLength": 16},
+		}, "url", "event_types"),
+		status:   http.StatusCreated,
+		response: envelopeOf(map[string]schema{"webhook": ref("Webhook"), "secret": stringSchema}),
+	},
+	"webhooks.show": {
+		summary:  "Get a webhook",
+		response: webhookEnv,
+	},
+	"webhooks.update": {
+		summary: "Update some fields of a webhook",
+		body: object(map[string]schema{
+			"url":         uriSchema,
+			"event_types": arrayOf(stringSchema),
+		}),
+		response: webhookEnv,
+	},
+	"webhooks.delete": {
+		summary:  "Delete a webhook",
+		response: messageEnv,
+	},
+	"webhooks.deliveries": {
+		summary: "List the deliveries of a webhook",
+		query: append([]openAPIParam{
+			{"status", "Only list deliveries with this status", schema{"type": "string", "enum": []string{"pending", "succeeded", "failed"}}},
+		}, pageParams...),
+		response: envelopeOf(map[string]schema{"deliveries": arrayOf(ref("WebhookDelivery")), "metadata": ref("Metadata")}),
+	},
+	"webhooks.redeliver": {
+		summary:  "Attempt a delivery again",
+		status:   http.StatusAccepted,
+		response: envelopeOf(map[string]schema{"delivery": ref("WebhookDelivery")}),
+	},
+}
+
+// pathParamRX matches the parameters of a route pattern, such as {id}
+var pathParamRX = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// errorResponses are the error responses an operation may return, by status code
+var errorResponses = map[int]string{
+	http.StatusBadRequest:           "The request is malformed",
+	http.StatusUnauthorized:         "The authentication token is missing or invalid",
+	http.StatusForbidden:            "The client lacks the permission to call the route",
+	http.StatusNotFound:             "The resource does not exist",
+	http.StatusConflict:             "The resource was changed by another request",
+	http.StatusUnsupportedMediaType: "The request body is not JSON",
+	http.StatusUnprocessableEntity:  "The request failed validation",
+	http.StatusTooManyRequests:      "The rate limit or quota was exceeded, or the client is locked out after failing to authenticate",
+	http.StatusInternalServerError:  "The server could not process the request",
+}
+
+// openAPISpec generates the OpenAPI specification from the route table and
+// openAPIDocs, as indented JSON. It fails if a route is not documented, or a
+// documented route does not exist.
+func openAPISpec() ([]byte, error) {
+	paths := make(map[string]map[string]any)
+	documented := make(map[string]bool)
+
+	// the handlers of the route table are never called, so it can be built from an
+	// empty application
+	app := &application{}
+
+	for _, rt := range app.routeTable() {
+		doc, ok := openAPIDocs[rt.name]
+		if !ok {
+			return nil, fmt.Errorf("openapi: route %q is not documented", rt.name)
+		}
+		documented[rt.name] = true
+
+		if paths[rt.pattern] == nil {
+			paths[rt.pattern] = make(map[string]any)
+		}
+		op := openAPIOperation(rt, doc)
+		paths[rt.pattern][strings.ToLower(rt.method)] = op
+		if rt.answersHead() {
+			paths[rt.pattern]["head"] = openAPIHeadOperation(op)
+		}
+	}
+
+	for name := range openAPIDocs {
+		if !documented[name] {
+			return nil, fmt.Errorf("openapi: documented route %q does not exist", name)
+		}
+	}
+
+	spec := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Greenlight API",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": openAPISchemas,
+			"securitySchemes": map[string]any{
+				"adminToken": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+
+	js, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(js, '\n'), nil
+}
+
+// openAPIOperation builds the operation object of a route
+func openAPIOperation(rt route, doc openAPIDoc) map[string]any {
+	op := map[string]any{
+		"operationId": rt.name,
+		"summary":     doc.summary,
+	}
+
+	errorCodes := []int{http.StatusTooManyRequests, http.StatusInternalServerError}
+
+	var params []map[string]any
+	for _, match := range pathParamRX.FindAllStringSubmatch(rt.pattern, -1) {
+		params = append(params, map[string]any{"name": match[1], "in": "path", "required": true, "schema": stringSchema})
+	}
+	if len(params) > 0 {
+		errorCodes = append(errorCodes, http.StatusNotFound)
+	}
+	query := doc.query
+	if rt.method == http.MethodGet && doc.response != nil {
+		query = append(slices.Clip(query), fieldsParam)
+	}
+	if doc.response != nil {
+		query = append(slices.Clip(query), prettyParam)
+	}
+	for _, param := range query {
+		params = append(params, map[string]any{"name": param.name, "in": "query", "description": param.description, "schema": param.schema})
+	}
+	if len(query) > 0 {
+		errorCodes = append(errorCodes, http.StatusUnprocessableEntity)
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+
+	switch {
+	case doc.body != nil:
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": doc.body}},
+		}
+		errorCodes = append(errorCodes, http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity)
+	case doc.bodyTypes != nil:
+		content := make(map[string]any)
+		for _, mediaType := range doc.bodyTypes {
+			content[mediaType] = map[string]any{"schema": stringSchema}
+		}
+		op["requestBody"] = map[string]any{"required": true, "content": content}
+		errorCodes = append(errorCodes, http.StatusBadRequest, http.StatusUnprocessableEntity)
+	}
+
+	if doc.response != nil || doc.responseType != "" {
+		errorCodes = append(errorCodes, http.StatusNotAcceptable)
+	}
+
+	if rt.method == http.MethodPatch {
+		errorCodes = append(errorCodes, http.StatusConflict)
+	}
+
+	if rt.permission == adminPermission {
+		op["security"] = []map[string][]string{{"adminToken": {}}}
+		errorCodes = append(errorCodes, http.StatusUnauthorized, http.StatusForbidden)
+	}
+
+	status := doc.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	success := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case doc.response != nil:
+		content := map[string]any{"application/json": map[string]any{"schema": doc.response}}
+		if doc.streamType != "" {
+			content[doc.streamType] = map[string]any{"schema": stringSchema}
+		}
+		success["content"] = content
+	case doc.responseType != "":
+		success["content"] = map[string]any{doc.responseType: map[string]any{"schema": stringSchema}}
+	}
+
+	responses := map[string]any{strconv.Itoa(status): success}
+	for _, code := range errorCodes {
+		errorSchema := ref("Error")
+		if code == http.StatusUnprocessableEntity {
+			errorSchema = ref("ValidationError")
+		}
+		responses[strconv.Itoa(code)] = map[string]any{
+			"description": errorResponses[code],
+			"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+		}
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+// openAPIHeadOperation builds the HEAD operation of a GET route from its GET
+// operation: the responses are the same, without their bodies
+func openAPIHeadOperation(get map[string]any) map[string]any {
+	op := maps.Clone(get)
+	op["operationId"] = get["operationId"].(string) + ".head"
+	op["summary"] = get["summary"].(string) + " (headers only)"
+
+	responses := make(map[string]any)
+	for code, response := range get["responses"].(map[string]any) {
+		responses[code] = map[string]any{"description": response.(map[string]any)["description"]}
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+// openAPIHandler serves the OpenAPI specification of the API
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(openAPIData)
+}
+
+// runOpenAPI implements "api openapi", which writes the generated specification to
+// a file or stdout. It returns the process exit code.
+func runOpenAPI(args []string) int {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	output := fs.String("o", "", "File to write the specification to (defaults to stdout)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	spec, err := openAPISpec()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *output == "" {
+		os.Stdout.Write(spec)
+		return 0
+	}
+
+	err = os.WriteFile(*output, spec, 0o644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
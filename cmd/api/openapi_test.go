@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	legacyrouter "github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// TestOpenAPIUpToDate checks that the embedded openapi.json is the specification
+// generated from the route table and openAPIDocs, so that forgetting to run go
+// generate fails CI rather than misleading clients
+func TestOpenAPIUpToDate(t *testing.T) {
+	spec, err := openAPISpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(spec, openAPIData) {
+		t.Fatal("openapi.json is out of date, run go generate ./cmd/api")
+	}
+}
+
+// TestOpenAPIRoutes checks that every v1 route is documented in openapi.json under
+// its path and method
+func TestOpenAPIRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	err := json.Unmarshal(openAPIData, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{}
+	for _, rt := range app.v1Routes() {
+		t.Run(rt.name, func(t *testing.T) {
+			operations, ok := spec.Paths[rt.pattern]
+			if !ok {
+				t.Fatalf("path %s is missing", rt.pattern)
+			}
+			if _, ok := operations[strings.ToLower(rt.method)]; !ok {
+				t.Fatalf("operation %s %s is missing", rt.method, rt.pattern)
+			}
+		})
+	}
+}
+
+// TestOpenAPIResponses serves requests which don't need the database through the
+// router, and checks that the status code, headers and body of each response are
+// documented in openapi.json for its operation
+func TestOpenAPIResponses(t *testing.T) {
+	ctx := context.Background()
+
+	doc, err := openapi3.NewLoader().LoadFromData(openAPIData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = doc.Validate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := legacyrouter.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changelog, err := loadChangelog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg config
+	cfg.admin.token = "secret"
+	cfg.maxRequestBody = 1_048_576
+	app := &application{
+		config:       cfg,
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		logLevel:     new(slog.LevelVar),
+		kv:           kvstore.NewMemory(),
+		deprecations: newDeprecationUsage(),
+		changelog:    changelog,
+	}
+	app.limiter = newRateLimiter(app.kv, cfg.limiter.rps, cfg.limiter.burst)
+	app.storeSettings(initialSettings(cfg))
+	handler := app.routes()
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		headers map[string]string
+		body    string
+		want    int
+	}{
+		{"changelog", http.MethodGet, "/v1/changelog", nil, "", http.StatusOK},
+		{"changelog filtered", http.MethodGet, "/v1/changelog?area=endpoints&since=2024-01-01", nil, "", http.StatusOK},
+		{"changelog invalid area", http.MethodGet, "/v1/changelog?area=nope", nil, "", http.StatusUnprocessableEntity},
+		{"openapi", http.MethodGet, "/v1/openapi.json", nil, "", http.StatusOK},
+		{"deprecations", http.MethodGet, "/v1/deprecations", map[string]string{"Authorization": "Bearer secret"}, "", http.StatusOK},
+		{"deprecations without token", http.MethodGet, "/v1/deprecations", nil, "", http.StatusUnauthorized},
+		{"deprecations with wrong token", http.MethodGet, "/v1/deprecations", map[string]string{"Authorization": "Bearer wrong"}, "", http.StatusUnauthorized},
+		{"movies invalid page", http.MethodGet, "/v1/movies?page=0", nil, "", http.StatusUnprocessableEntity},
+		{"movies not acceptable", http.MethodGet, "/v1/movies", map[string]string{"Accept": "text/html"}, "", http.StatusNotAcceptable},
+		{"movie create not json", http.MethodPost, "/v1/movies", map[string]string{"Content-Type": "text/plain"}, "title", http.StatusUnsupportedMediaType},
+		{"movie create invalid body", http.MethodPost, "/v1/movies", map[string]string{"Content-Type": "application/json"}, `{"title": 1}`, http.StatusUnprocessableEntity},
+		{"movie create malformed body", http.MethodPost, "/v1/movies", map[string]string{"Content-Type": "application/json"}, `{"title"`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("got status %d; want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{
+					Request:    r,
+					PathParams: pathParams,
+					Route:      route,
+				},
+				Status: w.Code,
+				Header: w.Header(),
+				Body:   io.NopCloser(w.Body),
+				Options: &openapi3filter.Options{
+					IncludeResponseStatus: true,
+				},
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
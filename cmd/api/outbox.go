@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/publisher"
+)
+
+const (
+	// outboxBatchSize is the number of messages published at once
+	outboxBatchSize = 100
+	// outboxPollInterval is how often the relay looks for new messages when the
+	// outbox is empty
+	outboxPollInterval = time.Second
+	// outboxPublishTimeout caps how long the broker may take to accept a batch
+	outboxPublishTimeout = 10 * time.Second
+	// outboxPurgeInterval is how often published messages are purged
+	outboxPurgeInterval = time.Hour
+)
+
+// openPublisher returns the publisher for the configured message broker
+func openPublisher(cfg config) (publisher.Publisher, error) {
+	switch cfg.outbox.publisher {
+	case "none":
+		return publisher.Discard{}, nil
+	case "nats":
+		return publisher.NewNATS(cfg.outbox.natsURL)
+	case "kafka":
+		if cfg.outbox.kafkaBrokers == "" {
+			return nil, errors.New("-kafka-brokers must be set when -outbox-publisher=kafka")
+		}
+		return publisher.NewKafka(strings.Split(cfg.outbox.kafkaBrokers, ",")), nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher %q", cfg.outbox.publisher)
+	}
+}
+
+// outboxRelay publishes the messages of the outbox to the message broker. The
+// messages are written in the same transaction as the changes they describe, so an
+// event is published if and only if its change was committed, even if the broker
+// or the application is down at the time. A message is marked as published once
+// the broker acknowledges it, and is published again otherwise, so every message is
+// published at least once and consumers drop duplicates by message ID.
+type outboxRelay struct {
+	app       *application
+	publisher publisher.Publisher
+}
+
+func newOutboxRelay(app *application, p publisher.Publisher) *outboxRelay {
+	return &outboxRelay{app: app, publisher: p}
+}
+
+// start runs the relay in the background until the process exits
+func (r *outboxRelay) start() {
+	r.app.jobs.register("outbox.relay", outboxPollInterval)
+	r.app.jobs.register("outbox.purge", outboxPurgeInterval)
+	go r.run()
+	go r.purge()
+}
+
+// run publishes the outbox in batches of up to outboxBatchSize messages, polling
+// for new messages once it is empty
+func (r *outboxRelay) run() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.relay()
+		if err != nil {
+			r.app.logger.Error("outbox relay failed", "error", err.Error())
+			r.app.jobs.failed("outbox.relay", err)
+		} else {
+			r.app.jobs.succeeded("outbox.relay")
+		}
+
+		// keep going while there is a backlog
+		if err == nil && n == outboxBatchSize {
+			continue
+		}
+
+		<-ticker.C
+	}
+}
+
+// relay publishes one batch of messages and returns how many there were
+func (r *outboxRelay) relay() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxPublishTimeout)
+	defer cancel()
+
+	return r.app.models.Outbox.Relay(ctx, outboxBatchSize, func(messages []*data.OutboxMessage) error {
+		batch := make([]publisher.Message, len(messages))
+		for i, message := range messages {
+			tenant := strconv.FormatInt(message.TenantID, 10)
+			batch[i] = publisher.Message{
+				ID:    strconv.FormatInt(message.ID, 10),
+				Topic: message.Topic,
+				Type:  message.EventType,
+				// the key is qualified with the tenant, so that consumers keying
+				// their state on it keep the catalogs of the tenants apart
+				Key:     tenant + "/" + message.Key,
+				Tenant:  tenant,
+				Payload: message.Payload,
+			}
+		}
+
+		return r.publisher.Publish(ctx, batch)
+	})
+}
+
+// purge deletes the messages which were published longer ago than the configured
+// retention
+func (r *outboxRelay) purge() {
+	ticker := time.NewTicker(outboxPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := r.app.models.Outbox.PurgePublished(time.Now().Add(-r.app.config.outbox.retention))
+		if err != nil {
+			r.app.logger.Error(err.Error())
+			r.app.jobs.failed("outbox.purge", err)
+			continue
+		}
+		r.app.jobs.succeeded("outbox.purge")
+
+		if n > 0 {
+			r.app.logger.Info("purged published outbox messages", "count", n)
+		}
+	}
+}
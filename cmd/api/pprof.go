@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// pprofHandler serves the net/http/pprof profiles under /debug/pprof/. Profiles such
+// as the CPU profile take longer than the write timeout of the server, so it is
+// lifted for these requests.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// servePprof serves the profiles without authentication on a separate listener at
+// -pprof-addr, which is restricted to loopback addresses so that only the host
+// itself (or an SSH tunnel to it) can reach them
+func (app *application) servePprof() {
+	srv := &http.Server{
+		Addr:        app.config.pprof.addr,
+		Handler:     pprofHandler(),
+		ReadTimeout: 5 * time.Second,
+		ErrorLog:    slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	app.logger.Info("starting pprof server", "addr", srv.Addr)
+	err := srv.ListenAndServe()
+	app.logger.Error(err.Error(), "server", "pprof")
+}
+
+// isLoopbackAddr reports whether a listen address such as localhost:6060 only
+// listens on a loopback interface
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// middlewareProfile declares the optional middleware applied in an environment.
+// Global middleware wraps the whole router (outermost first) and runs for every
+// request, while route middleware is applied to each registered route and has
+// access to its metadata (e.g. the rate-limit class).
+type middlewareProfile struct {
+	global []string
+	route  []string
+}
+
+// middlewareProfiles maps a profile name to the middleware stack it enables. The
+// profile defaults to the name of the environment, and can be overridden with the
+// -middleware-profile flag.
+var middlewareProfiles = map[string]middlewareProfile{
+	"development": {
+		global: []string{"requestID", "recoverPanic", "compress"},
+		route:  []string{"chaos"},
+	},
+	"staging": {
+		global: []string{"requestID", "recoverPanic", "secureHeaders", "compress"},
+		route:  []string{"rateLimit"},
+	},
+	"production": {
+		global: []string{"requestID", "recoverPanic", "secureHeaders", "compress"},
+		route:  []string{"rateLimit"},
+	},
+}
+
+// globalMiddleware returns every middleware that a profile may list in its global stack
+func (app *application) globalMiddleware() map[string]func(http.Handler) http.Handler {
+	return map[string]func(http.Handler) http.Handler{
+		"requestID":     app.requestID,
+		"recoverPanic":  app.recoverPanic,
+		"secureHeaders": app.secureHeaders,
+		"compress":      app.compress,
+	}
+}
+
+// routeScopedMiddleware returns every middleware that a profile may list in its route stack
+func (app *application) routeScopedMiddleware() map[string]func(route) func(http.Handler) http.Handler {
+	return map[string]func(route) func(http.Handler) http.Handler{
+		"chaos":     func(route) func(http.Handler) http.Handler { return app.chaos },
+		"rateLimit": app.rateLimit,
+	}
+}
+
+// middlewareProfile returns the profile selected by the configuration
+func (app *application) middlewareProfile() middlewareProfile {
+	name := app.config.middlewareProfile
+	if name == "" {
+		name = app.config.env
+	}
+
+	return middlewareProfiles[name]
+}
+
+// validateMiddlewareProfile checks that the selected profile exists and that it
+// only refers to known middleware, so that a typo is reported at startup rather
+// than silently disabling part of the stack.
+func (app *application) validateMiddlewareProfile() error {
+	name := app.config.middlewareProfile
+	if name == "" {
+		name = app.config.env
+	}
+
+	profile, ok := middlewareProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(middlewareProfiles))
+		for n := range middlewareProfiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown middleware profile %q (available: %v)", name, names)
+	}
+
+	global := app.globalMiddleware()
+	for _, m := range profile.global {
+		if _, ok := global[m]; !ok {
+			return fmt.Errorf("middleware profile %q: unknown global middleware %q", name, m)
+		}
+	}
+
+	scoped := app.routeScopedMiddleware()
+	for _, m := range profile.route {
+		if _, ok := scoped[m]; !ok {
+			return fmt.Errorf("middleware profile %q: unknown route middleware %q", name, m)
+		}
+	}
+
+	return nil
+}
@@ -1,23 +1,590 @@
 package main
 
 import (
+	"cmp"
+	"flag"
+	"fmt"
 	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/aviagarwal1212/greenlight/internal/data"
 	"github.com/go-chi/chi/v5"
 )
 
+// route describes a single API endpoint together with the metadata that the rest
+// of the application needs to know about it. The route table is the one source of
+// truth for registering handlers with the router, configuring per-route middleware,
+// labelling metrics, and generating documentation or CLI listings.
+type route struct {
+	// name is a short, stable identifier for the route (e.g. "movies.show"),
+	// used for metrics labels and logs
+	name    string
+	method  string
+	pattern string
+	handler http.HandlerFunc
+	// permission is the permission code a client needs to call the route,
+	// or an empty string if the route is public. Only adminPermission is
+	// enforced so far; the movies:* codes document the intended access.
+	permission string
+	// rateLimitClass groups routes which share the same rate limit settings
+	rateLimitClass string
+	// timeout caps how long the handler may run; zero means no per-route timeout
+	timeout time.Duration
+	// cached marks GET routes whose successful responses are served from the response
+	// cache, when -cache-ttl is set
+	cached bool
+	// deprecation is the key of the deprecations entry for a deprecated route
+	deprecation string
+	// stream marks GET routes which hold the connection open to stream to the
+	// client, and so are not answered for HEAD
+	stream bool
+	// ndjson marks routes which stream their response as NDJSON when asked to by
+	// the Accept header, bounding themselves with ndjsonTimeout rather than timeout
+	ndjson bool
+}
+
+// answersHead reports whether the route also answers HEAD requests, by running its
+// GET handler with the body discarded. The response has the headers of the GET
+// response, including its Content-Length when the body is small enough for
+// net/http to compute it.
+func (rt route) answersHead() bool {
+	return rt.method == http.MethodGet && !rt.stream
+}
+
+// adminPermission is the permission of routes which require the admin token
+const adminPermission = "admin"
+
+// routeTable returns the metadata for every route served by the application, for
+// every version of the API. The v1 routes which a v2 route supersedes, by having
+// the same method and path, are deprecated once -v1-deprecation is set.
+func (app *application) routeTable() []route {
+	v1, v2 := app.v1Routes(), app.v2Routes()
+
+	superseded := make(map[string]bool, len(v2))
+	for _, rt := range v2 {
+		_, pattern, _ := patternVersion(rt.pattern)
+		superseded[rt.method+" "+pattern] = true
+	}
+
+	if _, ok := app.deprecation(v1DeprecationKey); ok {
+		for i, rt := range v1 {
+			_, pattern, _ := patternVersion(rt.pattern)
+			if superseded[rt.method+" "+pattern] && rt.deprecation == "" {
+				v1[i].deprecation = v1DeprecationKey
+			}
+		}
+	}
+
+	return append(v1, v2...)
+}
+
+// v2Routes returns the routes of version 2 of the API, which are served under /v2
+// next to version 1. Only the routes which change incompatibly need a v2 version;
+// clients keep using the v1 routes for everything else.
+func (app *application) v2Routes() []route {
+	return nil
+}
+
+// v1Routes returns the routes of version 1 of the API
+func (app *application) v1Routes() []route {
+	return []route{
+		{
+			name:           "healthcheck",
+			method:         http.MethodGet,
+			pattern:        "/v1/healthcheck",
+			handler:        app.healthCheckHandler,
+			rateLimitClass: "default",
+			timeout:        time.Second,
+		},
+		{
+			name:           "changelog",
+			method:         http.MethodGet,
+			pattern:        "/v1/changelog",
+			handler:        app.changelogHandler,
+			rateLimitClass: "default",
+			timeout:        time.Second,
+		},
+		{
+			name:           "openapi",
+			method:         http.MethodGet,
+			pattern:        "/v1/openapi.json",
+			handler:        app.openAPIHandler,
+			rateLimitClass: "default",
+			timeout:        time.Second,
+		},
+		{
+			name:           "docs",
+			method:         http.MethodGet,
+			pattern:        "/v1/docs",
+			handler:        app.docsHandler,
+			rateLimitClass: "default",
+			timeout:        time.Second,
+		},
+		{
+			name:           "docs.asset",
+			method:         http.MethodGet,
+			pattern:        "/v1/docs/{file}",
+			handler:        app.docsAssetHandler,
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "settings.show",
+			method:         http.MethodGet,
+			pattern:        "/v1/admin/settings",
+			handler:        app.showSettingsHandler,
+			permission:     adminPermission,
+			rateLimitClass: "default",
+			timeout:        time.Second,
+		},
+		{
+			name:           "settings.update",
+			method:         http.MethodPatch,
+			pattern:        "/v1/admin/settings",
+			handler:        app.updateSettingsHandler,
+			permission:     adminPermission,
+			rateLimitClass: "write",
+			timeout:        time.Second,
+		},
+		{
+			name:           "tenants.list",
+			method:         http.MethodGet,
+			pattern:        "/v1/admin/tenants",
+			handler:        app.listTenantsHandler,
+			permission:     adminPermission,
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "tenants.create",
+			method:         http.MethodPost,
+			pattern:        "/v1/admin/tenants",
+			handler:        app.createTenantHandler,
+			permission:     adminPermission,
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "deprecations.list",
+			method:         http.MethodGet,
+			pattern:        "/v1/deprecations",
+			handler:        app.deprecationsHandler,
+			permission:     adminPermission,
+			rateLimitClass: "default",
+			timeout:        time.Second,
+		},
+		{
+			// no timeout, as the stream is long-lived
+			name:           "events.stream",
+			method:         http.MethodGet,
+			pattern:        "/v1/events",
+			handler:        app.eventsHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			stream:         true,
+		},
+		{
+			name:           "feeds.movies",
+			method:         http.MethodGet,
+			pattern:        "/v1/feeds/movies.atom",
+			handler:        app.moviesFeedHandler,
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "graphql",
+			method:         http.MethodPost,
+			pattern:        "/v1/graphql",
+			handler:        app.graphqlHandler,
+			permission:     "movies:write",
+			rateLimitClass: "write",
+			timeout:        10 * time.Second,
+		},
+		{
+			name:           "movies.list",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies",
+			handler:        app.listMovieHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+			cached:         true,
+			ndjson:         true,
+		},
+		{
+			name:           "movies.batchGet",
+			method:         http.MethodPost,
+			pattern:        "/v1/movies/batch-get",
+			handler:        app.batchGetMoviesHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "movies.create",
+			method:         http.MethodPost,
+			pattern:        "/v1/movies",
+			handler:        app.createMovieHandler,
+			permission:     "movies:write",
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "movies.bulkCreate",
+			method:         http.MethodPost,
+			pattern:        "/v1/movies/bulk",
+			handler:        app.bulkCreateMoviesHandler,
+			permission:     "movies:write",
+			rateLimitClass: "write",
+			timeout:        15 * time.Second,
+		},
+		{
+			name:           "movies.importFile",
+			method:         http.MethodPost,
+			pattern:        "/v1/movies/import-file",
+			handler:        app.importMoviesFileHandler,
+			permission:     "movies:write",
+			rateLimitClass: "write",
+			timeout:        30 * time.Second,
+		},
+		{
+			name:           "movies.upsertByIMDb",
+			method:         http.MethodPut,
+			pattern:        "/v1/movies/imdb/{imdb_id}",
+			handler:        app.upsertMovieByIMDbIDHandler,
+			permission:     "movies:write",
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "movies.recent",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies/recent",
+			handler:        app.recentMoviesHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+			cached:         true,
+		},
+		{
+			name:           "movies.trending",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies/trending",
+			handler:        app.trendingMoviesHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "movies.suggest",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies/suggest",
+			handler:        app.suggestMoviesHandler,
+			permission:     "movies:read",
+			rateLimitClass: "suggest",
+			timeout:        time.Second,
+		},
+		{
+			// no timeout, as the connection is long-lived and hijacked from the server
+			name:           "movies.watch",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies/watch",
+			handler:        app.watchMoviesHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			stream:         true,
+		},
+		{
+			name:           "movies.stats",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies/stats",
+			handler:        app.movieStatsHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			timeout:        10 * time.Second,
+		},
+		{
+			name:           "movies.bulkDelete",
+			method:         http.MethodDelete,
+			pattern:        "/v1/movies",
+			handler:        app.bulkDeleteMoviesHandler,
+			permission:     adminPermission,
+			rateLimitClass: "write",
+			// outlasts the transaction, so that a committed delete is always
+			// answered with its count rather than a 503
+			timeout: data.DeleteManyTimeout + 5*time.Second,
+		},
+		{
+			name:           "usage.show",
+			method:         http.MethodGet,
+			pattern:        "/v1/me/usage",
+			handler:        app.showUsageHandler,
+			rateLimitClass: "default",
+			timeout:        3 * time.Second,
+		},
+		{
+			name:           "movies.merge",
+			method:         http.MethodPost,
+			pattern:        "/v1/admin/movies/{id}/merge",
+			handler:        app.mergeMovieHandler,
+			permission:     adminPermission,
+			rateLimitClass: "write",
+			timeout:        10 * time.Second,
+		},
+		{
+			name:           "movies.show",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies/{id}",
+			handler:        app.showMovieHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+			cached:         true,
+		},
+		{
+			name:           "movies.showBySlug",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies/slug/{slug}",
+			handler:        app.showMovieBySlugHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+			cached:         true,
+		},
+		{
+			name:           "movies.similar",
+			method:         http.MethodGet,
+			pattern:        "/v1/movies/{id}/similar",
+			handler:        app.similarMoviesHandler,
+			permission:     "movies:read",
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "movies.update",
+			method:         http.MethodPatch,
+			pattern:        "/v1/movies/{id}",
+			handler:        app.updateMovieHandler,
+			permission:     "movies:write",
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "movies.delete",
+			method:         http.MethodDelete,
+			pattern:        "/v1/movies/{id}",
+			handler:        app.deleteMovieHandler,
+			permission:     "movies:write",
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "webhooks.list",
+			method:         http.MethodGet,
+			pattern:        "/v1/webhooks",
+			handler:        app.listWebhooksHandler,
+			permission:     adminPermission,
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "webhooks.create",
+			method:         http.MethodPost,
+			pattern:        "/v1/webhooks",
+			handler:        app.createWebhookHandler,
+			permission:     adminPermission,
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "webhooks.show",
+			method:         http.MethodGet,
+			pattern:        "/v1/webhooks/{id}",
+			handler:        app.showWebhookHandler,
+			permission:     adminPermission,
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "webhooks.update",
+			method:         http.MethodPatch,
+			pattern:        "/v1/webhooks/{id}",
+			handler:        app.updateWebhookHandler,
+			permission:     adminPermission,
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "webhooks.delete",
+			method:         http.MethodDelete,
+			pattern:        "/v1/webhooks/{id}",
+			handler:        app.deleteWebhookHandler,
+			permission:     adminPermission,
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "webhooks.deliveries",
+			method:         http.MethodGet,
+			pattern:        "/v1/webhooks/{id}/deliveries",
+			handler:        app.listWebhookDeliveriesHandler,
+			permission:     adminPermission,
+			rateLimitClass: "default",
+			timeout:        5 * time.Second,
+		},
+		{
+			name:           "webhooks.redeliver",
+			method:         http.MethodPost,
+			pattern:        "/v1/webhooks/{id}/deliveries/{delivery_id}/redeliver",
+			handler:        app.redeliverWebhookHandler,
+			permission:     adminPermission,
+			rateLimitClass: "write",
+			timeout:        5 * time.Second,
+		},
+	}
+}
+
 func (app *application) routes() http.Handler {
 	router := chi.NewRouter()
-	router.Use(app.recoverPanic)
+
+	profile := app.middlewareProfile()
+	global := app.globalMiddleware()
+	for _, name := range profile.global {
+		router.Use(global[name])
+	}
+	// innermost, so that it sees the responses before they are compressed
+	if app.config.debug {
+		router.Use(app.dumpBodies)
+	}
 
 	router.NotFound(http.HandlerFunc(app.notFoundResponse))
 	router.MethodNotAllowed(http.HandlerFunc(app.methodNotAllowedResponse))
 
-	router.Get("/v1/healthcheck", app.healthCheckHandler)
-	router.Post("/v1/movies", app.createMovieHandler)
-	router.Get("/v1/movies/{id}", app.showMovieHandler)
-	router.Patch("/v1/movies/{id}", app.updateMovieHandler)
-	router.Delete("/v1/movies/{id}", app.deleteMovieHandler)
+	var mounted []mountedRoute
+	for _, rt := range app.routeTable() {
+		handler := chi.Chain(app.routeMiddleware(rt)...).HandlerFunc(rt.handler)
+		router.Method(rt.method, rt.pattern, handler)
+		mounted = append(mounted, mountedRoute{rt.method, rt.pattern, handler})
+
+		if rt.answersHead() {
+			router.Method(http.MethodHead, rt.pattern, handler)
+			mounted = append(mounted, mountedRoute{http.MethodHead, rt.pattern, handler})
+		}
+	}
+	app.mountUnversioned(router, mounted)
+
+	// the profiles are a debugging aid rather than part of the API, so they are
+	// left out of the route table and its documentation
+	if app.config.pprof.enabled {
+		router.With(app.requireClientCert, app.requireAdmin).Mount("/debug/pprof", pprofHandler())
+	}
 
 	return router
 }
+
+// routeMiddleware builds the middleware chain for a single route from its metadata
+// and the route middleware of the active profile.
+func (app *application) routeMiddleware(rt route) []func(http.Handler) http.Handler {
+	// the tenant is resolved first, so that everything after it, from the response
+	// cache to the handler, is scoped to the tenant
+	middleware := []func(http.Handler) http.Handler{app.withRoute(rt), app.resolveTenant}
+
+	// the requests made with API keys count toward the quota of their tenant, except
+	// for the healthcheck, the admin routes and the usage report itself
+	if rt.permission != adminPermission && rt.name != "healthcheck" && rt.name != "usage.show" {
+		middleware = append(middleware, app.meterUsage)
+	}
+
+	if version, _, ok := patternVersion(rt.pattern); ok {
+		middleware = append(middleware, app.checkVersion(version))
+	}
+
+	if rt.permission == adminPermission {
+		middleware = append(middleware, app.requireClientCert, app.requireAdmin)
+	} else if rt.name != "healthcheck" {
+		middleware = append(middleware, app.maintenance)
+
+		// the healthcheck and admin routes stay reachable under overload. Streams
+		// hold the connection open for as long as the client listens, so they would
+		// hold a slot each until idle watchers crowded out every other request.
+		if app.config.concurrency.maxInFlight > 0 && !rt.stream {
+			middleware = append(middleware, app.limitConcurrency)
+		}
+	}
+
+	scoped := app.routeScopedMiddleware()
+	for _, name := range app.middlewareProfile().route {
+		middleware = append(middleware, scoped[name](rt))
+	}
+
+	if rt.deprecation != "" {
+		middleware = append(middleware, app.deprecatedRoute(rt.deprecation))
+	}
+
+	// cache hits are served before the timeout starts, and cached responses are
+	// stored as they were encoded
+	if rt.cached && app.config.cache.ttl > 0 {
+		middleware = append(middleware, app.cacheResponse)
+	}
+
+	if rt.timeout > 0 {
+		middleware = append(middleware, app.timeout(rt))
+	}
+
+	// negotiateEncoding wraps the ResponseWriter seen by validateBody and the
+	// handler, so they come last
+	middleware = append(middleware, app.negotiateEncoding)
+
+	if doc := openAPIDocs[rt.name]; doc.body != nil {
+		middleware = append(middleware, app.requireJSON, app.validateBody(doc.body, doc.shallowBody))
+	}
+
+	return middleware
+}
+
+// runRoutes implements "api routes", which prints the route table. It returns the
+// process exit code.
+func runRoutes(args []string) int {
+	fs := flag.NewFlagSet("routes", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATTERN\tNAME\tPERMISSION\tRATE LIMIT\tTIMEOUT\tNOTES")
+
+	app := &application{}
+	for _, rt := range app.routeTable() {
+		var notes []string
+		if rt.cached {
+			notes = append(notes, "cached")
+		}
+		if rt.deprecation != "" {
+			notes = append(notes, "deprecated")
+		}
+
+		timeout := "-"
+		if rt.timeout > 0 {
+			timeout = rt.timeout.String()
+		}
+
+		method := rt.method
+		if rt.answersHead() {
+			method += ",HEAD"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			method, rt.pattern, rt.name, cmp.Or(rt.permission, "-"), rt.rateLimitClass, timeout, strings.Join(notes, ","))
+	}
+
+	err := tw.Flush()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"maps"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// runtimeFormats are the formats in which JSON responses can write runtimes: string
+// as "102 mins", number as a bare number of minutes, and human as "1h 42m"
+var runtimeFormats = []string{"string", "number", "human"}
+
+// readRuntimeFormat reads the format of the runtimes in the response from the
+// runtime parameter of a media type in the Accept header of the request, as in
+// "Accept: application/json; runtime=number", defaulting to -runtime-format.
+func (app *application) readRuntimeFormat(v *validator.Validator, r *http.Request) string {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if format, ok := params["runtime"]; ok {
+			v.Check(validator.PermittedValue(format, runtimeFormats...), "accept", "runtime must be string, number or human")
+			return format
+		}
+	}
+
+	return app.config.runtimeFormat
+}
+
+// runtimeFormatMovie is a movie whose runtime is written in another format, which
+// shadows the runtime of the embedded movie when encoded
+type runtimeFormatMovie struct {
+	*data.Movie
+	Runtime any `json:"runtime,omitempty"`
+}
+
+// formatRuntimes returns a copy of the envelope in which the runtimes of the movies,
+// including those narrowed by applyFields, are written in the given format. Other
+// values are left as they are.
+func formatRuntimes(env envelope, format string) envelope {
+	formatted := make(envelope, len(env))
+	for key, value := range env {
+		formatted[key] = formatRuntimeValue(value, format)
+	}
+	return formatted
+}
+
+func formatRuntimeValue(value any, format string) any {
+	switch value := value.(type) {
+	case *data.Movie:
+		return formatMovieRuntime(value, format)
+	case []*data.Movie:
+		movies := make([]runtimeFormatMovie, len(value))
+		for i, movie := range value {
+			movies[i] = formatMovieRuntime(movie, format)
+		}
+		return movies
+	case map[string]any:
+		return formatFieldsRuntime(value, format)
+	case []map[string]any:
+		selected := make([]map[string]any, len(value))
+		for i, fields := range value {
+			selected[i] = formatFieldsRuntime(fields, format)
+		}
+		return selected
+	default:
+		return value
+	}
+}
+
+func formatMovieRuntime(movie *data.Movie, format string) runtimeFormatMovie {
+	formatted := runtimeFormatMovie{Movie: movie}
+	// a zero runtime is omitted, as it is from a movie
+	if movie.Runtime != 0 {
+		formatted.Runtime = runtimeValue(movie.Runtime, format)
+	}
+	return formatted
+}
+
+// formatFieldsRuntime formats the runtime of a movie selected by selectFields
+func formatFieldsRuntime(fields map[string]any, format string) map[string]any {
+	runtime, ok := fields["runtime"].(data.Runtime)
+	if !ok {
+		return fields
+	}
+
+	formatted := maps.Clone(fields)
+	formatted["runtime"] = runtimeValue(runtime, format)
+	return formatted
+}
+
+func runtimeValue(runtime data.Runtime, format string) any {
+	switch format {
+	case "number":
+		return int32(runtime)
+	case "human":
+		return runtime.Human()
+	default:
+		return runtime
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// seedMovies is the curated dataset loaded by "api seed" when no file is given
+//
+//go:embed seed/movies.json
+var seedMovies []byte
+
+// runSeed implements "api seed", which loads a dataset of movies into the database
+// for development and demo environments. It returns the process exit code.
+//
+//	api seed [-file=movies.json] [flags]
+//
+// The file holds a JSON array of movies in the format accepted by POST /v1/movies,
+// each with an IMDb ID. Movies whose IMDb ID is already in the database are skipped,
+// so seeding again only adds the movies which are missing. It accepts the
+// configuration flags of serve, of which it uses the database ones.
+func runSeed(args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := fs.String("file", "", "JSON file of movies to load (defaults to the built-in dataset)")
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		return 2
+	}
+
+	movies, err := readSeed(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	logger, _ := newLogger(cfg)
+	db, pool, err := openDB(cfg, logger, cfg.db.dsn, "db_pool", true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer pool.Close()
+	defer db.Close()
+
+	models := data.NewModel(db)
+
+	imdbIDs := make([]string, len(movies))
+	for i, movie := range movies {
+		imdbIDs[i] = movie.IMDbID
+	}
+
+	existing, err := models.Movies.ExistingIMDbIDs(imdbIDs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var missing []*data.Movie
+	for _, movie := range movies {
+		if !existing[movie.IMDbID] {
+			missing = append(missing, movie)
+		}
+	}
+
+	if len(missing) > 0 {
+		err = models.Movies.InsertAll(missing)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	fmt.Printf("inserted %d movies, skipped %d already present\n", len(missing), len(movies)-len(missing))
+	return 0
+}
+
+// readSeed reads and validates the movies of a seed file, or of the built-in dataset
+// if file is empty
+func readSeed(file string) ([]*data.Movie, error) {
+	js := seedMovies
+	if file != "" {
+		var err error
+		js, err = os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var movies []*data.Movie
+	err := json.Unmarshal(js, &movies)
+	if err != nil {
+		return nil, fmt.Errorf("seed: %w", err)
+	}
+
+	seen := make(map[string]bool, len(movies))
+	for i, movie := range movies {
+		if movie.IMDbID == "" {
+			return nil, fmt.Errorf("seed: movie %d (%q) has no imdb_id", i, movie.Title)
+		}
+		if seen[movie.IMDbID] {
+			return nil, fmt.Errorf("seed: imdb_id %s appears more than once", movie.IMDbID)
+		}
+		seen[movie.IMDbID] = true
+
+		v := validator.New()
+		if data.ValidateMovie(v, movie); !v.Valid() {
+			return nil, fmt.Errorf("seed: movie %d (%q) is invalid: %v", i, movie.Title, v.Errors)
+		}
+	}
+
+	return movies, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/events"
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
+	"github.com/aviagarwal1212/greenlight/internal/reporter"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jmoiron/sqlx"
+)
+
+// serverReadTimeout and serverWriteTimeout are the deadlines the server gives a
+// request to be read and its response to be written. They are sized for ordinary
+// routes; the timeout middleware extends them for routes with a longer timeout.
+const (
+	serverReadTimeout  = 5 * time.Second
+	serverWriteTimeout = 10 * time.Second
+)
+
+// runServe implements "api serve", which serves the API until the server fails. It
+// returns the process exit code.
+func runServe(args []string) int {
+	cfg, err := parseConfig(flag.NewFlagSet("serve", flag.ContinueOnError), args)
+	if err != nil {
+		return 2
+	}
+
+	logger, logLevel := newLogger(cfg)
+
+	changelog, err := loadChangelog()
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+
+	// connect to database
+	db, pool, err := openDB(cfg, logger, cfg.db.dsn, "db_pool", true)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+	defer pool.Close()
+	defer db.Close()
+	logger.Info("database connection pool established")
+
+	if cfg.db.migrate {
+		err = migrateUp(db.DB, logger)
+		if err != nil {
+			logger.Error(err.Error())
+			return 1
+		}
+	}
+
+	// open the read replica, if configured. It isn't pinged, as reads fall back to
+	// the primary while the replica is unavailable
+	var replica *sqlx.DB
+	if cfg.db.replicaDSN != "" {
+		var replicaPool *pgxpool.Pool
+		replica, replicaPool, err = openDB(cfg, logger, cfg.db.replicaDSN, "db_replica_pool", false)
+		if err != nil {
+			logger.Error(err.Error())
+			return 1
+		}
+		defer replicaPool.Close()
+		defer replica.Close()
+		logger.Info("read replica connection pool opened")
+	}
+
+	// connect to the shadow database, if configured
+	var shadow *data.Models
+	if cfg.shadow.dsn != "" {
+		shadowDB, shadowPool, err := openDB(cfg, logger, cfg.shadow.dsn, "db_shadow_pool", true)
+		if err != nil {
+			logger.Error(err.Error())
+			return 1
+		}
+		defer shadowPool.Close()
+		defer shadowDB.Close()
+
+		shadowModels := data.NewModel(shadowDB)
+		shadow = &shadowModels
+		logger.Info("shadow database connection pool established", "sample_rate", cfg.shadow.sampleRate)
+	}
+
+	// setup the key-value store
+	kv, err := openKVStore(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+	defer kv.Close()
+	logger.Info("key-value store ready", "backend", cfg.kvstore.backend)
+
+	// connect to the message broker
+	pub, err := openPublisher(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+	defer pub.Close()
+	logger.Info("outbox publisher ready", "publisher", cfg.outbox.publisher)
+
+	// setup the error reporter, giving the reports in flight a chance to be sent on
+	// the way out
+	rep, err := openReporter(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+	defer rep.Flush(2 * time.Second)
+
+	models := data.NewModel(db)
+	models.Movies.Replica = replica
+	if cfg.movieCache.size > 0 {
+		models.Movies.Cache = data.NewMovieCache(cfg.movieCache.size, cfg.movieCache.ttl)
+	}
+
+	// setup application struct
+	app := &application{
+		config:       cfg,
+		logger:       logger,
+		logLevel:     logLevel,
+		models:       models,
+		db:           db,
+		dbPool:       pool,
+		replica:      replica,
+		kv:           kv,
+		reporter:     rep,
+		limiter:      newRateLimiter(kv, cfg.limiter.rps, cfg.limiter.burst),
+		deprecations: newDeprecationUsage(),
+		shadow:       shadow,
+		changelog:    changelog,
+		events:       events.NewBroker(cfg.eventsBuffer),
+		jobs:         newJobTracker(),
+		inFlight:     make(chan struct{}, cfg.concurrency.maxInFlight),
+	}
+	app.storeSettings(initialSettings(cfg))
+
+	// validated with the configuration
+	app.trustedProxies, _ = parseTrustedProxies(cfg.trustedProxies)
+
+	err = app.validateMiddlewareProfile()
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+
+	app.graphql, err = newGraphQLSchema(app)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+
+	app.webhooks = newWebhookDispatcher(app)
+	app.webhooks.start()
+
+	app.outbox = newOutboxRelay(app, pub)
+	app.outbox.start()
+
+	app.usage = newUsageMeter(app)
+	app.usage.start()
+
+	if cfg.pprof.addr != "" {
+		go app.servePprof()
+	}
+
+	// setup http server
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.port),
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  serverReadTimeout,
+		WriteTimeout: serverWriteTimeout,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	// terminate TLS with the configured certificate, or with certificates from
+	// Let's Encrypt
+	switch {
+	case cfg.tls.cert != "":
+		srv.TLSConfig = serverTLSConfig()
+	case cfg.autocert.domains != "":
+		m := autocertManager(cfg)
+		srv.TLSConfig = autocertTLSConfig(m)
+		go app.serveACMEChallenges(m)
+	}
+
+	// the gRPC server is served with the certificates of the API
+	if cfg.grpc.port != 0 {
+		go app.serveGRPC(srv.TLSConfig.Clone())
+	}
+
+	if srv.TLSConfig == nil {
+		logger.Info("starting server", "addr", srv.Addr, "env", cfg.env)
+		err = srv.ListenAndServe()
+		logger.Error(err.Error())
+		return 1
+	}
+
+	if cfg.admin.clientCA != "" {
+		err = requireClientCertificates(srv.TLSConfig, cfg.admin.clientCA)
+		if err != nil {
+			logger.Error(err.Error())
+			return 1
+		}
+	}
+
+	logger.Info("starting server", "addr", srv.Addr, "env", cfg.env, "tls", true)
+	// the certificate and key are empty with autocert, which provides them instead
+	err = srv.ListenAndServeTLS(cfg.tls.cert, cfg.tls.key)
+	logger.Error(err.Error())
+	return 1
+}
+
+// openReporter creates the error reporter selected by the configuration
+func openReporter(cfg config) (reporter.Reporter, error) {
+	switch cfg.errorReporter.backend {
+	case "none":
+		return reporter.Discard{}, nil
+	case "sentry":
+		return reporter.NewSentry(cfg.errorReporter.sentryDSN, cfg.env, readBuildInfo().version)
+	default:
+		return nil, fmt.Errorf("unknown error reporter %q", cfg.errorReporter.backend)
+	}
+}
+
+// openKVStore creates the key-value store selected by the configuration
+func openKVStore(cfg config) (kvstore.Store, error) {
+	switch cfg.kvstore.backend {
+	case "memory":
+		return kvstore.NewMemory(), nil
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return kvstore.NewRedis(ctx, cfg.kvstore.redisURL)
+	default:
+		return nil, fmt.Errorf("unknown kvstore backend %q", cfg.kvstore.backend)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// settings are the parts of the configuration which can be changed while the server
+// runs, through PATCH /v1/admin/settings. They start out from the flags, and changes
+// are neither persisted nor shared with other instances, so a restart reverts them.
+type settings struct {
+	LogLevel     string  `json:"log_level"`
+	LimiterRPS   float64 `json:"limiter_rps"`
+	LimiterBurst int     `json:"limiter_burst"`
+	Maintenance  bool    `json:"maintenance"`
+	// MaintenanceMessage is the error message of the responses sent in maintenance
+	MaintenanceMessage string `json:"maintenance_message"`
+	// MaintenanceRetryAfter is the number of seconds after which clients are told to
+	// retry in maintenance
+	MaintenanceRetryAfter int `json:"maintenance_retry_after"`
+}
+
+// initialSettings returns the settings given by the configuration
+func initialSettings(cfg config) *settings {
+	return &settings{
+		LogLevel:     strings.ToLower(logLevel(cfg.log.level).String()),
+		LimiterRPS:   cfg.limiter.rps,
+		LimiterBurst: cfg.limiter.burst,
+
+		Maintenance:           cfg.maintenance.enabled,
+		MaintenanceMessage:    cfg.maintenance.message,
+		MaintenanceRetryAfter: int(cfg.maintenance.retryAfter / time.Second),
+	}
+}
+
+// currentSettings returns the snapshot of the settings in effect. The snapshot must
+// not be modified.
+func (app *application) currentSettings() *settings {
+	return app.settings.Load()
+}
+
+// storeSettings makes a new snapshot of the settings take effect. Snapshots are
+// swapped as a whole, so that requests never see a mix of old and new settings.
+func (app *application) storeSettings(s *settings) {
+	app.logLevel.Set(logLevel(s.LogLevel))
+
+	app.limiter.setRate(s.LimiterRPS, s.LimiterBurst)
+
+	app.settings.Store(s)
+}
+
+func validateSettings(v *validator.Validator, s *settings) {
+	var level slog.Level
+	v.Check(level.UnmarshalText([]byte(s.LogLevel)) == nil, "log_level", "must be debug, info, warn or error")
+	v.Check(s.LimiterRPS > 0, "limiter_rps", "must be greater than zero")
+	v.Check(s.LimiterBurst >= 1, "limiter_burst", "must be at least 1")
+	v.Check(float64(s.LimiterBurst) >= s.LimiterRPS, "limiter_burst", "must not be less than limiter_rps")
+	v.Check(s.MaintenanceMessage != "", "maintenance_message", "must be provided")
+	v.Check(s.MaintenanceRetryAfter >= 1, "maintenance_retry_after", "must be at least 1")
+}
+
+// showSettingsHandler returns the settings in effect
+func (app *application) showSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"settings": app.currentSettings()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateSettingsHandler changes some of the settings without restarting the server,
+// and returns the settings now in effect
+func (app *application) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		LogLevel              *string  `json:"log_level"`
+		LimiterRPS            *float64 `json:"limiter_rps"`
+		LimiterBurst          *int     `json:"limiter_burst"`
+		Maintenance           *bool    `json:"maintenance"`
+		MaintenanceMessage    *string  `json:"maintenance_message"`
+		MaintenanceRetryAfter *int     `json:"maintenance_retry_after"`
+	}
+
+	fields, err := app.readJSONFields(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	fields.checkNotNull(v, "log_level", "limiter_rps", "limiter_burst", "maintenance", "maintenance_message", "maintenance_retry_after")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// concurrent updates are serialized, so that neither is lost
+	app.settingsMu.Lock()
+	defer app.settingsMu.Unlock()
+
+	s := *app.currentSettings()
+	if input.LogLevel != nil {
+		s.LogLevel = *input.LogLevel
+	}
+	if input.LimiterRPS != nil {
+		s.LimiterRPS = *input.LimiterRPS
+	}
+	if input.LimiterBurst != nil {
+		s.LimiterBurst = *input.LimiterBurst
+	}
+	if input.Maintenance != nil {
+		s.Maintenance = *input.Maintenance
+	}
+	if input.MaintenanceMessage != nil {
+		s.MaintenanceMessage = *input.MaintenanceMessage
+	}
+	if input.MaintenanceRetryAfter != nil {
+		s.MaintenanceRetryAfter = *input.MaintenanceRetryAfter
+	}
+
+	if validateSettings(v, &s); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.storeSettings(&s)
+	app.loggerFrom(r.Context()).Info("settings updated", "log_level", s.LogLevel, "limiter_rps", s.LimiterRPS,
+		"limiter_burst", s.LimiterBurst, "maintenance", s.Maintenance)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"settings": s}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// maintenance rejects requests with a 503 Service Unavailable response while the
+// maintenance setting is on, for example while the database is migrated. It isn't
+// applied to the healthcheck, nor to the admin routes, through which maintenance is
+// turned off again.
+func (app *application) maintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s := app.currentSettings(); s.Maintenance {
+			w.Header().Set("Retry-After", strconv.Itoa(s.MaintenanceRetryAfter))
+			app.errorResponse(w, r, http.StatusServiceUnavailable, s.MaintenanceMessage)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+)
+
+var (
+	shadowReadsTotal      = expvar.NewInt("shadow_reads_total")
+	shadowReadMismatches  = expvar.NewInt("shadow_read_mismatches_total")
+	shadowReadErrorsTotal = expvar.NewInt("shadow_read_errors_total")
+)
+
+// shadowRead re-executes a sampled fraction of reads against the shadow database (for
+// example a new replica or schema version) in the background, and logs any difference
+// from the primary result. It never affects the response sent to the client.
+//
+// primary is the result returned to the client, and read repeats the same lookup
+// against the models it is given. Both results are compared by their JSON encoding,
+// which is what clients would see.
+func (app *application) shadowRead(r *http.Request, name string, primary any, primaryErr error, read func(data.Models) (any, error)) {
+	if app.shadow == nil || rand.Float64() >= app.config.shadow.sampleRate {
+		return
+	}
+
+	// copy what is needed from the request, as it must not be used after the handler returns
+	logger, uri := app.loggerFrom(r.Context()), r.URL.RequestURI()
+	shadow := app.shadow.WithContext(data.WithTenant(context.Background(), data.TenantID(r.Context())))
+
+	app.background(func() {
+		shadowReadsTotal.Add(1)
+
+		shadowResult, shadowErr := read(shadow)
+
+		// both sides failing to find the record is a match
+		if errors.Is(primaryErr, data.ErrRecordNotFound) && errors.Is(shadowErr, data.ErrRecordNotFound) {
+			return
+		}
+
+		if shadowErr != nil && !errors.Is(shadowErr, data.ErrRecordNotFound) {
+			shadowReadErrorsTotal.Add(1)
+			logger.Warn("shadow read failed", "read", name, "uri", uri, "error", shadowErr.Error())
+			return
+		}
+
+		primaryJSON, err := json.Marshal(primary)
+		if err != nil {
+			shadowReadErrorsTotal.Add(1)
+			logger.Warn("shadow read failed", "read", name, "uri", uri, "error", err.Error())
+			return
+		}
+		shadowJSON, err := json.Marshal(shadowResult)
+		if err != nil {
+			shadowReadErrorsTotal.Add(1)
+			logger.Warn("shadow read failed", "read", name, "uri", uri, "error", err.Error())
+			return
+		}
+
+		if (primaryErr == nil) != (shadowErr == nil) || !bytes.Equal(primaryJSON, shadowJSON) {
+			shadowReadMismatches.Add(1)
+			logger.Warn("shadow read mismatch",
+				"read", name,
+				"uri", uri,
+				"primary", string(primaryJSON),
+				"shadow", string(shadowJSON),
+			)
+		}
+	})
+}
+
+// shadowPage is a page of movies as compared by shadowRead, which encodes the movies
+// ordered by UUID. Movies tied on the sort column are ordered by their sequential ID,
+// which the shadow database needn't have assigned in the same order. The movies are
+// only sorted when a read is sampled and encoded.
+type shadowPage struct {
+	movies   []*data.Movie
+	metadata data.Metadata
+}
+
+func (p shadowPage) MarshalJSON() ([]byte, error) {
+	movies := slices.Clone(p.movies)
+	slices.SortFunc(movies, func(a, b *data.Movie) int {
+		return strings.Compare(a.UUID, b.UUID)
+	})
+
+	return json.Marshal(envelope{"movies": movies, "metadata": p.metadata})
+}
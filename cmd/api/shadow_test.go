@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+)
+
+func TestShadowPageOrder(t *testing.T) {
+	a := &data.Movie{ID: 1, UUID: "0b7f7a4e-4bb3-4c59-8d6c-000000000001", Title: "Alien", Year: 1979}
+	b := &data.Movie{ID: 2, UUID: "0b7f7a4e-4bb3-4c59-8d6c-000000000002", Title: "Alien", Year: 1979}
+	metadata := data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2}
+
+	primary, err := json.Marshal(shadowPage{[]*data.Movie{a, b}, metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shadow, err := json.Marshal(shadowPage{[]*data.Movie{b, a}, metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(primary, shadow) {
+		t.Errorf("pages with the same movies differ:\n%s\n%s", primary, shadow)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// shedRetryAfter is the Retry-After of the responses to shed requests
+const shedRetryAfter = time.Second
+
+var (
+	requestsInFlight  = expvar.NewInt("requests_in_flight")
+	requestsShedTotal = expvar.NewInt("requests_shed_total")
+)
+
+// limitConcurrency caps the requests handled at once at -max-in-flight, so that
+// latency stays bounded under overload. A request arriving while the server is at
+// capacity waits up to -queue-timeout for a slot, and is then shed with a 503
+// Service Unavailable response rather than adding to the queue. The streaming
+// routes are not limited.
+func (app *application) limitConcurrency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case app.inFlight <- struct{}{}:
+		default:
+			timer := time.NewTimer(app.config.concurrency.queueTimeout)
+			defer timer.Stop()
+
+			select {
+			case app.inFlight <- struct{}{}:
+			case <-timer.C:
+				requestsShedTotal.Add(1)
+				app.overloadedResponse(w, r)
+				return
+			case <-r.Context().Done():
+				// the client gave up while queued
+				return
+			}
+		}
+
+		requestsInFlight.Add(1)
+		defer func() {
+			<-app.inFlight
+			requestsInFlight.Add(-1)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The overloadedResponse method will be used to send a 503 Service Unavailable
+// status code and JSON response when a request is shed under overload.
+func (app *application) overloadedResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(shedRetryAfter/time.Second)))
+
+	message := "the server is overloaded, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// smokeTitlePrefix flags movies created by the smoke test, so that any left behind
+// by an interrupted run are easy to find and remove
+const smokeTitlePrefix = "[greenlight smoke test]"
+
+// smokeClient performs the requests of a smoke test run against a live deployment
+type smokeClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// runSmoke creates, reads, updates and deletes a sentinel movie against a live
+// deployment to verify the full write path, and returns the process exit code.
+//
+//	api smoke -base-url=https://api.example.com -token=XXXX
+func runSmoke(args []string) int {
+	fs := flag.NewFlagSet("smoke", flag.ContinueOnError)
+	baseURL := fs.String("base-url", "http://localhost:4000", "Base URL of the deployment to test")
+	token := fs.String("token", os.Getenv("GREENLIGHT_SMOKE_TOKEN"), "Bearer token sent with every request")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each request")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	sc := &smokeClient{
+		baseURL: strings.TrimSuffix(*baseURL, "/"),
+		token:   *token,
+		client:  &http.Client{Timeout: *timeout},
+	}
+
+	if err := sc.run(); err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL %v\n", err)
+		return 1
+	}
+
+	fmt.Println("PASS")
+	return 0
+}
+
+func (sc *smokeClient) run() (err error) {
+	if err := sc.step("healthcheck", http.MethodGet, "/v1/healthcheck", nil, http.StatusOK, nil); err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("%s %s", smokeTitlePrefix, time.Now().UTC().Format(time.RFC3339))
+	var created struct {
+		Movie struct {
+			UUID    string `json:"uuid"`
+			Title   string `json:"title"`
+			Version int32  `json:"version"`
+		} `json:"movie"`
+	}
+
+	body := map[string]any{
+		"title":   title,
+		"year":    2000,
+		"runtime": "1 mins",
+		"genres":  []string{"smoke-test"},
+	}
+	if err := sc.step("create", http.MethodPost, "/v1/movies", body, http.StatusCreated, &created); err != nil {
+		return err
+	}
+	path := "/v1/movies/" + created.Movie.UUID
+
+	// always remove the sentinel movie, even when a later step fails
+	deleted := false
+	defer func() {
+		if deleted {
+			return
+		}
+		if cleanupErr := sc.step("cleanup", http.MethodDelete, path, nil, http.StatusNoContent, nil); cleanupErr != nil {
+			err = errors.Join(err, cleanupErr)
+		}
+	}()
+
+	var shown struct {
+		Movie struct {
+			Title string `json:"title"`
+		} `json:"movie"`
+	}
+	if err := sc.step("read", http.MethodGet, path, nil, http.StatusOK, &shown); err != nil {
+		return err
+	}
+	if shown.Movie.Title != title {
+		return fmt.Errorf("read: got title %q, want %q", shown.Movie.Title, title)
+	}
+
+	var updated struct {
+		Movie struct {
+			Year    int32 `json:"year"`
+			Version int32 `json:"version"`
+		} `json:"movie"`
+	}
+	if err := sc.step("update", http.MethodPatch, path, map[string]any{"year": 2001}, http.StatusOK, &updated); err != nil {
+		return err
+	}
+	if updated.Movie.Year != 2001 || updated.Movie.Version != created.Movie.Version+1 {
+		return fmt.Errorf("update: got year %d version %d, want year 2001 version %d", updated.Movie.Year, updated.Movie.Version, created.Movie.Version+1)
+	}
+
+	if err := sc.step("delete", http.MethodDelete, path, nil, http.StatusNoContent, nil); err != nil {
+		return err
+	}
+	deleted = true
+
+	return sc.step("verify delete", http.MethodGet, path, nil, http.StatusNotFound, nil)
+}
+
+// step sends a single request, checks the response status and optionally decodes
+// the JSON response body into dst
+func (sc *smokeClient) step(name, method, path string, body any, wantStatus int, dst any) error {
+	start := time.Now()
+
+	var reqBody io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		reqBody = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, sc.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if sc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+sc.token)
+	}
+
+	res, err := sc.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if res.StatusCode != wantStatus {
+		return fmt.Errorf("%s: %s %s returned %d, want %d: %s", name, method, path, res.StatusCode, wantStatus, bytes.TrimSpace(resBody))
+	}
+
+	if dst != nil {
+		if err := json.Unmarshal(resBody, dst); err != nil {
+			return fmt.Errorf("%s: decoding response: %w", name, err)
+		}
+	}
+
+	fmt.Printf("ok   %-14s %s %s (%s)\n", name, method, path, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sseHeartbeatPeriod is how often a comment line is sent on an idle event stream, so
+// that proxies do not time the connection out
+const sseHeartbeatPeriod = 15 * time.Second
+
+// eventsHandler streams the movie change events as Server-Sent Events, for clients
+// which cannot use the WebSocket feed at GET /v1/movies/watch. Each event has the
+// form:
+//
+//	id: lx3k9q-42
+//	event: movie.updated
+//	data: {"id":"lx3k9q-42","type":"movie.updated","time":"...","data":{...}}
+//
+// Browsers resume a dropped stream on their own by sending the id of the last event
+// in the Last-Event-ID header. If the missed events are no longer available, the
+// stream starts with a resync_required event, and the client should refetch the
+// movies it tracks. A client which falls too far behind has its stream closed, and
+// resumes it in the same way.
+func (app *application) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// the stream outlives the server's WriteTimeout
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sub := app.events.Subscribe(tenantChannel(r.Context()), app.readLastEventID(r))
+	defer app.events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// tell clients to wait a few seconds before reconnecting
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	if sub.ResyncRequired {
+		fmt.Fprint(w, "event: resync_required\ndata: {}\n\n")
+	}
+
+	for _, event := range sub.Replay {
+		err := writeSSE(w, event.ID, event.Type, event)
+		if err != nil {
+			return
+		}
+	}
+
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatPeriod)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				// the subscriber fell behind; the client resumes from its last event
+				return
+			}
+			err := writeSSE(w, event.ID, event.Type, event)
+			if err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+
+		case <-r.Context().Done():
+			return
+		}
+
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// writeSSE writes a single Server-Sent Event with a JSON encoded data line
+func writeSSE(w http.ResponseWriter, id, eventType string, data any) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, eventType, js)
+	return err
+}
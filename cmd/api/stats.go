@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/kvstore"
+)
+
+// movieStatsCacheKey prefixes the kvstore keys holding the cached catalog statistics
+// of each tenant
+const movieStatsCacheKey = "cache:movies:stats"
+
+// movieStatsHandler returns aggregate statistics over the catalog for dashboards.
+// The statistics are computed at most once per -stats-cache-ttl and shared by every
+// instance using the same kvstore.
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.movieStats(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=60")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieStats returns the cached statistics, computing and caching them on a miss.
+// A failing cache is logged and bypassed rather than failing the request.
+func (app *application) movieStats(r *http.Request) (*data.MovieStats, error) {
+	key := fmt.Sprintf("%s:%d", movieStatsCacheKey, data.TenantID(r.Context()))
+
+	cached, err := app.kv.Get(r.Context(), key)
+	switch {
+	case err == nil:
+		var stats data.MovieStats
+		if err := json.Unmarshal(cached, &stats); err == nil {
+			return &stats, nil
+		}
+	case !errors.Is(err, kvstore.ErrNotFound):
+		app.logError(r, err)
+	}
+
+	stats, err := app.modelsFor(r).Movies.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.kv.Set(r.Context(), key, js, app.config.statsCacheTTL)
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	// ndjsonContentType is the media type of newline-delimited JSON responses
+	ndjsonContentType = "application/x-ndjson"
+	// ndjsonFlushEvery is the number of lines written between flushes of a stream
+	ndjsonFlushEvery = 100
+	// ndjsonTimeout caps how long a single NDJSON stream may run
+	ndjsonTimeout = 5 * time.Minute
+)
+
+// readLastEventID returns the resume token sent by a reconnecting streaming client.
+// SSE clients send it in the Last-Event-ID header; WebSocket clients, which cannot
+// set headers from browsers, send it as the last_event_id query parameter.
+func (app *application) readLastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+
+	return r.URL.Query().Get("last_event_id")
+}
+
+// wantsNDJSON reports whether the Accept header of the request asks for an NDJSON
+// response
+func wantsNDJSON(r *http.Request) bool {
+	return accepts(r, ndjsonContentType)
+}
+
+// ndjsonWriter writes a stream of values as newline-delimited JSON, one value per
+// line, flushing the response every ndjsonFlushEvery lines so that clients can
+// process it incrementally.
+type ndjsonWriter struct {
+	rc      *http.ResponseController
+	encoder *json.Encoder
+	lines   int
+}
+
+// newNDJSONWriter writes the headers of an NDJSON response and returns a writer for
+// its lines. Once it has been called, errors can no longer be sent to the client.
+//
+// The write deadline of the connection is extended to ndjsonTimeout, as the
+// server's WriteTimeout is sized for ordinary responses.
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(ndjsonTimeout))
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	return &ndjsonWriter{
+		rc:      rc,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// write encodes v as the next line of the stream
+func (nw *ndjsonWriter) write(v any) error {
+	err := nw.encoder.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	nw.lines++
+	if nw.lines%ndjsonFlushEvery == 0 {
+		return nw.flush()
+	}
+
+	return nil
+}
+
+// flush sends the buffered lines to the client
+func (nw *ndjsonWriter) flush() error {
+	err := nw.rc.Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+
+	return err
+}
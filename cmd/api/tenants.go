@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// resolveTenant scopes the request to the catalog of a tenant. A tenant is named by
+// its API key in the X-API-Key header, or else by the subdomain of -tenant-domain the
+// request was sent to, such as acme.movies.example.com; requests naming no tenant
+// are scoped to the default tenant. An unknown API key is rejected with a 401, and
+// an unknown subdomain with a 404. Clients which present too many unknown API keys
+// are locked out.
+func (app *application) resolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tenant *data.Tenant
+		var err error
+
+		switch {
+		case r.Header.Get("X-API-Key") != "":
+			lockout, lockErr := app.authLockedOut(r.Context(), app.clientIP(r), authSchemeAPIKey)
+			if lockErr != nil {
+				// fail open, like the rate limiter
+				app.logError(r, lockErr)
+			}
+			if lockout > 0 {
+				app.authLockedOutResponse(w, r, lockout)
+				return
+			}
+
+			tenant, err = app.modelsFor(r).Tenants.GetByAPIKey(r.Header.Get("X-API-Key"))
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.authFailed(r.Context(), app.clientIP(r), authSchemeAPIKey)
+				app.invalidAPIKeyResponse(w, r)
+				return
+			}
+
+		case app.tenantSubdomain(r) != "":
+			tenant, err = app.modelsFor(r).Tenants.GetBySlug(app.tenantSubdomain(r))
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.notFoundResponse(w, r)
+				return
+			}
+
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		r = app.contextSetLogger(r, app.loggerFrom(r.Context()).With("tenant_id", tenant.ID))
+		next.ServeHTTP(w, r.WithContext(data.WithTenant(r.Context(), tenant.ID)))
+	})
+}
+
+// tenantSubdomain returns the subdomain of -tenant-domain in the Host of the request,
+// or an empty string if the request was not sent to one
+func (app *application) tenantSubdomain(r *http.Request) string {
+	if app.config.tenantDomain == "" {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+app.config.tenantDomain)
+	if !ok || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+// The invalidAPIKeyResponse method will be used to send a 401 Unauthorized status
+// code and JSON response when the X-API-Key header names no tenant.
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) listTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	tenants, err := app.modelsFor(r).Tenants.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tenants": tenants}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTenantHandler adds a tenant with an empty catalog. The API key of the tenant
+// is only returned in the response, as only its hash is stored.
+func (app *application) createTenantHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tenant := &data.Tenant{
+		Name: input.Name,
+		Slug: input.Slug,
+	}
+
+	v := validator.New()
+	if data.ValidateTenant(v, tenant); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// API keys are random like webhook secrets
+	apiKey, err := generateWebhookSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.modelsFor(r).Tenants.Insert(tenant, apiKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTenantSlug):
+			v.AddError("slug", "a tenant with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"tenant": tenant, "api_key": apiKey}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serverTLSConfig returns the TLS configuration of the API when it terminates TLS
+// itself: TLS 1.2 at least, and with TLS 1.2 only the forward secret AEAD cipher
+// suites. The TLS 1.3 suites are not configurable, and are all modern.
+func serverTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+}
+
+// autocertManager returns the manager which obtains and renews the certificates of
+// -autocert-domains from Let's Encrypt, caching them in -autocert-cache so that
+// restarts don't request them again. Certificates are only requested for these
+// domains, whatever the SNI of the connection.
+func autocertManager(cfg config) *autocert.Manager {
+	var domains []string
+	for _, domain := range strings.Split(cfg.autocert.domains, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cfg.autocert.cache),
+		Email:      cfg.autocert.email,
+	}
+}
+
+// autocertTLSConfig returns the TLS configuration of the API with certificates from
+// the manager, which also answers the TLS-ALPN-01 challenges
+func autocertTLSConfig(m *autocert.Manager) *tls.Config {
+	tlsConfig := serverTLSConfig()
+	tlsConfig.GetCertificate = m.GetCertificate
+	tlsConfig.NextProtos = m.TLSConfig().NextProtos
+	return tlsConfig
+}
+
+// serveACMEChallenges answers the HTTP-01 challenges of the manager at
+// -autocert-http-addr, and redirects every other request there to HTTPS
+func (app *application) serveACMEChallenges(m *autocert.Manager) {
+	srv := &http.Server{
+		Addr:         app.config.autocert.httpAddr,
+		Handler:      m.HTTPHandler(nil),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	app.logger.Info("starting ACME challenge server", "addr", srv.Addr)
+	err := srv.ListenAndServe()
+	app.logger.Error(err.Error())
+}
+
+// requireClientCertificates makes the server ask clients for a certificate, which is
+// verified against the PEM bundle of CAs at path. Clients without one can still
+// connect, as only the routes behind requireClientCert need it.
+func requireClientCertificates(tlsConfig *tls.Config, path string) error {
+	bundle, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading client CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return errors.New("client CA bundle holds no PEM certificate")
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+)
+
+// usageFlushInterval is how often the counted requests are written to the database,
+// and how long the monthly totals of the tenants are cached
+const usageFlushInterval = 10 * time.Second
+
+// usageKey names the requests of a tenant on a UTC day
+type usageKey struct {
+	tenantID int64
+	day      string
+}
+
+// usageTotal is the number of requests of a tenant in a month, as last read from the
+// database
+type usageTotal struct {
+	month    time.Time
+	requests int64
+	readAt   time.Time
+}
+
+// usageMeter counts the requests made with the API key of each tenant, and enforces
+// -usage-monthly-quota. The requests are counted in memory and written to the
+// database in a batch every usageFlushInterval. The monthly totals which the quota
+// is checked against are read back from the database at the same interval, so that
+// the requests served by other instances count too, which makes the quota
+// approximate by a few seconds' worth of requests.
+type usageMeter struct {
+	app *application
+
+	mu sync.Mutex
+	// pending are the requests which are not written yet
+	pending map[usageKey]int64
+	// totals are the monthly totals of the tenants, by tenant ID
+	totals map[int64]usageTotal
+}
+
+func newUsageMeter(app *application) *usageMeter {
+	return &usageMeter{
+		app:     app,
+		pending: make(map[usageKey]int64),
+		totals:  make(map[int64]usageTotal),
+	}
+}
+
+// start writes the counted requests in the background until the process exits.
+// Requests counted since the last write are lost when the process exits.
+func (m *usageMeter) start() {
+	m.app.jobs.register("usage.flush", usageFlushInterval)
+	go m.run()
+}
+
+func (m *usageMeter) run() {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := m.flush()
+		if err != nil {
+			m.app.logger.Error("usage flush failed", "error", err.Error())
+			m.app.jobs.failed("usage.flush", err)
+			continue
+		}
+		m.app.jobs.succeeded("usage.flush")
+	}
+}
+
+// flush writes the pending requests, one statement per day. The requests of a failed
+// write are kept for the next one.
+func (m *usageMeter) flush() error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[usageKey]int64)
+	m.mu.Unlock()
+
+	byDay := make(map[string]map[int64]int64)
+	for key, n := range pending {
+		if byDay[key.day] == nil {
+			byDay[key.day] = make(map[int64]int64)
+		}
+		byDay[key.day][key.tenantID] = n
+	}
+
+	var firstErr error
+	for day, requests := range byDay {
+		date, _ := time.Parse(time.DateOnly, day)
+
+		err := m.app.models.Usage.Add(date, requests)
+		if err == nil {
+			m.written(date, requests)
+			continue
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+		m.mu.Lock()
+		for tenantID, n := range requests {
+			m.pending[usageKey{tenantID, day}] += n
+		}
+		m.mu.Unlock()
+	}
+
+	return firstErr
+}
+
+// written adds the requests written for a day to the cached monthly totals, which
+// count them until they are read again
+func (m *usageMeter) written(day time.Time, requests map[int64]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for tenantID, n := range requests {
+		if total, ok := m.totals[tenantID]; ok && total.month.Equal(monthStart(day)) {
+			total.requests += n
+			m.totals[tenantID] = total
+		}
+	}
+}
+
+// record counts a request of the tenant of r, unless it would exceed the monthly
+// quota. It returns the number of requests of the tenant in the current month,
+// including this one if it was counted, and whether it was counted. Without a quota
+// the requests are counted without reading the totals, and the number is zero.
+func (m *usageMeter) record(r *http.Request) (int64, bool, error) {
+	tenantID := data.TenantID(r.Context())
+	now := time.Now().UTC()
+	month := monthStart(now)
+
+	quota := m.app.config.usage.monthlyQuota
+	if quota <= 0 {
+		m.mu.Lock()
+		m.pending[usageKey{tenantID, now.Format(time.DateOnly)}]++
+		m.mu.Unlock()
+		return 0, true, nil
+	}
+
+	m.mu.Lock()
+	total, ok := m.totals[tenantID]
+	m.mu.Unlock()
+
+	if !ok || !total.month.Equal(month) || now.Sub(total.readAt) > usageFlushInterval {
+		requests, err := m.app.modelsFor(r).Usage.Total(month)
+		if err != nil {
+			return 0, false, err
+		}
+
+		total = usageTotal{month: month, requests: requests, readAt: now}
+		m.mu.Lock()
+		m.totals[tenantID] = total
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used := total.requests
+	for key, n := range m.pending {
+		if key.tenantID == tenantID && key.day >= month.Format(time.DateOnly) {
+			used += n
+		}
+	}
+
+	if used >= quota {
+		return used, false, nil
+	}
+
+	m.pending[usageKey{tenantID, now.Format(time.DateOnly)}]++
+	return used + 1, true, nil
+}
+
+// pendingDays returns the requests of the tenant which are not written yet, by day
+func (m *usageMeter) pendingDays(tenantID int64) map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	days := make(map[string]int64)
+	for key, n := range m.pending {
+		if key.tenantID == tenantID {
+			days[key.day] += n
+		}
+	}
+	return days
+}
+
+// monthStart returns the start of the UTC month of t
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// meterUsage counts the requests made with an API key toward the usage of its
+// tenant, and rejects them with a 429 Too Many Requests response once the tenant
+// has used up its monthly quota. The quota and the requests left are sent in the
+// X-Quota-Limit, X-Quota-Remaining and X-Quota-Reset headers.
+func (app *application) meterUsage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// resolveTenant has rejected unknown API keys
+		if r.Header.Get("X-API-Key") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		used, counted, err := app.usage.record(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if quota := app.config.usage.monthlyQuota; quota > 0 {
+			reset := monthStart(time.Now()).AddDate(0, 1, 0)
+
+			w.Header().Set("X-Quota-Limit", strconv.FormatInt(quota, 10))
+			w.Header().Set("X-Quota-Remaining", strconv.FormatInt(max(quota-used, 0), 10))
+			w.Header().Set("X-Quota-Reset", reset.Format(time.RFC3339))
+
+			if !counted {
+				app.quotaExceededResponse(w, r, reset)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// usageReport is the usage of a tenant in a month
+type usageReport struct {
+	Month    string `json:"month"`
+	Requests int64  `json:"requests"`
+	// Quota and Remaining are left out when there is no quota
+	Quota     int64              `json:"quota,omitempty"`
+	Remaining *int64             `json:"remaining,omitempty"`
+	ResetsAt  time.Time          `json:"resets_at"`
+	Days      []*data.DailyUsage `json:"days"`
+}
+
+// showUsageHandler returns the usage of the tenant of the API key of the request in
+// the current UTC month: the number of requests made on each day and in total, and
+// the quota. It can be called after the quota is used up, and isn't counted itself.
+func (app *application) showUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-API-Key") == "" {
+		app.apiKeyRequiredResponse(w, r)
+		return
+	}
+
+	month := monthStart(time.Now())
+
+	days, err := app.modelsFor(r).Usage.Daily(month)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the requests which are not written yet are added to their days
+	for day, n := range app.usage.pendingDays(data.TenantID(r.Context())) {
+		if day < month.Format(time.DateOnly) {
+			continue
+		}
+
+		i, found := slices.BinarySearchFunc(days, day, func(usage *data.DailyUsage, day string) int {
+			return cmp.Compare(usage.Day, day)
+		})
+		if found {
+			days[i].Requests += n
+		} else {
+			days = slices.Insert(days, i, &data.DailyUsage{Day: day, Requests: n})
+		}
+	}
+
+	report := usageReport{
+		Month:    month.Format("2006-01"),
+		ResetsAt: month.AddDate(0, 1, 0),
+		Days:     days,
+	}
+	for _, day := range days {
+		report.Requests += day.Requests
+	}
+	if quota := app.config.usage.monthlyQuota; quota > 0 {
+		remaining := max(quota-report.Requests, 0)
+		report.Quota, report.Remaining = quota, &remaining
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"usage": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The apiKeyRequiredResponse method will be used to send a 401 Unauthorized status
+// code and JSON response when a route needs an X-API-Key header which the request
+// doesn't have.
+func (app *application) apiKeyRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "an API key is required to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The quotaExceededResponse method will be used to send a 429 Too Many Requests
+// status code and JSON response when the tenant has used up its monthly quota, which
+// resets at the given time.
+func (app *application) quotaExceededResponse(w http.ResponseWriter, r *http.Request, reset time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+
+	message := fmt.Sprintf("monthly request quota exceeded; the quota resets at %s", reset.Format(time.RFC3339))
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	// versionPatternRX splits a route pattern into its version and the rest
+	versionPatternRX = regexp.MustCompile(`^/v(\d+)(/.*)$`)
+	// versionMediaTypeRX matches the media types which ask for a version of the API
+	versionMediaTypeRX = regexp.MustCompile(`^application/vnd\.greenlight\.v(\d+)\+json$`)
+)
+
+// patternVersion returns the API version of a route pattern such as /v1/movies,
+// and the pattern without it
+func patternVersion(pattern string) (version, unversioned string, ok bool) {
+	match := versionPatternRX.FindStringSubmatch(pattern)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// requestedVersion returns the API version named by an
+// application/vnd.greenlight.v<N>+json media type in the Accept header of the
+// request, or an empty string if there is none
+func requestedVersion(r *http.Request) string {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if match := versionMediaTypeRX.FindStringSubmatch(mediaType); match != nil {
+			return match[1]
+		}
+	}
+
+	return ""
+}
+
+// checkVersion serves a route of the given API version, which must match the
+// version the request asks for in its Accept header, if any
+func (app *application) checkVersion(version string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requested := requestedVersion(r); requested != "" && requested != version {
+				app.unsupportedVersionResponse(w, r, requested, []string{version})
+				return
+			}
+
+			w.Header().Set("API-Version", version)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// mountedRoute is a route as mounted on the router, with its middleware
+type mountedRoute struct {
+	method  string
+	pattern string
+	handler http.Handler
+}
+
+// versionedRoute holds the handlers of a route without its version prefix, by
+// API version
+type versionedRoute struct {
+	method   string
+	pattern  string
+	handlers map[string]http.Handler
+}
+
+// mountUnversioned serves every route of the route table without its version
+// prefix too (e.g. /movies), dispatching to a version by the Accept header of the
+// request, such as application/vnd.greenlight.v1+json. Requests which don't ask for
+// a version get the latest version of the route, so clients which pin a version
+// are not affected when a new one is introduced.
+func (app *application) mountUnversioned(router chi.Router, mounted []mountedRoute) {
+	var routes []*versionedRoute
+	byKey := make(map[string]*versionedRoute)
+
+	for _, rt := range mounted {
+		version, pattern, ok := patternVersion(rt.pattern)
+		if !ok {
+			continue
+		}
+
+		key := rt.method + " " + pattern
+		vr := byKey[key]
+		if vr == nil {
+			vr = &versionedRoute{method: rt.method, pattern: pattern, handlers: make(map[string]http.Handler)}
+			byKey[key] = vr
+			routes = append(routes, vr)
+		}
+		vr.handlers[version] = rt.handler
+	}
+
+	for _, vr := range routes {
+		router.Method(vr.method, vr.pattern, app.dispatchVersion(vr))
+	}
+}
+
+// dispatchVersion serves a request with the handler of the version it asks for, or
+// of the latest version of the route
+func (app *application) dispatchVersion(vr *versionedRoute) http.Handler {
+	versions := make([]string, 0, len(vr.handlers))
+	for version := range vr.handlers {
+		versions = append(versions, version)
+	}
+	slices.SortFunc(versions, compareVersions)
+	latest := versions[len(versions)-1]
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := requestedVersion(r)
+		if version == "" {
+			version = latest
+		}
+
+		handler, ok := vr.handlers[version]
+		if !ok {
+			app.unsupportedVersionResponse(w, r, version, versions)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// compareVersions orders API versions numerically
+func compareVersions(a, b string) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// The unsupportedVersionResponse method will be used to send a 406 Not Acceptable
+// status code and JSON response when a request asks for a version of the API which
+// the route doesn't have.
+func (app *application) unsupportedVersionResponse(w http.ResponseWriter, r *http.Request, version string, supported []string) {
+	message := fmt.Sprintf("API version %s is not supported by this route; supported versions: %s", version, strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// watchWriteWait is how long a single WebSocket write may take
+	watchWriteWait = 10 * time.Second
+	// watchPongWait is how long a client may go without answering a ping
+	watchPongWait = 60 * time.Second
+	// watchPingPeriod is how often the server pings clients; it must be shorter
+	// than watchPongWait
+	watchPingPeriod = 30 * time.Second
+)
+
+// watchUpgrader upgrades watch requests to WebSocket connections. Its default origin
+// check rejects cross-origin browser clients.
+var watchUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// watchMoviesHandler upgrades the request to a WebSocket connection and pushes the
+// movie.created, movie.updated and movie.deleted events to the client as JSON text
+// messages, in the form:
+//
+//	{"id": "lx3k9q-42", "type": "movie.updated", "time": "...", "data": {...}}
+//
+// The data of created and updated events is the movie as returned by the API, with
+// its new version; the data of deleted events holds the id, uuid and version of the
+// deleted movie.
+//
+// A client which reconnects can pass the id of the last event it processed as
+// ?last_event_id= to receive the events it missed. If they are no longer available,
+// the first message is {"type": "resync_required"}, and the client should refetch
+// the movies it tracks. Clients which fall too far behind are disconnected with
+// close code 1013 (try again later), and should reconnect in the same way.
+func (app *application) watchMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := watchUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already sent an error response
+		return
+	}
+	defer conn.Close()
+
+	sub := app.events.Subscribe(tenantChannel(r.Context()), app.readLastEventID(r))
+	defer app.events.Unsubscribe(sub)
+
+	// the reader notices when the client goes away, and answers its control frames
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(watchPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(watchPongWait))
+		})
+
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(v any) bool {
+		conn.SetWriteDeadline(time.Now().Add(watchWriteWait))
+		return conn.WriteJSON(v) == nil
+	}
+
+	if sub.ResyncRequired && !write(envelope{"type": "resync_required"}) {
+		return
+	}
+
+	for _, event := range sub.Replay {
+		if !write(event) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(watchPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				app.closeWatch(conn, websocket.CloseTryAgainLater, "subscriber fell behind")
+				return
+			}
+			if !write(event) {
+				return
+			}
+
+		case <-ticker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(watchWriteWait))
+			if err != nil {
+				return
+			}
+
+		case <-closed:
+			return
+		}
+	}
+}
+
+// closeWatch sends a close message to the client, which it should answer before the
+// connection is torn down
+func (app *application) closeWatch(conn *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(watchWriteWait))
+}
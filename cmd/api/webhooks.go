@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/events"
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+// createWebhookHandler subscribes a URL to movie events. The expected JSON structure
+// for the request body is:
+//
+//	{
+//	  "url": "https://example.com/hooks/greenlight",
+//	  "event_types": ["movie.created", "movie.deleted"],
+//	  "secret": "optional, at least 16 bytes"
+//	}
+//
+// A random secret is generated when none is given. The secret is only returned in
+// the response to this request, so the subscriber must store it to verify the
+// X-Greenlight-Signature header of deliveries.
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Secret     string   `json:"secret"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		URL:        input.URL,
+		EventTypes: input.EventTypes,
+		Secret:     input.Secret,
+	}
+
+	if webhook.Secret == "" {
+		webhook.Secret, err = generateWebhookSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Webhooks.Insert(webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": webhook, "secret": webhook.Secret}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.modelsFor(r).Webhooks.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	webhook, err := app.modelsFor(r).Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhookHandler changes the URL or event types of a webhook. Every field is
+// optional; sending "rotate_secret": true replaces the secret with a new random one,
+// which is returned in the response.
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	webhook, err := app.modelsFor(r).Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		URL          *string  `json:"url"`
+		EventTypes   []string `json:"event_types"`
+		RotateSecret bool     `json:"rotate_secret"`
+	}
+
+	fields, err := app.readJSONFields(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if fields.checkNotNull(v, "url", "event_types", "rotate_secret"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.EventTypes != nil {
+		webhook.EventTypes = input.EventTypes
+	}
+	if input.RotateSecret {
+		webhook.Secret, err = generateWebhookSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Webhooks.Update(webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"webhook": webhook}
+	if input.RotateSecret {
+		env["secret"] = webhook.Secret
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.modelsFor(r).Webhooks.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// generateWebhookSecret returns a random 32 byte secret, hex encoded
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// listWebhookDeliveriesHandler returns the delivery log of a webhook, newest first,
+// paginated with ?page= and ?page_size=, and optionally filtered by ?status=
+// (pending, succeeded or failed).
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	status := app.readString(qs, "status", "")
+	v.Check(status == "" || validator.PermittedValue(status, data.DeliveryPending, data.DeliverySucceeded, data.DeliveryFailed), "status", "must be pending, succeeded or failed")
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         "-id",
+		SortSafelist: []string{"-id"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.modelsFor(r).Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	deliveries, metadata, err := app.modelsFor(r).WebhookDeliveries.GetAllForWebhook(id, status, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler queues a delivery to be sent again straight away, with a
+// fresh set of attempts. It responds with 202 Accepted, as the delivery is made in
+// the background.
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(chi.URLParamFromCtx(r.Context(), "delivery_id"), 10, 64)
+	if err != nil || deliveryID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := app.modelsFor(r).WebhookDeliveries.Redeliver(webhookID, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.webhooks.notify()
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+const (
+	// webhookWorkers is the number of deliveries made concurrently
+	webhookWorkers = 4
+	// webhookTimeout caps how long a subscriber may take to answer a delivery
+	webhookTimeout = 10 * time.Second
+	// webhookPollInterval is how often the dispatcher looks for due retries
+	webhookPollInterval = 5 * time.Second
+	// webhookBaseBackoff is the wait before the first retry; it doubles with every
+	// further attempt, up to webhookMaxBackoff
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+)
+
+// webhookDispatcher delivers the events of the movies channel to the webhooks
+// subscribed to them. Every event is first stored as one delivery per webhook, which
+// is then attempted until it succeeds or runs out of attempts, with an exponential
+// backoff between attempts. As deliveries are claimed from the database, they
+// survive restarts and are shared out between instances of the application.
+type webhookDispatcher struct {
+	app    *application
+	client *http.Client
+	// wake prompts the dispatcher to look for due deliveries before the next poll
+	wake chan struct{}
+
+	mu sync.Mutex
+	// following holds the tenants whose channels the dispatcher follows
+	following map[int64]bool
+}
+
+func newWebhookDispatcher(app *application) *webhookDispatcher {
+	return &webhookDispatcher{
+		app: app,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// a redirect could send the signed payload somewhere else
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake:      make(chan struct{}, 1),
+		following: make(map[int64]bool),
+	}
+}
+
+// start runs the dispatcher in the background until the process exits
+func (d *webhookDispatcher) start() {
+	d.app.jobs.register("webhooks.dispatch", webhookPollInterval)
+	d.watch(data.DefaultTenantID)
+	go d.run()
+}
+
+// watch starts following the channel of the tenant, unless it is already followed.
+// Every tenant has a channel of its own, and the tenants are only known once they
+// change their movies, so publishMovieEvent calls it before each event.
+func (d *webhookDispatcher) watch(tenantID int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.following[tenantID] {
+		return
+	}
+	d.following[tenantID] = true
+
+	// subscribe before returning, so that the event about to be published is seen
+	ctx := data.WithTenant(context.Background(), tenantID)
+	go d.follow(ctx, d.app.events.Subscribe(tenantChannel(ctx), ""))
+}
+
+// notify wakes the dispatcher up to send deliveries which have just been queued
+func (d *webhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// follow reads the events of the channel of the tenant carried by ctx, starting with
+// sub, and queues a delivery for every webhook of the tenant subscribed to each of
+// them. It resumes from the last event it saw if the broker disconnects it for
+// falling behind.
+func (d *webhookDispatcher) follow(ctx context.Context, sub *events.Subscription) {
+	logger := d.app.logger.With("tenant_id", data.TenantID(ctx))
+	lastEventID := ""
+
+	for {
+		if sub.ResyncRequired {
+			logger.Error("webhook dispatcher missed events", "last_event_id", lastEventID)
+		}
+
+		for _, event := range sub.Replay {
+			d.queue(ctx, logger, event)
+			lastEventID = event.ID
+		}
+
+		for event := range sub.Events {
+			d.queue(ctx, logger, event)
+			lastEventID = event.ID
+		}
+
+		sub = d.app.events.Subscribe(tenantChannel(ctx), lastEventID)
+	}
+}
+
+func (d *webhookDispatcher) queue(ctx context.Context, logger *slog.Logger, event events.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error(err.Error(), "event_id", event.ID)
+		return
+	}
+
+	n, err := d.app.models.WithContext(ctx).WebhookDeliveries.InsertForEvent(event.ID, event.Type, payload)
+	if err != nil {
+		logger.Error(err.Error(), "event_id", event.ID)
+		return
+	}
+
+	if n > 0 {
+		d.notify()
+	}
+}
+
+// run claims and attempts the deliveries which are due, in batches of up to
+// webhookWorkers concurrent deliveries
+func (d *webhookDispatcher) run() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// the lease outlasts an attempt, so a claimed delivery is not retried while in flight
+		deliveries, err := d.app.models.WebhookDeliveries.ClaimDue(webhookWorkers, 2*webhookTimeout)
+		if err != nil {
+			d.app.logger.Error(err.Error())
+			d.app.jobs.failed("webhooks.dispatch", err)
+		} else {
+			d.app.jobs.succeeded("webhooks.dispatch")
+		}
+
+		if len(deliveries) == 0 {
+			select {
+			case <-d.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.attempt(delivery)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// attempt makes one attempt at the delivery and records its outcome, scheduling a
+// retry if the attempt failed and the delivery has attempts left
+func (d *webhookDispatcher) attempt(delivery *data.WebhookDelivery) {
+	responseCode, err := d.deliver(delivery)
+
+	var nextAttempt *time.Time
+	if err != nil && delivery.Attempts+1 < d.app.config.webhooks.maxAttempts {
+		next := time.Now().Add(webhookBackoff(delivery.Attempts + 1))
+		nextAttempt = &next
+	}
+
+	err = d.app.models.WebhookDeliveries.RecordAttempt(delivery, responseCode, err, nextAttempt)
+	if err != nil {
+		d.app.logger.Error(err.Error(), "delivery_id", delivery.ID)
+		return
+	}
+
+	if delivery.Status == data.DeliveryFailed {
+		d.app.logger.Warn("webhook delivery failed", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "error", delivery.LastError)
+	}
+}
+
+// webhookBackoff returns the wait before the retry which follows the given number
+// of failed attempts, with up to 10% of random jitter so that retries of many
+// deliveries to the same subscriber are spread out
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookMaxBackoff
+	if attempts < 20 {
+		backoff = min(webhookBaseBackoff<<(attempts-1), webhookMaxBackoff)
+	}
+
+	return backoff + mathrand.N(backoff/10+1)
+}
+
+// deliver POSTs the payload of the delivery to the webhook URL, and returns the
+// status code of the response, if there was one. The body is signed with
+// HMAC-SHA256 using the webhook secret, and the hex encoded signature is sent in the
+// X-Greenlight-Signature header as "sha256=<signature>". Any 2xx response counts as
+// a successful delivery.
+func (d *webhookDispatcher) deliver(delivery *data.WebhookDelivery) (*int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "greenlight-webhooks/"+version)
+	req.Header.Set("X-Greenlight-Event", delivery.EventType)
+	req.Header.Set("X-Greenlight-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Greenlight-Signature", "sha256="+signWebhook(delivery.Webhook.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return &resp.StatusCode, nil
+}
+
+// signWebhook returns the hex encoded HMAC-SHA256 of the body with the secret
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
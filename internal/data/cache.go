@@ -0,0 +1,150 @@
+package data
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MovieCache is an in-process LRU cache of movies by ID, used by MovieModel.Get to
+// absorb reads of hot movies. Entries expire after a TTL, and the writes made
+// through MovieModel remove the movies they change. Writes made by other instances
+// of the API are not seen, so the TTL bounds how stale a cached movie can be.
+//
+// A read replica may still return a movie as it was before a write which removed it,
+// so the movies read from a replica are not cached for a TTL after their removal.
+// Only a replica lagging behind the primary by more than the TTL can then leave a
+// stale movie in the cache.
+type MovieCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[int64]*list.Element
+	// order holds the entries from the most to the least recently used
+	order *list.List
+	// generation is incremented by every removal, so that a movie read from the
+	// database before a concurrent write isn't stored after it
+	generation uint64
+	// removedAt holds when the movies were last removed, for a TTL, and clearedAt
+	// when the cache was last cleared, to tell whether a replica read may be stale
+	removedAt map[int64]time.Time
+	clearedAt time.Time
+}
+
+type movieCacheEntry struct {
+	movie     Movie
+	expiresAt time.Time
+}
+
+// NewMovieCache creates a cache of at most size movies, each kept for at most ttl
+func NewMovieCache(size int, ttl time.Duration) *MovieCache {
+	return &MovieCache{
+		size:      size,
+		ttl:       ttl,
+		entries:   make(map[int64]*list.Element, size),
+		removedAt: make(map[int64]time.Time),
+		order:     list.New(),
+	}
+}
+
+// get returns a copy of the cached movie with the given ID, and the generation of
+// the cache, which put needs after a miss
+func (c *MovieCache) get(id int64) (*Movie, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, c.generation
+	}
+
+	entry := elem.Value.(*movieCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+		return nil, c.generation
+	}
+
+	c.order.MoveToFront(elem)
+	return copyMovie(&entry.movie), c.generation
+}
+
+// put stores a copy of the movie, unless a movie was removed since the generation
+// returned by get. A movie read from a replica is not stored either if it was
+// removed within the last TTL, as the replica may not have seen the write yet.
+func (c *MovieCache) put(movie *Movie, generation uint64, replica bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	now := time.Now()
+	if replica && (now.Sub(c.clearedAt) < c.ttl || now.Sub(c.removedAt[movie.ID]) < c.ttl) {
+		return
+	}
+
+	entry := &movieCacheEntry{movie: *copyMovie(movie), expiresAt: now.Add(c.ttl)}
+
+	if elem, ok := c.entries[movie.ID]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[movie.ID] = c.order.PushFront(entry)
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*movieCacheEntry).movie.ID)
+	}
+}
+
+// remove drops the movies with the given IDs from the cache
+func (c *MovieCache) remove(ids ...int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	// forget the removals older than a TTL before the map outgrows the cache
+	now := time.Now()
+	if len(c.removedAt) >= c.size {
+		for id, at := range c.removedAt {
+			if now.Sub(at) >= c.ttl {
+				delete(c.removedAt, id)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		c.removedAt[id] = now
+		if elem, ok := c.entries[id]; ok {
+			c.order.Remove(elem)
+			delete(c.entries, id)
+		}
+	}
+}
+
+// clear removes every movie from the cache
+func (c *MovieCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.clearedAt = time.Now()
+	clear(c.entries)
+	clear(c.removedAt)
+	c.order.Init()
+}
+
+// copyMovie returns a copy of the movie which shares no memory with it, as callers
+// modify the movies they get
+func copyMovie(movie *Movie) *Movie {
+	c := *movie
+	c.Genres = slices.Clone(movie.Genres)
+	return &c
+}
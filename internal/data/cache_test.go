@@ -0,0 +1,42 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMovieCachePut(t *testing.T) {
+	tests := []struct {
+		name    string
+		remove  bool
+		clear   bool
+		replica bool
+		cached  bool
+	}{
+		{"primary read", false, false, false, true},
+		{"replica read", false, false, true, true},
+		{"primary read after removal", true, false, false, true},
+		{"replica read after removal", true, false, true, false},
+		{"replica read after clear", false, true, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewMovieCache(10, time.Minute)
+			if tt.remove {
+				cache.remove(1)
+			}
+			if tt.clear {
+				cache.clear()
+			}
+
+			_, generation := cache.get(1)
+			cache.put(&Movie{ID: 1, Title: "Casablanca"}, generation, tt.replica)
+
+			movie, _ := cache.get(1)
+			if got := movie != nil; got != tt.cached {
+				t.Errorf("cached = %t; want %t", got, tt.cached)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package data
+
+import (
+	"golang.org/x/sync/singleflight"
+)
+
+// coalesce runs read once for concurrent calls with the same key, and gives each
+// caller the result, so that a burst of identical reads makes a single query. A nil
+// group runs read for every call.
+//
+// Callers which are given a shared result receive it through clone, as the values
+// returned by models are modified by their callers.
+func coalesce[T any](group *singleflight.Group, key string, read func() (T, error), clone func(T) T) (T, error) {
+	if group == nil {
+		return read()
+	}
+
+	v, err, shared := group.Do(key, func() (any, error) {
+		return read()
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	if shared {
+		return clone(v.(T)), nil
+	}
+	return v.(T), nil
+}
+
+// copyMovies copies each of the movies with copyMovie
+func copyMovies(movies []*Movie) []*Movie {
+	copies := make([]*Movie, len(movies))
+	for i, movie := range movies {
+		copies[i] = copyMovie(movie)
+	}
+	return copies
+}
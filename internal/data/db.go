@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+// DBConfig holds the settings of a database connection pool
+type DBConfig struct {
+	DSN             string
+	MaxConns        int
+	MaxConnIdleTime time.Duration
+	// SlowQueryThreshold is the duration above which queries are logged to Logger;
+	// zero disables the slow query log
+	SlowQueryThreshold time.Duration
+	Logger             *slog.Logger
+}
+
+// OpenDB creates a pgx connection pool for the database, and returns it wrapped in a
+// *sqlx.DB for the models together with the pool itself, whose statistics cover
+// every query made through the *sqlx.DB. Connections are opened when they are first
+// needed, so OpenDB doesn't check that the database is reachable.
+func OpenDB(cfg DBConfig) (*sqlx.DB, *pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, nil, err
+	}
+	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	if cfg.SlowQueryThreshold > 0 {
+		poolConfig.ConnConfig.Tracer = &slowQueryTracer{threshold: cfg.SlowQueryThreshold, logger: cfg.Logger}
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sqlx.NewDb(stdlib.OpenDBFromPool(pool), "pgx"), pool, nil
+}
+
+// arrayScanner returns a scan destination for a PostgreSQL array column, such as
+// genres, into a pointer to a slice. Array arguments need no adapting, as pgx encodes
+// slices itself; like lib/pq, it encodes a nil slice as NULL.
+func arrayScanner(dest any) any {
+	// Map is not safe for concurrent use, so every scan has its own
+	return pgtype.NewMap().SQLScanner(dest)
+}
+
+// namedQueryRow runs a query with named parameters, such as :title or
+// :links.homepage, bound from the db tags of arg, and returns its first row to be
+// read with StructScan. Named queries must not use :: casts, which sqlx reads as an
+// escaped colon.
+func namedQueryRow(ctx context.Context, q sqlx.ExtContext, query string, arg any) rowScanner {
+	query, args, err := q.BindNamed(query, arg)
+	if err != nil {
+		return errRow{err}
+	}
+
+	return q.QueryRowxContext(ctx, query, args...)
+}
+
+// errRow is a row which failed before its query was run
+type errRow struct {
+	err error
+}
+
+func (r errRow) StructScan(dest any) error {
+	return r.err
+}
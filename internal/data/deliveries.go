@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Webhook delivery statuses. A delivery is pending until it succeeds, or until it
+// has failed the maximum number of attempts.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event to be sent to one webhook, together with the outcome
+// of the attempts made so far
+type WebhookDelivery struct {
+	ID        int64           `json:"id"`
+	WebhookID int64           `json:"webhook_id"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	// ResponseCode is the status code of the last response, if there was one
+	ResponseCode  *int      `json:"response_code"`
+	LastError     string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Webhook is the webhook the delivery is for, set by ClaimDue
+	Webhook *Webhook `json:"-"`
+}
+
+type WebhookDeliveryModel struct {
+	DB DBTX
+	// ctx is the parent context of the queries, set by Models.WithContext
+	ctx context.Context
+}
+
+// tenantID returns the tenant whose webhooks the queries of the model are scoped to
+func (m WebhookDeliveryModel) tenantID() int64 {
+	return TenantID(m.ctx)
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.response_code, d.last_error, d.next_attempt_at, d.created_at, d.updated_at`
+
+func deliveryFields(delivery *WebhookDelivery) []any {
+	return []any{
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.ResponseCode,
+		&delivery.LastError,
+		&delivery.NextAttemptAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	}
+}
+
+// InsertForEvent queues a delivery of the event to every webhook of the tenant
+// subscribed to its type, and returns the number of deliveries queued.
+func (m WebhookDeliveryModel) InsertForEvent(eventID, eventType string, payload []byte) (int64, error) {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+	SELECT id, $2, $3, $4
+	FROM webhooks
+	WHERE tenant_id = $1 AND event_types @> ARRAY[$3]`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, m.tenantID(), eventID, eventType, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ClaimDue returns up to limit pending deliveries whose next attempt is due, with
+// their webhooks. The claimed deliveries are leased by pushing their next attempt
+// back by lease, so that no other worker picks them up in the meantime, even in
+// another instance of the application.
+func (m WebhookDeliveryModel) ClaimDue(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+	WITH due AS (
+		SELECT id
+		FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= now()
+		ORDER BY next_attempt_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	), d AS (
+		UPDATE webhook_deliveries
+		SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM due
+		WHERE webhook_deliveries.id = due.id
+		RETURNING webhook_deliveries.*
+	)
+	SELECT ` + deliveryColumns + `, ` + webhookColumns + `
+	FROM d
+	INNER JOIN webhooks ON webhooks.id = d.webhook_id`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery := &WebhookDelivery{Webhook: &Webhook{}}
+
+		err := rows.Scan(append(deliveryFields(delivery), webhookFields(delivery.Webhook)...)...)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt stores the outcome of an attempt at the delivery. A nil nextAttempt
+// ends the delivery: it is marked as succeeded if the attempt succeeded, and as
+// failed otherwise. With a nextAttempt, the delivery stays pending until then.
+func (m WebhookDeliveryModel) RecordAttempt(delivery *WebhookDelivery, responseCode *int, attemptErr error, nextAttempt *time.Time) error {
+	delivery.Attempts++
+	delivery.ResponseCode = responseCode
+	delivery.LastError = ""
+
+	switch {
+	case attemptErr == nil:
+		delivery.Status = DeliverySucceeded
+	case nextAttempt != nil:
+		delivery.Status = DeliveryPending
+		delivery.LastError = attemptErr.Error()
+		delivery.NextAttemptAt = *nextAttempt
+	default:
+		delivery.Status = DeliveryFailed
+		delivery.LastError = attemptErr.Error()
+	}
+
+	query := `
+	UPDATE webhook_deliveries
+	SET status = $1, attempts = $2, response_code = $3, last_error = $4, next_attempt_at = $5, updated_at = now()
+	WHERE id = $6`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	args := []any{delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.LastError, delivery.NextAttemptAt, delivery.ID}
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetAllForWebhook returns a page of the deliveries of the webhook, newest first.
+func (m WebhookDeliveryModel) GetAllForWebhook(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), ` + deliveryColumns + `
+	FROM webhook_deliveries d
+	WHERE d.webhook_id = $1
+	AND (d.status = $2 OR $2 = '')
+	ORDER BY d.id DESC
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, webhookID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		err := rows.Scan(append([]any{&totalRecords}, deliveryFields(&delivery)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return deliveries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Redeliver queues the delivery to be attempted again right away, with a fresh
+// count of attempts, whatever its current status.
+func (m WebhookDeliveryModel) Redeliver(webhookID, id int64) (*WebhookDelivery, error) {
+	query := `
+	UPDATE webhook_deliveries d
+	SET status = 'pending', attempts = 0, next_attempt_at = now(), updated_at = now()
+	FROM webhooks
+	WHERE d.id = $1 AND d.webhook_id = $2 AND webhooks.id = d.webhook_id AND webhooks.tenant_id = $3
+	RETURNING ` + deliveryColumns
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	var delivery WebhookDelivery
+
+	err := m.DB.QueryRowxContext(ctx, query, id, webhookID, m.tenantID()).Scan(deliveryFields(&delivery)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &delivery, nil
+}
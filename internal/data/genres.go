@@ -0,0 +1,33 @@
+package data
+
+import (
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Genres are the genres of a movie, stored in a text[] column. It scans and encodes
+// itself, so that a movie can be scanned or passed as a query argument without
+// adapting its genres.
+type Genres []string
+
+// Scan implements the sql.Scanner interface, reading a PostgreSQL array
+func (g *Genres) Scan(src any) error {
+	return arrayScanner((*[]string)(g)).(sql.Scanner).Scan(src)
+}
+
+// Value implements the driver.Valuer interface, writing a PostgreSQL array literal
+// such as {drama,comedy}, or NULL for nil genres, like lib/pq's Array
+// did.
+func (g Genres) Value() (driver.Value, error) {
+	if g == nil {
+		return nil, nil
+	}
+
+	buf, err := pgtype.NewMap().Encode(pgtype.TextArrayOID, pgtype.TextFormatCode, []string(g), nil)
+	if err != nil {
+		return nil, err
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,270 @@
+//go:build integration
+
+// The integration tests run the models against a PostgreSQL container, and need
+// Docker. They are left out of go test ./... unless the integration tag is set:
+//
+//	go test -tags integration ./internal/data
+package data_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/data"
+	"github.com/aviagarwal1212/greenlight/internal/migrate"
+	"github.com/aviagarwal1212/greenlight/migrations"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// models are the models of the migrated database of the container started by
+// TestMain
+var models data.Models
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run starts a PostgreSQL container, applies the migrations to it, and runs the
+// tests against it. It returns the exit code of the tests.
+func run(m *testing.M) int {
+	ctx := context.Background()
+
+	container, err := postgres.Run(ctx, "postgres:16-alpine",
+		postgres.WithDatabase("greenlight"),
+		postgres.WithUsername("greenlight"),
+		postgres.WithPassword("greenlight"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		),
+	)
+	if err != nil {
+		println(err.Error())
+		return 1
+	}
+	defer container.Terminate(ctx)
+
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		println(err.Error())
+		return 1
+	}
+
+	db, pool, err := data.OpenDB(data.DBConfig{DSN: dsn, MaxConns: 5, MaxConnIdleTime: time.Minute})
+	if err != nil {
+		println(err.Error())
+		return 1
+	}
+	defer pool.Close()
+	defer db.Close()
+
+	migrator, err := migrate.New(db.DB, migrations.FS)
+	if err != nil {
+		println(err.Error())
+		return 1
+	}
+	_, err = migrator.Up(ctx)
+	if err != nil {
+		println(err.Error())
+		return 1
+	}
+
+	models = data.NewModel(db)
+	return m.Run()
+}
+
+// newMovie returns a valid movie which is not inserted yet
+func newMovie(title string) *data.Movie {
+	return &data.Movie{
+		Title:   title,
+		Year:    1979,
+		Runtime: 117,
+		Genres:  []string{"horror", "sci-fi"},
+	}
+}
+
+func TestMovieInsertAndGet(t *testing.T) {
+	movie := newMovie("Alien")
+
+	err := models.Movies.Insert(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.ID == 0 || movie.UUID == "" || movie.Version != 1 {
+		t.Fatalf("got ID %d, UUID %q and version %d after the insert", movie.ID, movie.UUID, movie.Version)
+	}
+
+	got, err := models.Movies.Get(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != movie.Title || got.Year != movie.Year || got.Runtime != movie.Runtime {
+		t.Errorf("got %+v; want %+v", got, movie)
+	}
+
+	byUUID, err := models.Movies.GetByUUID(movie.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byUUID.ID != movie.ID {
+		t.Errorf("got ID %d by UUID; want %d", byUUID.ID, movie.ID)
+	}
+}
+
+func TestMovieGenresRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		genres []string
+	}{
+		{"one genre", []string{"drama"}},
+		{"several genres", []string{"action", "sci-fi", "thriller"}},
+		{"quotes and commas", []string{`film "noir"`, "comedy, dark", `back\slash`}},
+		{"non-ascii", []string{"ciencia ficción", "アニメ"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := newMovie("Genres: " + tt.name)
+			movie.Genres = tt.genres
+
+			err := models.Movies.Insert(movie)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := models.Movies.Get(movie.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Genres, tt.genres) {
+				t.Errorf("got genres %q; want %q", got.Genres, tt.genres)
+			}
+		})
+	}
+}
+
+func TestMovieUpdate(t *testing.T) {
+	movie := newMovie("The Thing")
+
+	err := models.Movies.Insert(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movie.Year = 1982
+	movie.Genres = []string{"horror"}
+	err = models.Movies.Update(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Version != 2 {
+		t.Errorf("got version %d after the update; want 2", movie.Version)
+	}
+
+	got, err := models.Movies.Get(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Year != 1982 || !slices.Equal(got.Genres, []string{"horror"}) {
+		t.Errorf("got year %d and genres %q after the update", got.Year, got.Genres)
+	}
+}
+
+func TestMovieUpdateEditConflict(t *testing.T) {
+	movie := newMovie("Blade Runner")
+
+	err := models.Movies.Insert(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two clients read the same version, and the second update loses
+	first, err := models.Movies.Get(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := models.Movies.Get(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.Year = 1982
+	err = models.Movies.Update(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.Year = 2049
+	err = models.Movies.Update(second)
+	if !errors.Is(err, data.ErrEditConflict) {
+		t.Fatalf("got error %v; want ErrEditConflict", err)
+	}
+}
+
+func TestMovieDelete(t *testing.T) {
+	movie := newMovie("Solaris")
+
+	err := models.Movies.Insert(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Movies.Delete(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = models.Movies.Get(movie.ID)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("got error %v after the delete; want ErrRecordNotFound", err)
+	}
+
+	err = models.Movies.Delete(movie.ID)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("got error %v deleting twice; want ErrRecordNotFound", err)
+	}
+}
+
+func TestMovieDeleteManyByFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		title  string
+		year   int32
+		filter data.MovieFilter
+	}{
+		{"title only", "Zardoz", 1974, data.MovieFilter{Title: "Zardoz"}},
+		{"year only", "Metropolis", 1927, data.MovieFilter{YearAfter: 1926, YearBefore: 1928}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := newMovie(tt.title)
+			movie.Year = tt.year
+
+			err := models.Movies.Insert(movie)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			deleted, err := models.Movies.DeleteMany(nil, nil, &tt.filter, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(deleted) != 1 || deleted[0].ID != movie.ID {
+				t.Fatalf("deleted %d movies; want only movie %d", len(deleted), movie.ID)
+			}
+
+			_, err = models.Movies.Get(movie.ID)
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				t.Errorf("got error %v after the delete; want ErrRecordNotFound", err)
+			}
+		})
+	}
+}
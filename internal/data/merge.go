@@ -0,0 +1,152 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Merge folds the duplicate movie into the target movie and deletes it, in a single
+// transaction. The target keeps its own details, and takes the IMDb ID and the links
+// of the duplicate which it doesn't have; the views of the duplicate are added to its
+// own. The duplicate leaves behind a redirect to the target, and the redirects to the
+// duplicate are moved to the target, so that Redirect resolves its ID and UUID.
+//
+// It returns the updated target, or ErrRecordNotFound if either movie doesn't exist.
+// The movie.deleted event of the duplicate and the movie.updated event of the target
+// are recorded in the outbox.
+func (m MovieModel) Merge(targetID, duplicateID int64) (*Movie, error) {
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 5*time.Second)
+	defer cancel()
+
+	var target *Movie
+
+	err := withTx(ctx, m.DB, func(tx *sqlx.Tx) error {
+		// both movies are locked, in the order of their IDs so that concurrent merges
+		// of the same movies cannot deadlock
+		query := `
+			SELECT ` + movieColumns + `
+			FROM movies
+			WHERE tenant_id = $1 AND id = ANY($2)
+			ORDER BY id
+			FOR UPDATE`
+
+		rows, err := tx.QueryxContext(ctx, query, m.tenantID(), []int64{targetID, duplicateID})
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var duplicate *Movie
+		for rows.Next() {
+			movie, err := scanMovie(rows)
+			if err != nil {
+				return err
+			}
+			if movie.ID == targetID {
+				target = movie
+			} else {
+				duplicate = movie
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if target == nil || duplicate == nil {
+			return ErrRecordNotFound
+		}
+
+		err = m.foldDuplicate(ctx, tx, target, duplicate)
+		if err != nil {
+			return err
+		}
+
+		deleted := movieDeleted{UUID: duplicate.UUID, Version: duplicate.Version}
+		err = enqueueOutbox(ctx, tx, MoviesTopic, "movie.deleted", deleted.UUID, deleted)
+		if err != nil {
+			return err
+		}
+
+		return enqueueOutbox(ctx, tx, MoviesTopic, "movie.updated", target.UUID, target)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.uncache(targetID, duplicateID)
+	return target, nil
+}
+
+// foldDuplicate moves the views, redirects, IMDb ID and links of the duplicate to the
+// target, deletes the duplicate, and updates the target
+func (m MovieModel) foldDuplicate(ctx context.Context, tx *sqlx.Tx, target, duplicate *Movie) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO movie_views (movie_id, bucket, views)
+		SELECT $1, bucket, views FROM movie_views WHERE movie_id = $2
+		ON CONFLICT (movie_id, bucket) DO UPDATE SET views = movie_views.views + EXCLUDED.views`,
+		target.ID, duplicate.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movie_redirects SET movie_id = $1 WHERE movie_id = $2`, target.ID, duplicate.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO movie_redirects (old_id, old_uuid, tenant_id, movie_id)
+		VALUES ($1, $2, $3, $4)`,
+		duplicate.ID, duplicate.UUID, m.tenantID(), target.ID)
+	if err != nil {
+		return err
+	}
+
+	// the duplicate is deleted before the target takes its IMDb ID, which is unique;
+	// its views are deleted with it
+	_, err = tx.ExecContext(ctx, `DELETE FROM movies WHERE id = $1`, duplicate.ID)
+	if err != nil {
+		return err
+	}
+
+	if target.IMDbID == "" {
+		target.IMDbID = duplicate.IMDbID
+	}
+	if target.Links.TrailerURL == "" {
+		target.Links.TrailerURL = duplicate.Links.TrailerURL
+	}
+	if target.Links.Homepage == "" {
+		target.Links.Homepage = duplicate.Links.Homepage
+	}
+	if target.Links.Wiki == "" {
+		target.Links.Wiki = duplicate.Links.Wiki
+	}
+
+	query := `
+	UPDATE movies
+	SET imdb_id = NULLIF(:imdb_id, ''), trailer_url = :links.trailer_url, homepage = :links.homepage, wiki = :links.wiki,
+		version = version + 1
+	WHERE id = :id
+	RETURNING version`
+
+	return namedQueryRow(ctx, tx, query, target).StructScan(target)
+}
+
+// Redirect returns the movie which the merged movie with the given ID, or UUID if it
+// is not empty, was merged into. It returns ErrRecordNotFound if no movie with that
+// ID or UUID was merged.
+func (m MovieModel) Redirect(id int64, uuid string) (*Movie, error) {
+	query := `
+		SELECT ` + movieColumns + `
+		FROM movies
+		WHERE tenant_id = $1 AND id = (
+			SELECT movie_id FROM movie_redirects
+			WHERE tenant_id = $1 AND (old_id = $2 OR old_uuid::text = $3)
+		)`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	return scanMovie(m.DB.QueryRowxContext(ctx, query, m.tenantID(), id, uuid))
+}
@@ -1,9 +1,11 @@
 package data
 
 import (
+	"context"
 	"errors"
 
 	"github.com/jmoiron/sqlx"
+	"golang.org/x/sync/singleflight"
 )
 
 var (
@@ -12,11 +14,96 @@ var (
 )
 
 type Models struct {
-	Movies MovieModel
+	Movies            MovieModel
+	Views             ViewModel
+	Webhooks          WebhookModel
+	WebhookDeliveries WebhookDeliveryModel
+	Outbox            OutboxModel
+	Tenants           TenantModel
+	Usage             UsageModel
+	// db is what the models run their queries against
+	db DBTX
 }
 
 func NewModel(db *sqlx.DB) Models {
 	return Models{
-		Movies: MovieModel{DB: db},
+		Movies:            MovieModel{DB: db, reads: new(singleflight.Group)},
+		Views:             ViewModel{DB: db},
+		Webhooks:          WebhookModel{DB: db},
+		WebhookDeliveries: WebhookDeliveryModel{DB: db},
+		Outbox:            OutboxModel{DB: db},
+		Tenants:           TenantModel{DB: db},
+		Usage:             UsageModel{DB: db},
+		db:                db,
 	}
 }
+
+// WithContext returns a copy of the models whose queries carry the values of ctx,
+// such as the request ID, so that they can be attributed to the request making them,
+// and the tenant, which the movie queries are scoped to. The queries are not
+// cancelled with ctx, and keep their own timeouts.
+func (m Models) WithContext(ctx context.Context) Models {
+	ctx = context.WithoutCancel(ctx)
+
+	m.Movies.ctx = ctx
+	m.Views.ctx = ctx
+	m.Webhooks.ctx = ctx
+	m.WebhookDeliveries.ctx = ctx
+	m.Outbox.ctx = ctx
+	m.Tenants.ctx = ctx
+	m.Usage.ctx = ctx
+
+	return m
+}
+
+// Primary returns a copy of the models whose movie lookups read from the primary,
+// even when there is a read replica, and neither hit the movie cache nor coalesce
+// with other reads. The reads which precede a write must use it: the replica lags
+// behind the primary, so a movie just created may not be found on it, and a movie
+// just updated may be found at its previous version, which fails the write with
+// ErrEditConflict.
+func (m Models) Primary() Models {
+	m.Movies.primary = true
+	m.Movies.reads = nil
+
+	return m
+}
+
+// WithTx runs fn with copies of the models whose queries all run in a single
+// transaction, which is committed if fn returns nil and rolled back otherwise, so
+// that changes to several entities are made atomically:
+//
+//	err := app.models.WithTx(ctx, func(tx data.Models) error {
+//		err := tx.Movies.Insert(movie)
+//		if err != nil {
+//			return err
+//		}
+//		return tx.Webhooks.Insert(webhook)
+//	})
+//
+// The copies don't read from the replica, nor use or coalesce through the movie
+// cache, so that they see the changes of the transaction. The cache is emptied once
+// the transaction is committed. Calling WithTx on the copies runs fn in a savepoint.
+func (m Models) WithTx(ctx context.Context, fn func(tx Models) error) error {
+	err := withTx(ctx, m.db, func(tx *sqlx.Tx) error {
+		return fn(Models{
+			Movies:            MovieModel{DB: tx, ctx: m.Movies.ctx},
+			Views:             ViewModel{DB: tx, ctx: m.Views.ctx},
+			Webhooks:          WebhookModel{DB: tx, ctx: m.Webhooks.ctx},
+			WebhookDeliveries: WebhookDeliveryModel{DB: tx, ctx: m.WebhookDeliveries.ctx},
+			Outbox:            OutboxModel{DB: tx, ctx: m.Outbox.ctx},
+			Tenants:           TenantModel{DB: tx, ctx: m.Tenants.ctx},
+			Usage:             UsageModel{DB: tx, ctx: m.Usage.ctx},
+			db:                tx,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if m.Movies.Cache != nil {
+		m.Movies.Cache.clear()
+	}
+
+	return nil
+}
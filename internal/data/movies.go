@@ -3,28 +3,56 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
+	"slices"
 	"time"
 
 	"github.com/aviagarwal1212/greenlight/internal/validator"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
-	"github.com/lib/pq"
+	"golang.org/x/sync/singleflight"
 )
 
+// IMDbIDRX matches IMDb title IDs such as tt0111161
+var IMDbIDRX = regexp.MustCompile(`^tt[0-9]{7,10}$`)
+
+// ErrDuplicateIMDbID is returned when another movie already has the same IMDb ID
+var ErrDuplicateIMDbID = errors.New("duplicate imdb id")
+
+// Movie is a movie of the catalog of a tenant. Its db tags name the columns it is
+// read from and the named parameters of the queries which write it. The sequential
+// ID is left out of its JSON, so that the UUID is its only public identifier.
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID        int64      `json:"-" db:"id"`
+	UUID      string     `json:"uuid" db:"uuid"`
+	TenantID  int64      `json:"-" db:"tenant_id"`
+	CreatedAt time.Time  `json:"-" db:"created_at"`
+	Title     string     `json:"title" db:"title" validate:"required,max=500"`
+	Slug      string     `json:"slug" db:"slug"`
+	IMDbID    string     `json:"imdb_id,omitempty" db:"imdb_id"`
+	Year      int32      `json:"year,omitempty" db:"year"`
+	Runtime   Runtime    `json:"runtime,omitempty" db:"runtime"`
+	Genres    Genres     `json:"genres,omitempty" db:"genres"`
+	Links     MovieLinks `json:"links" db:"links"`
+	Version   int32      `json:"version" db:"version"`
+}
+
+// MovieLinks holds the external links for a movie. An empty string means
+// the link has not been set. Its columns are read as "links.trailer_url" and so on.
+type MovieLinks struct {
+	TrailerURL string `json:"trailer_url,omitempty" db:"trailer_url" validate:"url,max=2048"`
+	Homepage   string `json:"homepage,omitempty" db:"homepage" validate:"url,max=2048"`
+	Wiki       string `json:"wiki,omitempty" db:"wiki" validate:"url,max=2048"`
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
-	// title checks
-	v.Check(movie.Title != "", "title", "must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
+	// the title and link checks are declared by the validate tags
+	validator.ValidateStruct(v, movie)
 	// release year checks
 	v.Check(movie.Year != 0, "year", "must be provided")
 	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
@@ -34,72 +62,668 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
 	// genre checks
 	v.Check(movie.Genres != nil, "genres", "must be provided")
-	v.Check(movie.Genres != nil, "genres", "must contain atleast 1 genre")
-	v.Check(movie.Genres != nil, "genres", "must not contain more than 5 genres")
+	v.Check(validator.MinItems(movie.Genres, 1), "genres", "must contain at least 1 genre")
+	v.Check(validator.MaxItems(movie.Genres, 5), "genres", "must not contain more than 5 genres")
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+	// external id checks
+	v.Check(movie.IMDbID == "" || validator.Match(movie.IMDbID, IMDbIDRX), "imdb_id", "must be a valid IMDb title ID (e.g. tt0111161)")
 }
 
 type MovieModel struct {
-	DB *sqlx.DB
+	DB DBTX
+	// ctx is the parent context of the queries, set by Models.WithContext
+	ctx context.Context
+	// Cache holds recently read movies for Get; nil disables caching
+	Cache *MovieCache
+	// Replica is a read replica used by the lookups and listings, or nil to read
+	// from DB. Reads fall back to DB when the replica fails. As replicas lag behind
+	// the primary, a movie may not be found on it right after being created, so
+	// reads which precede a write go through Models.Primary.
+	Replica *sqlx.DB
+	// primary makes the lookups read from DB, past the replica and the cache; it
+	// is set by Models.Primary
+	primary bool
+	// reads coalesces concurrent identical reads of Get, GetAll and Recent
+	reads *singleflight.Group
+}
+
+// tenantID returns the tenant whose catalog the queries of the model are scoped to
+func (m MovieModel) tenantID() int64 {
+	return TenantID(m.ctx)
 }
 
 // Insert adds a new record for a movie to the database. If the insertion is successful,
 // the ID, CreatedAt, and Version fields of the movie are populated with the respective values
 // from the database. If any error occurs during the insertion, it returns that error.
+//
+// A unique slug is generated from the title; if the slug is already taken a numeric
+// suffix is added ("alien", "alien-2", "alien-3", ...).
 func (m MovieModel) Insert(movie *Movie) error {
-	query := `
-	INSERT INTO movies (title, year, runtime, genres)
-	VALUES ($1, $2, $3, $4)
-	RETURNING id, created_at, version`
+	// create a context for 3-seconds
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	// retry when a concurrent insert claims the same slug between the lookup and the insert
+	for attempt := 0; ; attempt++ {
+		err := withTx(ctx, m.DB, func(tx *sqlx.Tx) error {
+			return m.insert(ctx, tx, movie)
+		})
+		if isSlugConflict(err) && attempt < 3 {
+			continue
+		}
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+		return err
+	}
+}
 
-	// create a context for 3-seconds
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// InsertAll inserts the movies in a single transaction, so that either all of them
+// are inserted or, if any insert fails, none are.
+func (m MovieModel) InsertAll(movies []*Movie) error {
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), bulkTimeout(len(movies)))
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, movie := range movies {
+		err := m.insert(ctx, tx, movie)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// InsertEach inserts the movies in a single transaction, isolating each insert in a
+// savepoint so that a movie which fails to insert is skipped without affecting the
+// others. It returns one error per movie (nil for the movies that were inserted),
+// and a separate error if the transaction itself failed.
+func (m MovieModel) InsertEach(movies []*Movie) ([]error, error) {
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), bulkTimeout(len(movies)))
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	errs := make([]error, len(movies))
+
+	for i, movie := range movies {
+		_, err := tx.ExecContext(ctx, "SAVEPOINT insert_movie")
+		if err != nil {
+			return nil, err
+		}
+
+		errs[i] = m.insert(ctx, tx, movie)
+		if errs[i] != nil {
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT insert_movie")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT insert_movie")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return errs, tx.Commit()
+}
+
+// InsertMany inserts the movies in a single transaction with the COPY protocol, which
+// is much faster than inserting them one at a time for large imports. Either all of
+// the movies are inserted or none are; if any of them has the IMDb ID of an existing
+// movie, ErrDuplicateIMDbID is returned. The ID, UUID, CreatedAt, Slug and Version
+// fields of the movies are populated as by Insert.
+func (m MovieModel) InsertMany(movies []*Movie) error {
+	// COPY needs a connection of its own, so in a transaction the movies are
+	// inserted one at a time
+	db, ok := m.DB.(*sqlx.DB)
+	if !ok {
+		return m.InsertAll(movies)
+	}
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), bulkTimeout(len(movies)))
 	defer cancel()
 
-	err := m.DB.QueryRowxContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// COPY is only available through the pgx connection itself
+	return conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+
+		// retry when a concurrent insert claims one of the slugs between the lookup
+		// and the copy
+		for attempt := 0; ; attempt++ {
+			err := pgx.BeginFunc(ctx, pgxConn, func(tx pgx.Tx) error {
+				return m.copyMovies(ctx, tx, movies)
+			})
+			if isSlugConflict(err) && attempt < 3 {
+				continue
+			}
+			if isUniqueViolation(err, "movies_imdb_id_key") {
+				return ErrDuplicateIMDbID
+			}
+
+			return err
+		}
+	})
+}
+
+// copyMovies copies the movies into the movies table, reads back the columns set by
+// the database, and records their movie.created events in the outbox
+func (m MovieModel) copyMovies(ctx context.Context, tx pgx.Tx, movies []*Movie) error {
+	tenantID := m.tenantID()
+
+	slugs, err := uniqueSlugs(ctx, tx, tenantID, movies)
+	if err != nil {
+		return err
+	}
+
+	columns := []string{"tenant_id", "title", "slug", "imdb_id", "year", "runtime", "genres", "trailer_url", "homepage", "wiki"}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"movies"}, columns, pgx.CopyFromSlice(len(movies), func(i int) ([]any, error) {
+		movie := movies[i]
+
+		var imdbID any
+		if movie.IMDbID != "" {
+			imdbID = movie.IMDbID
+		}
+
+		return []any{tenantID, movie.Title, slugs[i], imdbID, movie.Year, int32(movie.Runtime), movie.Genres, movie.Links.TrailerURL, movie.Links.Homepage, movie.Links.Wiki}, nil
+	}))
+	if err != nil {
+		return err
+	}
+
+	// the slugs are unique, so they identify the copied rows
+	rows, err := tx.Query(ctx, `SELECT slug, id, uuid, created_at, version FROM movies WHERE tenant_id = $1 AND slug = ANY($2)`, tenantID, slugs)
+	if err != nil {
+		return err
+	}
+
+	bySlug := make(map[string]*Movie, len(movies))
+	for i, movie := range movies {
+		bySlug[slugs[i]] = movie
+	}
+
+	for rows.Next() {
+		var slug string
+		var created Movie
+
+		err := rows.Scan(&slug, &created.ID, &created.UUID, &created.CreatedAt, &created.Version)
+		if err != nil {
+			return err
+		}
+
+		movie := bySlug[slug]
+		movie.ID, movie.UUID, movie.CreatedAt, movie.Version, movie.Slug = created.ID, created.UUID, created.CreatedAt, created.Version, slug
+		movie.TenantID = tenantID
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	outbox := make([][]any, len(movies))
+	for i, movie := range movies {
+		js, err := json.Marshal(movie)
+		if err != nil {
+			return err
+		}
+		outbox[i] = []any{tenantID, MoviesTopic, "movie.created", movie.UUID, json.RawMessage(js)}
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"outbox"}, []string{"tenant_id", "topic", "event_type", "key", "payload"}, pgx.CopyFromRows(outbox))
 	return err
 }
 
+// uniqueSlugs returns a slug for each of the movies which is unique in the catalog
+// of the tenant, generated as by uniqueSlug but with a single query for the whole
+// batch, and without giving two of the movies the same slug
+func uniqueSlugs(ctx context.Context, tx pgx.Tx, tenantID int64, movies []*Movie) ([]string, error) {
+	bases := make([]string, len(movies))
+	patterns := make([]string, len(movies))
+	for i, movie := range movies {
+		bases[i] = Slugify(movie.Title)
+		patterns[i] = bases[i] + "-%"
+	}
+
+	rows, err := tx.Query(ctx, `SELECT slug FROM movies WHERE tenant_id = $1 AND (slug = ANY($2) OR slug LIKE ANY($3))`, tenantID, bases, patterns)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool, len(existing)+len(movies))
+	for _, slug := range existing {
+		taken[slug] = true
+	}
+
+	slugs := make([]string, len(movies))
+	for i, base := range bases {
+		slug := base
+		for n := 2; taken[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[slug] = true
+		slugs[i] = slug
+	}
+
+	return slugs, nil
+}
+
+// bulkTimeout scales the query timeout with the number of rows in a bulk operation
+func bulkTimeout(n int) time.Duration {
+	return 3*time.Second + time.Duration(n)*50*time.Millisecond
+}
+
+// insert runs the insert for a single movie in a transaction, and records the
+// movie.created event in the outbox
+func (m MovieModel) insert(ctx context.Context, q sqlx.ExtContext, movie *Movie) error {
+	query := `
+	INSERT INTO movies (tenant_id, title, slug, imdb_id, year, runtime, genres, trailer_url, homepage, wiki)
+	VALUES (:tenant_id, :title, :slug, NULLIF(:imdb_id, ''), :year, :runtime, :genres, :links.trailer_url, :links.homepage, :links.wiki)
+	RETURNING id, uuid, created_at, version`
+
+	slug, err := m.uniqueSlug(ctx, q, Slugify(movie.Title), 0)
+	if err != nil {
+		return err
+	}
+
+	movie.Slug = slug
+	movie.TenantID = m.tenantID()
+
+	err = namedQueryRow(ctx, q, query, movie).StructScan(movie)
+	if err != nil {
+		if isUniqueViolation(err, "movies_imdb_id_key") {
+			return ErrDuplicateIMDbID
+		}
+		return err
+	}
+
+	return enqueueOutbox(ctx, q, MoviesTopic, "movie.created", movie.UUID, movie)
+}
+
+// uniqueSlug returns base if no other movie of the tenant uses it yet, otherwise base
+// with the lowest free numeric suffix. The movie with excludeID is ignored, so that regenerating
+// the slug of an existing movie can keep its current value.
+func (m MovieModel) uniqueSlug(ctx context.Context, q sqlx.QueryerContext, base string, excludeID int64) (string, error) {
+	query := `
+	SELECT slug
+	FROM movies
+	WHERE tenant_id = $1 AND (slug = $2 OR slug LIKE $3) AND id <> $4`
+
+	// slugs only contain [a-z0-9-], so base never contains LIKE wildcards
+	var taken []string
+	err := sqlx.SelectContext(ctx, q, &taken, query, m.tenantID(), base, base+"-%", excludeID)
+	if err != nil {
+		return "", err
+	}
+
+	if !slices.Contains(taken, base) {
+		return base, nil
+	}
+
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d", base, n)
+		if !slices.Contains(taken, candidate) {
+			return candidate, nil
+		}
+	}
+}
+
+// isSlugConflict reports whether err is a unique violation on the slug column
+func isSlugConflict(err error) bool {
+	return isUniqueViolation(err, "movies_slug_key")
+}
+
+// isUniqueViolation reports whether err is a violation of the named unique constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
+
+// movieColumns lists the columns of a movie, named after the db tags of Movie so that
+// they can be read with StructScan. Columns may be added in any position.
+const movieColumns = `id, uuid, tenant_id, created_at, title, slug, coalesce(imdb_id, '') AS imdb_id, year, runtime, genres,
+	trailer_url AS "links.trailer_url", homepage AS "links.homepage", wiki AS "links.wiki", version`
+
+// rowScanner is implemented by both *sqlx.Row and *sqlx.Rows
+type rowScanner interface {
+	StructScan(dest any) error
+}
+
+// scanMovie reads a single row selected with movieColumns, converting sql.ErrNoRows
+// into ErrRecordNotFound
+func scanMovie(row rowScanner) (*Movie, error) {
+	var movie Movie
+
+	err := row.StructScan(&movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
 // Get retrieves a movie from the database by its ID. If the movie with the specified ID is not found,
 // it returns an ErrRecordNotFound error. If any other error occurs during the query, it returns that error.
+//
+// If the model has a Cache, movies are read from it when they are cached, and cached
+// after being read from the database. Concurrent reads of the same movie from the
+// database are made as a single query.
 func (m MovieModel) Get(id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
+	read := func() (*Movie, error) {
+		return coalesce(m.reads, fmt.Sprintf("%d:get:%d", m.tenantID(), id), func() (*Movie, error) {
+			return readReplica(m, func(db DBTX) (*Movie, error) {
+				return m.get(db, id)
+			})
+		}, copyMovie)
+	}
+
+	if m.Cache == nil {
+		return read()
+	}
+
+	// the cache is shared by every tenant, so a movie of another tenant is a miss.
+	// Reads of the primary skip it, as the write they precede needs the current
+	// version of the movie.
+	movie, generation := m.Cache.get(id)
+	if movie != nil && movie.TenantID == m.tenantID() && !m.primary {
+		return movie, nil
+	}
+
+	movie, err := read()
+	if err != nil {
+		return nil, err
+	}
+	m.Cache.put(movie, generation, m.Replica != nil && !m.primary)
+
+	return movie, nil
+}
+
+// get reads a movie from the database by its ID
+func (m MovieModel) get(db DBTX, id int64) (*Movie, error) {
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT ` + movieColumns + `
 		FROM movies
-		WHERE id = $1`
-
-	var movie Movie
+		WHERE tenant_id = $1 AND id = $2`
 
 	// 3 second timeout for the query
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
 	defer cancel()
 
-	// response of pg_sleep(8) is stored in an empty byte
 	// using QueryRowxContext to pass in the context to the query
-	err := m.DB.QueryRowxContext(ctx, query, id).Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, pq.Array(&movie.Genres), &movie.Version)
+	return scanMovie(db.QueryRowxContext(ctx, query, m.tenantID(), id))
+}
+
+// GetByUUID retrieves a movie from the database by its public UUID. If the movie is not
+// found, it returns an ErrRecordNotFound error.
+func (m MovieModel) GetByUUID(uuid string) (*Movie, error) {
+	if !validator.Match(uuid, validator.UUIDRX) {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + movieColumns + `
+		FROM movies
+		WHERE tenant_id = $1 AND uuid = $2`
+
+	return readReplica(m, func(db DBTX) (*Movie, error) {
+		ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+		defer cancel()
+
+		return scanMovie(db.QueryRowxContext(ctx, query, m.tenantID(), uuid))
+	})
+}
+
+// GetBySlug retrieves a movie from the database by its slug. If no movie has the slug,
+// it returns an ErrRecordNotFound error.
+func (m MovieModel) GetBySlug(slug string) (*Movie, error) {
+	query := `
+		SELECT ` + movieColumns + `
+		FROM movies
+		WHERE tenant_id = $1 AND slug = $2`
+
+	return readReplica(m, func(db DBTX) (*Movie, error) {
+		ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+		defer cancel()
+
+		return scanMovie(db.QueryRowxContext(ctx, query, m.tenantID(), slug))
+	})
+}
+
+// GetAll returns a page of movies matching the filters. An empty title matches every
+// movie, otherwise the title is matched with full-text search; genres matches movies
+// having all of the given genres. Concurrent identical listings are made as a single
+// query.
+func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	type page struct {
+		movies   []*Movie
+		metadata Metadata
+	}
+
+	key := fmt.Sprintf("%d:getAll:%q:%q:%d:%d:%s", m.tenantID(), title, genres, filters.Page, filters.PageSize, filters.Sort)
+	p, err := coalesce(m.reads, key, func() (page, error) {
+		return readReplica(m, func(db DBTX) (page, error) {
+			movies, metadata, err := m.getAll(db, title, genres, filters)
+			return page{movies, metadata}, err
+		})
+	}, func(p page) page {
+		return page{copyMovies(p.movies), p.metadata}
+	})
+
+	return p.movies, p.metadata, err
+}
+
+func (m MovieModel) getAll(db DBTX, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	// the sort column and direction are interpolated, as placeholders cannot be used
+	// for them; both come from the safelist checked by sortColumn
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER() AS total_records, %s
+		FROM movies
+		WHERE tenant_id = $1
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (genres @> $3 OR $3 = '{}')
+		ORDER BY %s %s, id ASC
+		LIMIT $4 OFFSET $5`, movieColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	args := []any{m.tenantID(), title, genres, filters.limit(), filters.offset()}
+
+	rows, err := db.QueryxContext(ctx, query, args...)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
-		default:
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var row struct {
+			Movie
+			TotalRecords int `db:"total_records"`
+		}
+
+		err := rows.StructScan(&row)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		totalRecords = row.TotalRecords
+		movies = append(movies, &row.Movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// Each calls fn with every movie matching the title and genres, in the order given by
+// the sort of filters (the page and page size are ignored). The rows are read from
+// the database one at a time, so that a large listing can be streamed to the client
+// without holding it in memory. Iteration stops at the first error returned by fn.
+//
+// Unlike the other queries, Each takes its context from the caller, as the time it
+// takes depends on how fast the caller consumes the movies; the movies are those of
+// the tenant carried by ctx.
+func (m MovieModel) Each(ctx context.Context, title string, genres []string, filters Filters, fn func(*Movie) error) error {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM movies
+		WHERE tenant_id = $1
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (genres @> $3 OR $3 = '{}')
+		ORDER BY %s %s, id ASC`, movieColumns, filters.sortColumn(), filters.sortDirection())
+
+	rows, err := m.DB.QueryxContext(ctx, query, TenantID(ctx), title, genres)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		movie, err := scanMovie(rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(movie)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetMany returns the movies with any of the given IDs or UUIDs, in no particular
+// order. IDs or UUIDs without a matching movie are simply absent from the result.
+func (m MovieModel) GetMany(ids []int64, uuids []string) ([]*Movie, error) {
+	query := `
+		SELECT ` + movieColumns + `
+		FROM movies
+		WHERE tenant_id = $1 AND (id = ANY($2) OR uuid = ANY($3::uuid[]))`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, m.tenantID(), ids, uuids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		movie, err := scanMovie(rows)
+		if err != nil {
 			return nil, err
 		}
+		movies = append(movies, movie)
 	}
 
-	return &movie, nil
+	return movies, rows.Err()
+}
+
+// ExistingIMDbIDs reports which of the given IMDb IDs already belong to a movie.
+func (m MovieModel) ExistingIMDbIDs(imdbIDs []string) (map[string]bool, error) {
+	query := `
+		SELECT imdb_id
+		FROM movies
+		WHERE tenant_id = $1 AND imdb_id = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	var found []string
+	err := sqlx.SelectContext(ctx, m.DB, &found, query, m.tenantID(), imdbIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(found))
+	for _, id := range found {
+		existing[id] = true
+	}
+
+	return existing, nil
+}
+
+// Recent returns up to limit movies, newest first by the time they were added.
+// Concurrent calls with the same limit are made as a single query.
+func (m MovieModel) Recent(limit int) ([]*Movie, error) {
+	return coalesce(m.reads, fmt.Sprintf("%d:recent:%d", m.tenantID(), limit), func() ([]*Movie, error) {
+		return m.recent(limit)
+	}, copyMovies)
+}
+
+func (m MovieModel) recent(limit int) ([]*Movie, error) {
+	query := `
+		SELECT ` + movieColumns + `
+		FROM movies
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, m.tenantID(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		movie, err := scanMovie(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, movie)
+	}
+
+	return movies, rows.Err()
 }
 
 // Update updates an existing movie record in the movies table with the
 // details provided in the movie parameter. It updates the title, year,
-// runtime, genres, and automatically increments the version. The updated
+// runtime, genres, links, and automatically increments the version. The updated
 // version is returned and set in the movie object.
 //
+// The slug is kept as-is so that links stay stable across title edits. Setting
+// movie.Slug to an empty string regenerates it from the current title.
+//
 // Parameters:
 // - movie: A pointer to the Movie struct containing the updated details.
 //
@@ -125,35 +749,247 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 //   - The function presumes that the version field in the Movie struct is
 //     meant to track the update count and ensures it is incremented upon
 //     each update.
+//   - The movie is removed from the cache once the update is committed.
 func (m MovieModel) Update(movie *Movie) error {
 	query := `
 	UPDATE movies
-	SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-	WHERE id = $5 AND version = $6
+	SET title = :title, slug = :slug, imdb_id = NULLIF(:imdb_id, ''), year = :year, runtime = :runtime, genres = :genres,
+		trailer_url = :links.trailer_url, homepage = :links.homepage, wiki = :links.wiki, version = version + 1
+	WHERE id = :id AND version = :version AND tenant_id = :tenant_id
 	RETURNING version`
 
-	// movie.Genres have to be transformed to a postgreSQL array
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
-
 	// add a three-second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
 	defer cancel()
 
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if movie.Slug == "" {
+		movie.Slug, err = m.uniqueSlug(ctx, tx, Slugify(movie.Title), movie.ID)
+		if err != nil {
+			return err
+		}
+	}
+	movie.TenantID = m.tenantID()
+
 	// execute the SQL query.
 	// if no matching row is found, it returns ErrEditConflict
-	err := m.DB.QueryRowxContext(ctx, query, args...).Scan(&movie.Version)
+	err = namedQueryRow(ctx, tx, query, movie).StructScan(movie)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
+			// the movie may have been read from an out of date cache entry
+			m.uncache(movie.ID)
+			return ErrEditConflict
+		case isSlugConflict(err):
 			return ErrEditConflict
+		case isUniqueViolation(err, "movies_imdb_id_key"):
+			return ErrDuplicateIMDbID
 		default:
 			return err
 		}
 	}
 
+	err = enqueueOutbox(ctx, tx, MoviesTopic, "movie.updated", movie.UUID, movie)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.uncache(movie.ID)
 	return nil
 }
 
+// uncache removes movies which have been changed from the cache, if there is one
+func (m MovieModel) uncache(ids ...int64) {
+	if m.Cache != nil {
+		m.Cache.remove(ids...)
+	}
+}
+
+// Upsert creates the movie if no movie has its IMDb ID yet, and otherwise updates the
+// existing movie with the given details, in a single INSERT ... ON CONFLICT statement.
+// The ID, UUID, CreatedAt, Slug and Version fields of movie are populated from the
+// stored record, and the returned boolean reports whether the movie was created.
+//
+// Updates keep the existing slug, and are not checked against a version, as the
+// request replaces the record as a whole.
+func (m MovieModel) Upsert(movie *Movie) (bool, error) {
+	query := `
+	INSERT INTO movies (tenant_id, title, slug, imdb_id, year, runtime, genres, trailer_url, homepage, wiki)
+	VALUES (:tenant_id, :title, :slug, :imdb_id, :year, :runtime, :genres, :links.trailer_url, :links.homepage, :links.wiki)
+	ON CONFLICT (tenant_id, imdb_id) DO UPDATE
+	SET title = EXCLUDED.title,
+		year = EXCLUDED.year,
+		runtime = EXCLUDED.runtime,
+		genres = EXCLUDED.genres,
+		trailer_url = EXCLUDED.trailer_url,
+		homepage = EXCLUDED.homepage,
+		wiki = EXCLUDED.wiki,
+		version = movies.version + 1
+	RETURNING id, uuid, created_at, slug, version, (xmax = 0) AS inserted`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		result := struct {
+			*Movie
+			Inserted bool `db:"inserted"`
+		}{Movie: movie}
+
+		err := withTx(ctx, m.DB, func(tx *sqlx.Tx) error {
+			// the slug is only used if the movie is inserted, and is replaced by the
+			// stored one otherwise
+			slug, err := m.uniqueSlug(ctx, tx, Slugify(movie.Title), 0)
+			if err != nil {
+				return err
+			}
+			movie.Slug = slug
+			movie.TenantID = m.tenantID()
+
+			err = namedQueryRow(ctx, tx, query, movie).StructScan(&result)
+			if err != nil {
+				return err
+			}
+
+			eventType := "movie.updated"
+			if result.Inserted {
+				eventType = "movie.created"
+			}
+
+			return enqueueOutbox(ctx, tx, MoviesTopic, eventType, movie.UUID, movie)
+		})
+		if isSlugConflict(err) && attempt < 3 {
+			continue
+		}
+		if err == nil && !result.Inserted {
+			m.uncache(movie.ID)
+		}
+
+		return result.Inserted, err
+	}
+}
+
+// MovieFilter selects movies for bulk operations. Zero-valued fields are ignored,
+// and the set fields are combined with AND.
+type MovieFilter struct {
+	// Title matches with full-text search, as in GetAll
+	Title string
+	// Genres matches movies having all of the given genres
+	Genres []string
+	// YearBefore and YearAfter are exclusive bounds on the release year
+	YearBefore int32
+	YearAfter  int32
+}
+
+// IsEmpty reports whether the filter would match every movie
+func (f MovieFilter) IsEmpty() bool {
+	return f.Title == "" && len(f.Genres) == 0 && f.YearBefore == 0 && f.YearAfter == 0
+}
+
+// ErrTooManyRows is returned by bulk operations which would affect more rows than allowed
+var ErrTooManyRows = errors.New("too many rows affected")
+
+// DeleteManyTimeout bounds the transaction of DeleteMany
+const DeleteManyTimeout = 10 * time.Second
+
+// DeleteMany deletes the movies with any of the given IDs or UUIDs, or matching the
+// filter, in a single transaction. If more than max movies would be deleted, nothing
+// is deleted and ErrTooManyRows is returned. It returns the deleted movies, with only
+// their ID, UUID and version set.
+func (m MovieModel) DeleteMany(ids []int64, uuids []string, filter *MovieFilter, max int) ([]*Movie, error) {
+	var query string
+	var args []any
+
+	switch {
+	case filter != nil:
+		// a nil slice is sent as NULL, which would match no movies
+		genres := filter.Genres
+		if genres == nil {
+			genres = []string{}
+		}
+
+		query = `
+		DELETE FROM movies
+		WHERE tenant_id = $1
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (genres @> $3 OR $3 = '{}')
+		AND (year < $4 OR $4 = 0)
+		AND (year > $5 OR $5 = 0)
+		RETURNING id, uuid, version`
+		args = []any{m.tenantID(), filter.Title, genres, filter.YearBefore, filter.YearAfter}
+	default:
+		query = `
+		DELETE FROM movies
+		WHERE tenant_id = $1 AND (id = ANY($2) OR uuid = ANY($3::uuid[]))
+		RETURNING id, uuid, version`
+		args = []any{m.tenantID(), ids, uuids}
+	}
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), DeleteManyTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deleted := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.StructScan(&movie)
+		if err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, &movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the deletion is rolled back by the deferred Rollback
+	if len(deleted) > max {
+		return nil, ErrTooManyRows
+	}
+
+	for _, movie := range deleted {
+		err := enqueueOutbox(ctx, tx, MoviesTopic, "movie.deleted", movie.UUID, movieDeleted{UUID: movie.UUID, Version: movie.Version})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	ids = make([]int64, len(deleted))
+	for i, movie := range deleted {
+		ids[i] = movie.ID
+	}
+	m.uncache(ids...)
+
+	return deleted, nil
+}
+
 // Delete removes a movie record from the movies table based on the provided ID.
 // If the movie with the specified ID is not found, it returns an ErrRecordNotFound error.
 // If any other error occurs during the deletion, it returns that error.
@@ -178,7 +1014,9 @@ func (m MovieModel) Update(movie *Movie) error {
 // Notes:
 //   - The function checks if the provided ID is a positive number before attempting the deletion.
 //   - It executes a DELETE SQL query to remove the movie record from the database.
-//   - It checks the number of rows affected by the DELETE operation to determine if the movie was found and deleted.
+//   - It checks whether the DELETE operation returned a row to determine if the movie was found and deleted.
+//   - The movie.deleted event is recorded in the outbox in the same transaction.
+//   - The movie is removed from the cache once the deletion is committed.
 func (m MovieModel) Delete(id int64) error {
 	// id has to be a positive number
 	if id < 1 {
@@ -188,26 +1026,33 @@ func (m MovieModel) Delete(id int64) error {
 	// execute delete query
 	query := `
 	DELETE FROM movies
-	WHERE id = $1
-	`
+	WHERE tenant_id = $1 AND id = $2
+	RETURNING uuid, version`
 
 	// add a three-second context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
+	err := withTx(ctx, m.DB, func(tx *sqlx.Tx) error {
+		var deleted movieDeleted
+
+		// no returned row means that no movie was deleted
+		err := tx.QueryRowxContext(ctx, query, m.tenantID(), id).Scan(&deleted.UUID, &deleted.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
 
-	// check if any row was actually deleted
-	rowsAffected, err := result.RowsAffected()
+		return enqueueOutbox(ctx, tx, MoviesTopic, "movie.deleted", deleted.UUID, deleted)
+	})
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
 
+	m.uncache(id)
 	return nil
 }
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+func TestValidateMovieGenres(t *testing.T) {
+	tests := []struct {
+		name   string
+		genres []string
+		want   string
+	}{
+		{"missing", nil, "must be provided"},
+		{"empty", []string{}, "must contain at least 1 genre"},
+		{"one", []string{"drama"}, ""},
+		{"five", []string{"action", "comedy", "drama", "horror", "sci-fi"}, ""},
+		{"six", []string{"action", "comedy", "drama", "horror", "sci-fi", "western"}, "must not contain more than 5 genres"},
+		{"duplicates", []string{"drama", "drama"}, "must not contain duplicate values"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := &Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: tt.genres}
+
+			v := validator.New()
+			ValidateMovie(v, movie)
+
+			got := v.Errors["genres"]
+			switch {
+			case tt.want == "" && len(got) > 0:
+				t.Errorf("got genres errors %q; want none", got)
+			case tt.want != "" && !slices.Contains(got, tt.want):
+				t.Errorf("got genres errors %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
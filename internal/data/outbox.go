@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MoviesTopic is the outbox topic of movie lifecycle events
+const MoviesTopic = "greenlight.movies"
+
+// OutboxMessage is an event recorded in the same transaction as the change it
+// describes, waiting to be published to the message broker
+type OutboxMessage struct {
+	ID int64
+	// TenantID is the tenant whose catalog the event is about
+	TenantID  int64
+	Topic     string
+	EventType string
+	// Key identifies the record the event is about (e.g. a movie UUID), so that
+	// brokers can keep the events of one record in order
+	Key       string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// movieDeleted is the payload of movie.deleted events
+type movieDeleted struct {
+	UUID    string `json:"uuid"`
+	Version int32  `json:"version"`
+}
+
+// enqueueOutbox records an event about the catalog of the tenant carried by ctx in
+// the outbox. It must be called with the transaction that makes the change, so that
+// the event is stored if and only if the change is committed.
+func enqueueOutbox(ctx context.Context, tx sqlx.ExecerContext, topic, eventType, key string, payload any) error {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO outbox (tenant_id, topic, event_type, key, payload)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = tx.ExecContext(ctx, query, TenantID(ctx), topic, eventType, key, js)
+	return err
+}
+
+type OutboxModel struct {
+	DB DBTX
+	// ctx is the parent context of the queries, set by Models.WithContext
+	ctx context.Context
+}
+
+// Relay passes up to limit of the oldest unpublished messages to publish, and marks
+// them as published if it succeeds, returning how many there were. The messages are
+// locked until then, so that concurrent relays skip them instead of publishing them
+// twice. If publish fails, the messages stay unpublished and are passed again by a
+// later call, so consumers must tolerate the occasional duplicate (each message has
+// a stable ID for deduplication).
+func (m OutboxModel) Relay(ctx context.Context, limit int, publish func([]*OutboxMessage) error) (int, error) {
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT id, tenant_id, topic, event_type, key, payload, created_at
+	FROM outbox
+	WHERE published_at IS NULL
+	ORDER BY id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.QueryxContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	messages := []*OutboxMessage{}
+	ids := []int64{}
+	for rows.Next() {
+		var message OutboxMessage
+
+		err := rows.Scan(&message.ID, &message.TenantID, &message.Topic, &message.EventType, &message.Key, &message.Payload, &message.CreatedAt)
+		if err != nil {
+			return 0, err
+		}
+		messages = append(messages, &message)
+		ids = append(ids, message.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	err = publish(messages)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE outbox SET published_at = now() WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(messages), tx.Commit()
+}
+
+// PurgePublished deletes the messages published before the given time, and returns
+// how many were deleted.
+func (m OutboxModel) PurgePublished(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 10*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,21 @@
+package data
+
+import (
+	"errors"
+)
+
+// readReplica runs read against the replica of the model, if it has one and isn't
+// set to read from the primary, and again against the primary if the replica fails.
+// Not finding the record is not a failure.
+func readReplica[T any](m MovieModel, read func(db DBTX) (T, error)) (T, error) {
+	if m.Replica == nil || m.primary {
+		return read(m.DB)
+	}
+
+	v, err := read(m.Replica)
+	if err == nil || errors.Is(err, ErrRecordNotFound) {
+		return v, err
+	}
+
+	return read(m.DB)
+}
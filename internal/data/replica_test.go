@@ -0,0 +1,49 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestReadReplica(t *testing.T) {
+	primary, replica := &sqlx.DB{}, &sqlx.DB{}
+
+	models := NewModel(primary)
+	models.Movies.Replica = replica
+
+	readFrom := func(m MovieModel, replicaErr error) DBTX {
+		db, err := readReplica(m, func(db DBTX) (DBTX, error) {
+			if db == replica {
+				return db, replicaErr
+			}
+			return db, nil
+		})
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			t.Fatal(err)
+		}
+		return db
+	}
+
+	tests := []struct {
+		name       string
+		model      MovieModel
+		replicaErr error
+		want       DBTX
+	}{
+		{"replica", models.Movies, nil, replica},
+		{"not found on the replica", models.Movies, ErrRecordNotFound, replica},
+		{"replica failing", models.Movies, errors.New("connection refused"), primary},
+		{"primary", models.Primary().Movies, nil, primary},
+		{"no replica", NewModel(primary).Movies, nil, primary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readFrom(tt.model, tt.replicaErr); got != tt.want {
+				t.Errorf("read from %p; want %p", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,68 @@
 package data
 
 import (
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
-	"strings"
 )
 
 var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
+// runtimeRX matches the runtimes ParseRuntime accepts: "135 mins" or "135 min",
+// "2h 15m" (with or without the space), "2h" and "135m"
+var runtimeRX = regexp.MustCompile(`^(?:([0-9]+) mins?|([0-9]+)h(?: ?([0-9]+)m)?|([0-9]+)m)$`)
+
 type Runtime int32
 
+// ParseRuntime parses a runtime written as a number of minutes with a unit, as in
+// "135 mins", "135 min" or "135m", or as hours and minutes, as in "2h 15m" or "2h".
+// The minutes of a runtime with hours must be less than 60.
+func ParseRuntime(s string) (Runtime, error) {
+	match := runtimeRX.FindStringSubmatch(s)
+	if match == nil {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	var hours, minutes int64
+	var err error
+	switch {
+	case match[1] != "":
+		minutes, err = strconv.ParseInt(match[1], 10, 32)
+	case match[4] != "":
+		minutes, err = strconv.ParseInt(match[4], 10, 32)
+	default:
+		hours, err = strconv.ParseInt(match[2], 10, 32)
+		if err == nil && match[3] != "" {
+			minutes, err = strconv.ParseInt(match[3], 10, 32)
+			if err == nil && minutes >= 60 {
+				return 0, ErrInvalidRuntimeFormat
+			}
+		}
+	}
+	if err != nil || hours*60+minutes > math.MaxInt32 {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	return Runtime(hours*60 + minutes), nil
+}
+
+// Human returns the runtime in hours and minutes, as in "2h 15m", leaving out
+// hours or minutes which are zero (e.g. "2h" or "45m")
+func (r Runtime) Human() string {
+	hours, minutes := r/60, r%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+}
+
 // implements the MarshalJSON() method on Runtime so that
 // it satisfies the json.Marshaler interface
 func (r Runtime) MarshalJSON() ([]byte, error) {
@@ -23,22 +75,47 @@ func (r Runtime) MarshalJSON() ([]byte, error) {
 // it satisfies the json.Unmarshler interface
 // Note: uses *Runtime instead of Runtime because it modifies the receiver
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
-	// the incoming JSON value will be a string of the format "<runtime> mins"
+	// a bare JSON number is a number of minutes
+	if value, err := strconv.ParseInt(string(jsonValue), 10, 32); err == nil {
+		*r = Runtime(value)
+		return nil
+	}
+
+	// otherwise the incoming JSON value will be a string in one of the formats of
+	// ParseRuntime, such as "<runtime> mins"
 	unquotesJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
 
-	parts := strings.Split(unquotesJSONValue, " ")
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+	value, err := ParseRuntime(unquotesJSONValue)
+	if err != nil {
+		return err
 	}
 
-	value, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return ErrInvalidRuntimeFormat
+	*r = value
+	return nil
+}
+
+// Scan implements the sql.Scanner interface, reading the number of minutes stored in
+// an integer column
+func (r *Runtime) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*r = 0
+	case int64:
+		if src < math.MinInt32 || src > math.MaxInt32 {
+			return fmt.Errorf("runtime %d out of range", src)
+		}
+		*r = Runtime(src)
+	default:
+		return fmt.Errorf("cannot scan %T into a runtime", src)
 	}
 
-	*r = Runtime(value)
 	return nil
 }
+
+// Value implements the driver.Valuer interface, writing the number of minutes
+func (r Runtime) Value() (driver.Value, error) {
+	return int64(r), nil
+}
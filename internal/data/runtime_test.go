@@ -0,0 +1,207 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestParseRuntime(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Runtime
+	}{
+		// hours and minutes
+		{"2h 15m", 135},
+		{"2h15m", 135},
+		{"1h 0m", 60},
+		{"0h 45m", 45},
+		{"1h 59m", 119},
+		// hours or minutes alone
+		{"2h", 120},
+		{"45m", 45},
+		{"135m", 135},
+		{"0m", 0},
+		// minutes with a unit, including the legacy "N mins" form
+		{"135 min", 135},
+		{"135 mins", 135},
+		{"1 min", 1},
+		{"102 mins", 102},
+		{"0 mins", 0},
+		// leading zeros are decimal
+		{"090 mins", 90},
+		// the largest runtimes which fit
+		{"2147483647 mins", math.MaxInt32},
+		{"35791394h 7m", math.MaxInt32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRuntime(tt.input)
+			if err != nil {
+				t.Fatalf("ParseRuntime(%q) returned error %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRuntime(%q) = %d; want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRuntimeInvalid(t *testing.T) {
+	tests := []string{
+		// empty and bare numbers, which are only accepted as JSON numbers
+		"",
+		" ",
+		"135",
+		// negative values
+		"-5 mins",
+		"-2h",
+		"2h -15m",
+		"-45m",
+		// minutes of an hour out of range
+		"2h 75m",
+		"1h 60m",
+		// overflow
+		"2147483648 mins",
+		"35791394h 8m",
+		"35791395h",
+		"99999999999999999999 mins",
+		"99999999999999999999h",
+		// malformed
+		"mins",
+		"2 hours",
+		"2H 15M",
+		"2h  15m",
+		"15m 2h",
+		"2h 15",
+		"1.5h",
+		" 135 mins",
+		"135 mins ",
+		"135mins",
+		"135 minutes",
+		"1d",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			got, err := ParseRuntime(input)
+			if !errors.Is(err, ErrInvalidRuntimeFormat) {
+				t.Errorf("ParseRuntime(%q) = %d, %v; want ErrInvalidRuntimeFormat", input, got, err)
+			}
+		})
+	}
+}
+
+func TestRuntimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Runtime
+	}{
+		{`"2h 15m"`, 135},
+		{`"135 min"`, 135},
+		{`"2h"`, 120},
+		{`"45m"`, 45},
+		{`"102 mins"`, 102},
+		// bare numbers are minutes
+		{`135`, 135},
+		{`0`, 0},
+		{`2147483647`, math.MaxInt32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got Runtime
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if err != nil {
+				t.Fatalf("unmarshaling %s returned error %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("unmarshaling %s = %d; want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeUnmarshalJSONInvalid(t *testing.T) {
+	tests := []string{
+		`""`,
+		`"135"`,
+		`"-5 mins"`,
+		`"2h 75m"`,
+		`"2147483648 mins"`,
+		`2147483648`,
+		`1.5`,
+		`true`,
+		`null`,
+		`["135 mins"]`,
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			var got Runtime
+			err := json.Unmarshal([]byte(input), &got)
+			if err == nil {
+				t.Errorf("unmarshaling %s = %d; want an error", input, got)
+			}
+		})
+	}
+}
+
+func TestRuntimeHuman(t *testing.T) {
+	tests := []struct {
+		runtime Runtime
+		want    string
+	}{
+		{0, "0m"},
+		{45, "45m"},
+		{60, "1h"},
+		{120, "2h"},
+		{135, "2h 15m"},
+		{1439, "23h 59m"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.runtime.Human(); got != tt.want {
+			t.Errorf("Runtime(%d).Human() = %q; want %q", tt.runtime, got, tt.want)
+		}
+	}
+}
+
+// TestRuntimeRoundTrip checks that a runtime written in each of the formats of JSON
+// responses, the default string, the opt-in human form and a bare number, reads
+// back as the same runtime
+func TestRuntimeRoundTrip(t *testing.T) {
+	runtimes := []Runtime{0, 1, 45, 59, 60, 61, 102, 135, 1440, math.MaxInt32}
+
+	formats := []struct {
+		name   string
+		encode func(Runtime) ([]byte, error)
+	}{
+		{"string", func(r Runtime) ([]byte, error) { return json.Marshal(r) }},
+		{"human", func(r Runtime) ([]byte, error) { return json.Marshal(r.Human()) }},
+		{"number", func(r Runtime) ([]byte, error) { return json.Marshal(int32(r)) }},
+	}
+
+	for _, format := range formats {
+		for _, runtime := range runtimes {
+			t.Run(format.name+"/"+strconv.Itoa(int(runtime)), func(t *testing.T) {
+				js, err := format.encode(runtime)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got Runtime
+				err = json.Unmarshal(js, &got)
+				if err != nil {
+					t.Fatalf("unmarshaling %s returned error %v", js, err)
+				}
+				if got != runtime {
+					t.Errorf("unmarshaling %s = %d; want %d", js, got, runtime)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// SimilarMovie is a movie ranked by its similarity to another movie
+type SimilarMovie struct {
+	Movie *Movie
+	// Score is between 0 and 1, higher meaning more similar
+	Score        float64
+	SharedGenres []string
+	YearDistance int32
+}
+
+// Similar returns up to limit movies sharing at least one genre with movie, ranked
+// by a score combining genre overlap (70%, as the Jaccard index of the genre sets)
+// and release year proximity (30%, falling linearly to zero at 20 years apart).
+func (m MovieModel) Similar(movie *Movie, limit int) ([]*SimilarMovie, error) {
+	query := `
+	WITH candidates AS (
+		SELECT id AS movie_id,
+			ARRAY(SELECT g FROM unnest(genres) g WHERE g = ANY($2::text[])) AS shared_genres,
+			cardinality(ARRAY(SELECT DISTINCT g FROM unnest(genres || $2::text[]) g)) AS union_size,
+			abs(year - $3) AS year_distance
+		FROM movies
+		WHERE tenant_id = $5 AND id <> $1 AND genres && $2::text[]
+	)
+	SELECT ` + movieColumns + `, c.shared_genres, c.year_distance,
+		0.7 * cardinality(c.shared_genres)::float8 / c.union_size
+			+ 0.3 * greatest(0, 1 - c.year_distance / 20.0) AS score
+	FROM movies
+	INNER JOIN candidates c ON c.movie_id = movies.id
+	ORDER BY score DESC, movies.id DESC
+	LIMIT $4`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, movie.ID, movie.Genres, movie.Year, limit, m.tenantID())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	similar := []*SimilarMovie{}
+	for rows.Next() {
+		var row struct {
+			Movie
+			SharedGenres Genres  `db:"shared_genres"`
+			YearDistance int32   `db:"year_distance"`
+			Score        float64 `db:"score"`
+		}
+
+		err := rows.StructScan(&row)
+		if err != nil {
+			return nil, err
+		}
+		similar = append(similar, &SimilarMovie{Movie: &row.Movie, Score: row.Score, SharedGenres: row.SharedGenres, YearDistance: row.YearDistance})
+	}
+
+	return similar, rows.Err()
+}
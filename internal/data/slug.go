@@ -0,0 +1,40 @@
+package data
+
+import (
+	"strings"
+)
+
+// maxSlugLength caps the length of generated slugs, leaving room for a collision suffix
+const maxSlugLength = 80
+
+// Slugify converts a title into a lowercase, URL-safe slug made up of ASCII letters,
+// digits and single dashes, e.g. "The Breakfast Club (1985)" becomes
+// "the-breakfast-club-1985". Titles without any usable characters produce "movie".
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+
+	slug := strings.Trim(b.String(), "-")
+	if slug == "" {
+		return "movie"
+	}
+
+	return slug
+}
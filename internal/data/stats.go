@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MovieStats holds aggregate statistics over the whole catalog of a tenant
+type MovieStats struct {
+	Total          int64            `json:"total"`
+	ByDecade       map[string]int64 `json:"by_decade"`
+	ByGenre        map[string]int64 `json:"by_genre"`
+	AverageRuntime float64          `json:"average_runtime_mins"`
+	OldestYear     int32            `json:"oldest_year,omitempty"`
+	NewestYear     int32            `json:"newest_year,omitempty"`
+	GeneratedAt    time.Time        `json:"generated_at"`
+}
+
+// Stats computes the catalog statistics. Decades are keyed like "1990s".
+func (m MovieModel) Stats() (*MovieStats, error) {
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 5*time.Second)
+	defer cancel()
+
+	stats := MovieStats{
+		ByDecade:    make(map[string]int64),
+		ByGenre:     make(map[string]int64),
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	query := `
+	SELECT count(*), coalesce(avg(runtime), 0), coalesce(min(year), 0), coalesce(max(year), 0)
+	FROM movies
+	WHERE tenant_id = $1`
+
+	tenantID := m.tenantID()
+
+	err := m.DB.QueryRowxContext(ctx, query, tenantID).Scan(&stats.Total, &stats.AverageRuntime, &stats.OldestYear, &stats.NewestYear)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT (year / 10) * 10 AS decade, count(*)
+	FROM movies
+	WHERE tenant_id = $1
+	GROUP BY decade`
+
+	rows, err := m.DB.QueryxContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var decade int32
+		var count int64
+
+		err := rows.Scan(&decade, &count)
+		if err != nil {
+			return nil, err
+		}
+		stats.ByDecade[fmt.Sprintf("%ds", decade)] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT genre, count(*)
+	FROM movies, unnest(genres) AS genre
+	WHERE tenant_id = $1
+	GROUP BY genre`
+
+	genreRows, err := m.DB.QueryxContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer genreRows.Close()
+
+	for genreRows.Next() {
+		var genre string
+		var count int64
+
+		err := genreRows.Scan(&genre, &count)
+		if err != nil {
+			return nil, err
+		}
+		stats.ByGenre[genre] = count
+	}
+
+	return &stats, genreRows.Err()
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// MovieSuggestion is the lightweight representation of a movie used for typeahead
+type MovieSuggestion struct {
+	ID    int64  `json:"-"`
+	UUID  string `json:"uuid"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest returns up to limit movies whose title starts with, or is similar to, the
+// query. Prefix matches are ranked first, followed by trigram matches ordered by
+// similarity. Both conditions are served by indexes on lower(title).
+func (m MovieModel) Suggest(q string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+	SELECT id, uuid, title, year
+	FROM movies
+	WHERE tenant_id = $4 AND (lower(title) LIKE $1 OR lower(title) % $2)
+	ORDER BY lower(title) LIKE $1 DESC, similarity(lower(title), $2) DESC, title
+	LIMIT $3`
+
+	q = strings.ToLower(q)
+
+	// typeahead requests are frequent and cheap, so use a tighter timeout
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, likeEscaper.Replace(q)+"%", q, limit, m.tenantID())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+	for rows.Next() {
+		var s MovieSuggestion
+
+		err := rows.Scan(&s.ID, &s.UUID, &s.Title, &s.Year)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &s)
+	}
+
+	return suggestions, rows.Err()
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// DefaultTenantID is the tenant of the queries made without one, such as those of
+// requests which name no tenant. It owns the movies created before tenants existed.
+const DefaultTenantID int64 = 1
+
+// TenantSlugRX matches tenant slugs, which are used as subdomains
+var TenantSlugRX = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ErrDuplicateTenantSlug is returned when another tenant already has the same slug
+var ErrDuplicateTenantSlug = errors.New("duplicate tenant slug")
+
+type tenantIDKey struct{}
+
+// WithTenant returns a copy of ctx carrying the ID of the tenant whose catalog the
+// queries made with it are scoped to
+func WithTenant(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, tenantIDKey{}, id)
+}
+
+// TenantID returns the tenant ID carried by ctx, or DefaultTenantID
+func TenantID(ctx context.Context) int64 {
+	id, ok := queryContext(ctx).Value(tenantIDKey{}).(int64)
+	if !ok {
+		return DefaultTenantID
+	}
+	return id
+}
+
+// Tenant is an organization with a catalog of movies of its own, isolated from the
+// catalogs of the other tenants
+type Tenant struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name" validate:"required,max=200"`
+	Slug      string    `json:"slug" validate:"required"`
+}
+
+func ValidateTenant(v *validator.Validator, tenant *Tenant) {
+	validator.ValidateStruct(v, tenant)
+
+	v.Check(tenant.Slug == "" || validator.Match(tenant.Slug, TenantSlugRX), "slug", "must only contain lowercase letters, digits and inner hyphens, up to 63 characters")
+}
+
+type TenantModel struct {
+	DB DBTX
+	// ctx is the parent context of the queries, set by Models.WithContext
+	ctx context.Context
+}
+
+const tenantColumns = `id, created_at, name, slug`
+
+func tenantFields(tenant *Tenant) []any {
+	return []any{&tenant.ID, &tenant.CreatedAt, &tenant.Name, &tenant.Slug}
+}
+
+// Insert adds a tenant, which authenticates with apiKey. Only a hash of the key is
+// stored.
+func (m TenantModel) Insert(tenant *Tenant, apiKey string) error {
+	query := `
+	INSERT INTO tenants (name, slug, api_key_hash)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(apiKey))
+
+	err := m.DB.QueryRowxContext(ctx, query, tenant.Name, tenant.Slug, hash[:]).Scan(&tenant.ID, &tenant.CreatedAt)
+	if isUniqueViolation(err, "tenants_slug_key") {
+		return ErrDuplicateTenantSlug
+	}
+	return err
+}
+
+// GetAll returns every tenant, oldest first
+func (m TenantModel) GetAll() ([]*Tenant, error) {
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []*Tenant{}
+	for rows.Next() {
+		var tenant Tenant
+
+		err := rows.Scan(tenantFields(&tenant)...)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, &tenant)
+	}
+
+	return tenants, rows.Err()
+}
+
+// GetBySlug returns the tenant with the given slug
+func (m TenantModel) GetBySlug(slug string) (*Tenant, error) {
+	return m.get(`SELECT `+tenantColumns+` FROM tenants WHERE slug = $1`, slug)
+}
+
+// GetByAPIKey returns the tenant which authenticates with apiKey
+func (m TenantModel) GetByAPIKey(apiKey string) (*Tenant, error) {
+	hash := sha256.Sum256([]byte(apiKey))
+	return m.get(`SELECT `+tenantColumns+` FROM tenants WHERE api_key_hash = $1`, hash[:])
+}
+
+func (m TenantModel) get(query string, args ...any) (*Tenant, error) {
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	var tenant Tenant
+
+	err := m.DB.QueryRowxContext(ctx, query, args...).Scan(tenantFields(&tenant)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tenant, nil
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request it belongs to,
+// which the slow query log attributes queries to
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// queryContext returns the parent context for the queries of a model, which is the
+// context given to Models.WithContext if any
+func queryContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// modelsPackage prefixes the names of the functions of this package in stack traces
+var modelsPackage = reflect.TypeOf(MovieModel{}).PkgPath() + "."
+
+// slowQueryTracer logs the queries which take longer than threshold
+type slowQueryTracer struct {
+	threshold time.Duration
+	logger    *slog.Logger
+}
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+type queryStartKey struct{}
+
+func (t *slowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, start: time.Now()})
+}
+
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+
+	duration := time.Since(start.start)
+	if duration < t.threshold {
+		return
+	}
+
+	attrs := []any{
+		"query", queryName(),
+		"duration_ms", duration.Milliseconds(),
+		"rows", data.CommandTag.RowsAffected(),
+		"sql", strings.Join(strings.Fields(start.sql), " "),
+	}
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, "request_id", id)
+	}
+	if data.Err != nil {
+		attrs = append(attrs, "error", data.Err.Error())
+	}
+
+	t.logger.Warn("slow query", attrs...)
+}
+
+// queryName names a query by the model method which made it, such as
+// "MovieModel.getAll", by looking for the method in the stack. Queries end in the
+// goroutine of the method, as they are read before the method returns.
+func queryName() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+
+	for {
+		frame, more := frames.Next()
+
+		name, ok := strings.CutPrefix(frame.Function, modelsPackage)
+		if ok && strings.Contains(name, "Model.") {
+			// closures are named after the method they are declared in
+			name, _, _ = strings.Cut(name, ".func")
+			return name
+		}
+
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DBTX is implemented by *sqlx.DB and *sqlx.Tx, so that the models can run their
+// queries either against the database or in a transaction started by Models.WithTx.
+type DBTX interface {
+	sqlx.ExtContext
+}
+
+// modelTx is a transaction started by a model method. When the model already runs
+// in a transaction, it is a savepoint of that transaction instead, so that the
+// method is atomic on its own without committing the enclosing transaction.
+type modelTx struct {
+	*sqlx.Tx
+	ctx       context.Context
+	savepoint bool
+	done      bool
+}
+
+// beginTx starts a transaction on db, or a savepoint if db is a transaction
+func beginTx(ctx context.Context, db DBTX) (*modelTx, error) {
+	switch db := db.(type) {
+	case *sqlx.DB:
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &modelTx{Tx: tx, ctx: ctx}, nil
+
+	case *sqlx.Tx:
+		_, err := db.ExecContext(ctx, "SAVEPOINT model_tx")
+		if err != nil {
+			return nil, err
+		}
+		return &modelTx{Tx: db, ctx: ctx, savepoint: true}, nil
+
+	default:
+		return nil, errors.New("data: cannot begin a transaction")
+	}
+}
+
+// Commit commits the transaction, or releases the savepoint
+func (t *modelTx) Commit() error {
+	if !t.savepoint {
+		return t.Tx.Commit()
+	}
+
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, "RELEASE SAVEPOINT model_tx")
+	return err
+}
+
+// Rollback rolls back the transaction, or to the savepoint. Like sql.Tx.Rollback, it
+// does nothing after Commit, so that it can be deferred.
+func (t *modelTx) Rollback() error {
+	if !t.savepoint {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return nil
+	}
+
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, "ROLLBACK TO SAVEPOINT model_tx")
+	if err != nil {
+		return err
+	}
+	_, err = t.Tx.ExecContext(t.ctx, "RELEASE SAVEPOINT model_tx")
+	return err
+}
+
+// withTx runs fn in a transaction, which is committed if fn succeeds and rolled
+// back otherwise
+func withTx(ctx context.Context, db DBTX, fn func(*sqlx.Tx) error) error {
+	tx, err := beginTx(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx.Tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
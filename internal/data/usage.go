@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// DailyUsage is the number of requests a tenant made with its API key on a day
+type DailyUsage struct {
+	Day      string `json:"day" db:"day"`
+	Requests int64  `json:"requests" db:"requests"`
+}
+
+// UsageModel counts the requests made with the API keys of the tenants, by UTC day
+type UsageModel struct {
+	DB DBTX
+	// ctx is the parent context of the queries, set by Models.WithContext
+	ctx context.Context
+}
+
+// Add adds the numbers of requests of the tenants, keyed by tenant ID, to their usage
+// on the UTC day of the given time, in a single statement
+func (m UsageModel) Add(day time.Time, requests map[int64]int64) error {
+	tenantIDs := make([]int64, 0, len(requests))
+	counts := make([]int64, 0, len(requests))
+	for id, n := range requests {
+		tenantIDs = append(tenantIDs, id)
+		counts = append(counts, n)
+	}
+
+	query := `
+	INSERT INTO tenant_usage (tenant_id, day, requests)
+	SELECT u.tenant_id, $1::date, u.requests
+	FROM unnest($2::bigint[], $3::bigint[]) AS u(tenant_id, requests)
+	ON CONFLICT (tenant_id, day) DO UPDATE SET requests = tenant_usage.requests + EXCLUDED.requests`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, day.UTC().Format(time.DateOnly), tenantIDs, counts)
+	return err
+}
+
+// Total returns the number of requests the tenant of the models made since the
+// start of the UTC day of the given time
+func (m UsageModel) Total(since time.Time) (int64, error) {
+	query := `
+	SELECT coalesce(sum(requests), 0)::bigint
+	FROM tenant_usage
+	WHERE tenant_id = $1 AND day >= $2::date`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	var total int64
+	err := m.DB.QueryRowxContext(ctx, query, TenantID(m.ctx), since.UTC().Format(time.DateOnly)).Scan(&total)
+	return total, err
+}
+
+// Daily returns the usage of the tenant of the models on each day since the start of
+// the UTC day of the given time, oldest first. Days without requests are left out.
+func (m UsageModel) Daily(since time.Time) ([]*DailyUsage, error) {
+	query := `
+	SELECT to_char(day, 'YYYY-MM-DD') AS day, requests
+	FROM tenant_usage
+	WHERE tenant_id = $1 AND day >= $2::date
+	ORDER BY day`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, TenantID(m.ctx), since.UTC().Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []*DailyUsage{}
+	for rows.Next() {
+		var usage DailyUsage
+
+		err := rows.StructScan(&usage)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, &usage)
+	}
+
+	return days, rows.Err()
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// TrendingMovie is a movie together with the number of views it received within
+// the trending window
+type TrendingMovie struct {
+	*Movie
+	Views int64 `json:"views" db:"views"`
+}
+
+// ViewModel records movie views in hourly buckets, which is what the trending
+// listing is computed from
+type ViewModel struct {
+	DB DBTX
+	// ctx is the parent context of the queries, set by Models.WithContext
+	ctx context.Context
+}
+
+// Record counts a single view of the movie in the bucket for the current hour.
+func (m ViewModel) Record(movieID int64) error {
+	query := `
+	INSERT INTO movie_views (movie_id, bucket, views)
+	VALUES ($1, date_trunc('hour', now()), 1)
+	ON CONFLICT (movie_id, bucket) DO UPDATE SET views = movie_views.views + 1`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, movieID)
+	return err
+}
+
+// Trending returns up to limit movies ordered by the number of views they received
+// within the sliding window ending now, out of the catalog of the tenant. Movies
+// without any views in the window are not included.
+func (m ViewModel) Trending(window time.Duration, limit int) ([]*TrendingMovie, error) {
+	query := `
+	SELECT ` + movieColumns + `, v.views
+	FROM movies
+	INNER JOIN (
+		SELECT mv.movie_id, sum(mv.views) AS views
+		FROM movie_views mv
+		INNER JOIN movies tm ON tm.id = mv.movie_id
+		WHERE tm.tenant_id = $3 AND mv.bucket >= now() - make_interval(secs => $1)
+		GROUP BY mv.movie_id
+		ORDER BY views DESC
+		LIMIT $2
+	) v ON v.movie_id = movies.id
+	ORDER BY v.views DESC, movies.id DESC`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, window.Seconds(), limit, TenantID(m.ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*TrendingMovie{}
+	for rows.Next() {
+		movie := TrendingMovie{Movie: &Movie{}}
+
+		err := rows.StructScan(&movie)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	return movies, rows.Err()
+}
@@ -0,0 +1,177 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/aviagarwal1212/greenlight/internal/validator"
+)
+
+// WebhookEventTypes are the event types a webhook can subscribe to
+var WebhookEventTypes = []string{"movie.created", "movie.updated", "movie.deleted"}
+
+// Webhook is a subscription which has events of the given types delivered to a URL
+// as signed POST requests. It belongs to a tenant, and only receives the events of
+// its catalog.
+type Webhook struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	URL        string    `json:"url" validate:"required,url,max=2048"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"event_types" validate:"unique,oneof=movie.created movie.updated movie.deleted"`
+	Version    int32     `json:"version"`
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	validator.ValidateStruct(v, webhook)
+
+	// the secret is never encoded, so it has no key of its own to tag
+	v.Check(validator.MinLength(webhook.Secret, 16), "secret", "must be at least 16 bytes long")
+	v.Check(validator.MaxLength(webhook.Secret, 256), "secret", "must not be more than 256 bytes long")
+
+	v.Check(validator.MinItems(webhook.EventTypes, 1), "event_types", "must contain at least 1 event type")
+}
+
+type WebhookModel struct {
+	DB DBTX
+	// ctx is the parent context of the queries, set by Models.WithContext
+	ctx context.Context
+}
+
+// tenantID returns the tenant whose webhooks the queries of the model are scoped to
+func (m WebhookModel) tenantID() int64 {
+	return TenantID(m.ctx)
+}
+
+// webhookColumns are qualified with the table name, so that they can be selected
+// alongside the columns of joined tables
+const webhookColumns = `webhooks.id, webhooks.created_at, webhooks.url, webhooks.secret, webhooks.event_types, webhooks.version`
+
+func webhookFields(webhook *Webhook) []any {
+	return []any{&webhook.ID, &webhook.CreatedAt, &webhook.URL, &webhook.Secret, arrayScanner(&webhook.EventTypes), &webhook.Version}
+}
+
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+	INSERT INTO webhooks (tenant_id, url, secret, event_types)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	args := []any{m.tenantID(), webhook.URL, webhook.Secret, webhook.EventTypes}
+
+	return m.DB.QueryRowxContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Version)
+}
+
+func (m WebhookModel) Get(id int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE tenant_id = $1 AND id = $2`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+
+	err := m.DB.QueryRowxContext(ctx, query, m.tenantID(), id).Scan(webhookFields(&webhook)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+// GetAll returns every webhook of the tenant, oldest first.
+func (m WebhookModel) GetAll() ([]*Webhook, error) {
+	return m.query(`SELECT `+webhookColumns+` FROM webhooks WHERE tenant_id = $1 ORDER BY id`, m.tenantID())
+}
+
+// ForEvent returns the webhooks of the tenant subscribed to the event type.
+func (m WebhookModel) ForEvent(eventType string) ([]*Webhook, error) {
+	return m.query(`SELECT `+webhookColumns+` FROM webhooks WHERE tenant_id = $1 AND event_types @> ARRAY[$2] ORDER BY id`, m.tenantID(), eventType)
+}
+
+func (m WebhookModel) query(query string, args ...any) ([]*Webhook, error) {
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+
+		err := rows.Scan(webhookFields(&webhook)...)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (m WebhookModel) Update(webhook *Webhook) error {
+	query := `
+	UPDATE webhooks
+	SET url = $1, secret = $2, event_types = $3, version = version + 1
+	WHERE tenant_id = $4 AND id = $5 AND version = $6
+	RETURNING version`
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	args := []any{webhook.URL, webhook.Secret, webhook.EventTypes, m.tenantID(), webhook.ID, webhook.Version}
+
+	err := m.DB.QueryRowxContext(ctx, query, args...).Scan(&webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m WebhookModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(queryContext(m.ctx), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM webhooks WHERE tenant_id = $1 AND id = $2`, m.tenantID(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+// Package events provides an in-process publish/subscribe broker for change events,
+// with resumable event IDs so that streaming clients which reconnect after a short
+// interruption can catch up on the events they missed.
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single change notification published on a channel.
+type Event struct {
+	// ID is the resume token for the event, which clients send back (e.g. as the
+	// Last-Event-ID header) to continue from this event after reconnecting
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+
+	seq uint64
+}
+
+// Subscription receives the events published on a channel after it was created.
+type Subscription struct {
+	// Events delivers live events. It is closed when the subscription is cancelled,
+	// or when the subscriber falls too far behind, in which case the client should
+	// reconnect with the ID of the last event it processed.
+	Events <-chan Event
+	// Replay holds the buffered events published after the resume token given to
+	// Subscribe, oldest first, which must be delivered before any live event
+	Replay []Event
+	// ResyncRequired is true when the resume token could not be honored, either
+	// because it was issued before the server restarted or because the events after
+	// it are no longer buffered. The client should then refetch its full state.
+	ResyncRequired bool
+
+	events  chan Event
+	channel string
+}
+
+type channelState struct {
+	// buffer is a ring of the most recent events, with next the index of the slot
+	// to overwrite
+	buffer      []Event
+	next        int
+	seq         uint64
+	subscribers map[*Subscription]struct{}
+}
+
+// Broker fans out published events to the subscribers of each channel and keeps a
+// bounded replay buffer per channel.
+type Broker struct {
+	mu         sync.Mutex
+	boot       string
+	bufferSize int
+	channels   map[string]*channelState
+}
+
+// subscriberBuffer is how many live events may queue up for a subscriber before it
+// is considered too slow and disconnected
+const subscriberBuffer = 64
+
+// NewBroker creates a broker which keeps up to bufferSize events per channel for replay.
+func NewBroker(bufferSize int) *Broker {
+	return &Broker{
+		// resume tokens carry the boot time, so tokens from before a restart are
+		// recognized instead of being confused with new sequence numbers
+		boot:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		bufferSize: bufferSize,
+		channels:   make(map[string]*channelState),
+	}
+}
+
+func (b *Broker) channel(name string) *channelState {
+	c, ok := b.channels[name]
+	if !ok {
+		c = &channelState{subscribers: make(map[*Subscription]struct{})}
+		b.channels[name] = c
+	}
+	return c
+}
+
+// Publish sends an event to every subscriber of the channel and adds it to the
+// channel's replay buffer. Subscribers that cannot keep up are disconnected rather
+// than slowing down the publisher.
+func (b *Broker) Publish(channel, eventType string, data any) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.channel(channel)
+
+	c.seq++
+	event := Event{
+		ID:   fmt.Sprintf("%s-%d", b.boot, c.seq),
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: data,
+		seq:  c.seq,
+	}
+
+	if b.bufferSize > 0 {
+		if len(c.buffer) < b.bufferSize {
+			c.buffer = append(c.buffer, event)
+		} else {
+			c.buffer[c.next] = event
+			c.next = (c.next + 1) % b.bufferSize
+		}
+	}
+
+	for sub := range c.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(c.subscribers, sub)
+			close(sub.events)
+		}
+	}
+
+	return event
+}
+
+// Subscribe starts a subscription to the channel. If lastEventID is not empty, the
+// buffered events published after it are returned in Replay.
+func (b *Broker) Subscribe(channel, lastEventID string) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.channel(channel)
+
+	sub := &Subscription{
+		events:  make(chan Event, subscriberBuffer),
+		channel: channel,
+	}
+	sub.Events = sub.events
+	c.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub
+	}
+
+	lastSeq, ok := b.parseID(c, lastEventID)
+	if !ok {
+		sub.ResyncRequired = true
+		return sub
+	}
+
+	// the buffer holds events in order starting at c.next once it has wrapped
+	ordered := append(append([]Event{}, c.buffer[c.next:]...), c.buffer[:c.next]...)
+
+	for _, event := range ordered {
+		if event.seq > lastSeq {
+			sub.Replay = append(sub.Replay, event)
+		}
+	}
+
+	// sequence numbers are consecutive within a channel, so if the oldest buffered
+	// event isn't at most the one right after the token, some have been evicted
+	if len(ordered) > 0 && ordered[0].seq > lastSeq+1 {
+		sub.ResyncRequired = true
+	}
+	if len(ordered) == 0 && lastSeq < c.seq {
+		sub.ResyncRequired = true
+	}
+
+	return sub
+}
+
+// Unsubscribe cancels the subscription and closes its Events channel, unless the
+// broker already did so.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.channel(sub.channel)
+	if _, ok := c.subscribers[sub]; ok {
+		delete(c.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// parseID extracts the sequence number from a resume token issued by this broker
+// for channel c
+func (b *Broker) parseID(c *channelState, id string) (uint64, bool) {
+	boot, seq, found := strings.Cut(id, "-")
+	if !found || boot != b.boot {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || n > c.seq {
+		return 0, false
+	}
+
+	return n, true
+}
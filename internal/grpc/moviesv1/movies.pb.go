@@ -0,0 +1,1267 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.35.1
+// 	protoc        v5.28.2
+// source: movies/v1/movies.proto
+
+package moviesv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Movie is a movie of the catalog, identified by its UUID alone
+type Movie struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Uuid   string `protobuf:"bytes,2,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Title  string `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Slug   string `protobuf:"bytes,4,opt,name=slug,proto3" json:"slug,omitempty"`
+	ImdbId string `protobuf:"bytes,5,opt,name=imdb_id,json=imdbId,proto3" json:"imdb_id,omitempty"`
+	Year   int32  `protobuf:"varint,6,opt,name=year,proto3" json:"year,omitempty"`
+	// runtime in minutes
+	Runtime int32       `protobuf:"varint,7,opt,name=runtime,proto3" json:"runtime,omitempty"`
+	Genres  []string    `protobuf:"bytes,8,rep,name=genres,proto3" json:"genres,omitempty"`
+	Links   *MovieLinks `protobuf:"bytes,9,opt,name=links,proto3" json:"links,omitempty"`
+	Version int32       `protobuf:"varint,10,opt,name=version,proto3" json:"version,omitempty"`
+}
+
+func (x *Movie) Reset() {
+	*x = Movie{}
+	mi := &file_movies_v1_movies_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Movie) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Movie) ProtoMessage() {}
+
+func (x *Movie) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Movie.ProtoReflect.Descriptor instead.
+func (*Movie) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Movie) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *Movie) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Movie) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+func (x *Movie) GetImdbId() string {
+	if x != nil {
+		return x.ImdbId
+	}
+	return ""
+}
+
+func (x *Movie) GetYear() int32 {
+	if x != nil {
+		return x.Year
+	}
+	return 0
+}
+
+func (x *Movie) GetRuntime() int32 {
+	if x != nil {
+		return x.Runtime
+	}
+	return 0
+}
+
+func (x *Movie) GetGenres() []string {
+	if x != nil {
+		return x.Genres
+	}
+	return nil
+}
+
+func (x *Movie) GetLinks() *MovieLinks {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+func (x *Movie) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type MovieLinks struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TrailerUrl string `protobuf:"bytes,1,opt,name=trailer_url,json=trailerUrl,proto3" json:"trailer_url,omitempty"`
+	Homepage   string `protobuf:"bytes,2,opt,name=homepage,proto3" json:"homepage,omitempty"`
+	Wiki       string `protobuf:"bytes,3,opt,name=wiki,proto3" json:"wiki,omitempty"`
+}
+
+func (x *MovieLinks) Reset() {
+	*x = MovieLinks{}
+	mi := &file_movies_v1_movies_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MovieLinks) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MovieLinks) ProtoMessage() {}
+
+func (x *MovieLinks) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MovieLinks.ProtoReflect.Descriptor instead.
+func (*MovieLinks) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *MovieLinks) GetTrailerUrl() string {
+	if x != nil {
+		return x.TrailerUrl
+	}
+	return ""
+}
+
+func (x *MovieLinks) GetHomepage() string {
+	if x != nil {
+		return x.Homepage
+	}
+	return ""
+}
+
+func (x *MovieLinks) GetWiki() string {
+	if x != nil {
+		return x.Wiki
+	}
+	return ""
+}
+
+// MovieRef identifies a movie by its public UUID
+type MovieRef struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Uuid string `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+}
+
+func (x *MovieRef) Reset() {
+	*x = MovieRef{}
+	mi := &file_movies_v1_movies_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MovieRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MovieRef) ProtoMessage() {}
+
+func (x *MovieRef) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MovieRef.ProtoReflect.Descriptor instead.
+func (*MovieRef) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MovieRef) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+type GetMovieRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Movie *MovieRef `protobuf:"bytes,1,opt,name=movie,proto3" json:"movie,omitempty"`
+}
+
+func (x *GetMovieRequest) Reset() {
+	*x = GetMovieRequest{}
+	mi := &file_movies_v1_movies_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMovieRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMovieRequest) ProtoMessage() {}
+
+func (x *GetMovieRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMovieRequest.ProtoReflect.Descriptor instead.
+func (*GetMovieRequest) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetMovieRequest) GetMovie() *MovieRef {
+	if x != nil {
+		return x.Movie
+	}
+	return nil
+}
+
+type GetMovieResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Movie *Movie `protobuf:"bytes,1,opt,name=movie,proto3" json:"movie,omitempty"`
+}
+
+func (x *GetMovieResponse) Reset() {
+	*x = GetMovieResponse{}
+	mi := &file_movies_v1_movies_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMovieResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMovieResponse) ProtoMessage() {}
+
+func (x *GetMovieResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMovieResponse.ProtoReflect.Descriptor instead.
+func (*GetMovieResponse) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetMovieResponse) GetMovie() *Movie {
+	if x != nil {
+		return x.Movie
+	}
+	return nil
+}
+
+type ListMoviesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// title filters by full-text search; empty matches every movie
+	Title string `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	// genres filters to movies with all of the genres
+	Genres []string `protobuf:"bytes,2,rep,name=genres,proto3" json:"genres,omitempty"`
+	// page defaults to 1
+	Page int32 `protobuf:"varint,3,opt,name=page,proto3" json:"page,omitempty"`
+	// page_size defaults to 20, and may be at most 100
+	PageSize int32 `protobuf:"varint,4,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// sort is one of id, title, year or runtime, prefixed with "-" for descending order
+	Sort string `protobuf:"bytes,5,opt,name=sort,proto3" json:"sort,omitempty"`
+}
+
+func (x *ListMoviesRequest) Reset() {
+	*x = ListMoviesRequest{}
+	mi := &file_movies_v1_movies_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMoviesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMoviesRequest) ProtoMessage() {}
+
+func (x *ListMoviesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMoviesRequest.ProtoReflect.Descriptor instead.
+func (*ListMoviesRequest) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListMoviesRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *ListMoviesRequest) GetGenres() []string {
+	if x != nil {
+		return x.Genres
+	}
+	return nil
+}
+
+func (x *ListMoviesRequest) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *ListMoviesRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListMoviesRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+type ListMoviesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Movies   []*Movie  `protobuf:"bytes,1,rep,name=movies,proto3" json:"movies,omitempty"`
+	Metadata *Metadata `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
+}
+
+func (x *ListMoviesResponse) Reset() {
+	*x = ListMoviesResponse{}
+	mi := &file_movies_v1_movies_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMoviesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMoviesResponse) ProtoMessage() {}
+
+func (x *ListMoviesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMoviesResponse.ProtoReflect.Descriptor instead.
+func (*ListMoviesResponse) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListMoviesResponse) GetMovies() []*Movie {
+	if x != nil {
+		return x.Movies
+	}
+	return nil
+}
+
+func (x *ListMoviesResponse) GetMetadata() *Metadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type Metadata struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	CurrentPage  int32 `protobuf:"varint,1,opt,name=current_page,json=currentPage,proto3" json:"current_page,omitempty"`
+	PageSize     int32 `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	FirstPage    int32 `protobuf:"varint,3,opt,name=first_page,json=firstPage,proto3" json:"first_page,omitempty"`
+	LastPage     int32 `protobuf:"varint,4,opt,name=last_page,json=lastPage,proto3" json:"last_page,omitempty"`
+	TotalRecords int32 `protobuf:"varint,5,opt,name=total_records,json=totalRecords,proto3" json:"total_records,omitempty"`
+}
+
+func (x *Metadata) Reset() {
+	*x = Metadata{}
+	mi := &file_movies_v1_movies_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Metadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Metadata) ProtoMessage() {}
+
+func (x *Metadata) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Metadata.ProtoReflect.Descriptor instead.
+func (*Metadata) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Metadata) GetCurrentPage() int32 {
+	if x != nil {
+		return x.CurrentPage
+	}
+	return 0
+}
+
+func (x *Metadata) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *Metadata) GetFirstPage() int32 {
+	if x != nil {
+		return x.FirstPage
+	}
+	return 0
+}
+
+func (x *Metadata) GetLastPage() int32 {
+	if x != nil {
+		return x.LastPage
+	}
+	return 0
+}
+
+func (x *Metadata) GetTotalRecords() int32 {
+	if x != nil {
+		return x.TotalRecords
+	}
+	return 0
+}
+
+type CreateMovieRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Title   string      `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	ImdbId  string      `protobuf:"bytes,2,opt,name=imdb_id,json=imdbId,proto3" json:"imdb_id,omitempty"`
+	Year    int32       `protobuf:"varint,3,opt,name=year,proto3" json:"year,omitempty"`
+	Runtime int32       `protobuf:"varint,4,opt,name=runtime,proto3" json:"runtime,omitempty"`
+	Genres  []string    `protobuf:"bytes,5,rep,name=genres,proto3" json:"genres,omitempty"`
+	Links   *MovieLinks `protobuf:"bytes,6,opt,name=links,proto3" json:"links,omitempty"`
+}
+
+func (x *CreateMovieRequest) Reset() {
+	*x = CreateMovieRequest{}
+	mi := &file_movies_v1_movies_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateMovieRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateMovieRequest) ProtoMessage() {}
+
+func (x *CreateMovieRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateMovieRequest.ProtoReflect.Descriptor instead.
+func (*CreateMovieRequest) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CreateMovieRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *CreateMovieRequest) GetImdbId() string {
+	if x != nil {
+		return x.ImdbId
+	}
+	return ""
+}
+
+func (x *CreateMovieRequest) GetYear() int32 {
+	if x != nil {
+		return x.Year
+	}
+	return 0
+}
+
+func (x *CreateMovieRequest) GetRuntime() int32 {
+	if x != nil {
+		return x.Runtime
+	}
+	return 0
+}
+
+func (x *CreateMovieRequest) GetGenres() []string {
+	if x != nil {
+		return x.Genres
+	}
+	return nil
+}
+
+func (x *CreateMovieRequest) GetLinks() *MovieLinks {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+type CreateMovieResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Movie *Movie `protobuf:"bytes,1,opt,name=movie,proto3" json:"movie,omitempty"`
+}
+
+func (x *CreateMovieResponse) Reset() {
+	*x = CreateMovieResponse{}
+	mi := &file_movies_v1_movies_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateMovieResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateMovieResponse) ProtoMessage() {}
+
+func (x *CreateMovieResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateMovieResponse.ProtoReflect.Descriptor instead.
+func (*CreateMovieResponse) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CreateMovieResponse) GetMovie() *Movie {
+	if x != nil {
+		return x.Movie
+	}
+	return nil
+}
+
+// UpdateMovieRequest changes the fields which are set, leaving the others as they are
+type UpdateMovieRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Movie   *MovieRef `protobuf:"bytes,1,opt,name=movie,proto3" json:"movie,omitempty"`
+	Title   *string   `protobuf:"bytes,2,opt,name=title,proto3,oneof" json:"title,omitempty"`
+	ImdbId  *string   `protobuf:"bytes,3,opt,name=imdb_id,json=imdbId,proto3,oneof" json:"imdb_id,omitempty"`
+	Year    *int32    `protobuf:"varint,4,opt,name=year,proto3,oneof" json:"year,omitempty"`
+	Runtime *int32    `protobuf:"varint,5,opt,name=runtime,proto3,oneof" json:"runtime,omitempty"`
+	// genres replaces the genres when set
+	Genres *Genres           `protobuf:"bytes,6,opt,name=genres,proto3" json:"genres,omitempty"`
+	Links  *UpdateMovieLinks `protobuf:"bytes,7,opt,name=links,proto3" json:"links,omitempty"`
+	// expected_version makes the update fail with ABORTED if the movie has changed
+	ExpectedVersion *int32 `protobuf:"varint,8,opt,name=expected_version,json=expectedVersion,proto3,oneof" json:"expected_version,omitempty"`
+}
+
+func (x *UpdateMovieRequest) Reset() {
+	*x = UpdateMovieRequest{}
+	mi := &file_movies_v1_movies_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMovieRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMovieRequest) ProtoMessage() {}
+
+func (x *UpdateMovieRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMovieRequest.ProtoReflect.Descriptor instead.
+func (*UpdateMovieRequest) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UpdateMovieRequest) GetMovie() *MovieRef {
+	if x != nil {
+		return x.Movie
+	}
+	return nil
+}
+
+func (x *UpdateMovieRequest) GetTitle() string {
+	if x != nil && x.Title != nil {
+		return *x.Title
+	}
+	return ""
+}
+
+func (x *UpdateMovieRequest) GetImdbId() string {
+	if x != nil && x.ImdbId != nil {
+		return *x.ImdbId
+	}
+	return ""
+}
+
+func (x *UpdateMovieRequest) GetYear() int32 {
+	if x != nil && x.Year != nil {
+		return *x.Year
+	}
+	return 0
+}
+
+func (x *UpdateMovieRequest) GetRuntime() int32 {
+	if x != nil && x.Runtime != nil {
+		return *x.Runtime
+	}
+	return 0
+}
+
+func (x *UpdateMovieRequest) GetGenres() *Genres {
+	if x != nil {
+		return x.Genres
+	}
+	return nil
+}
+
+func (x *UpdateMovieRequest) GetLinks() *UpdateMovieLinks {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+func (x *UpdateMovieRequest) GetExpectedVersion() int32 {
+	if x != nil && x.ExpectedVersion != nil {
+		return *x.ExpectedVersion
+	}
+	return 0
+}
+
+type Genres struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Values []string `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+}
+
+func (x *Genres) Reset() {
+	*x = Genres{}
+	mi := &file_movies_v1_movies_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Genres) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Genres) ProtoMessage() {}
+
+func (x *Genres) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Genres.ProtoReflect.Descriptor instead.
+func (*Genres) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Genres) GetValues() []string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type UpdateMovieLinks struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TrailerUrl *string `protobuf:"bytes,1,opt,name=trailer_url,json=trailerUrl,proto3,oneof" json:"trailer_url,omitempty"`
+	Homepage   *string `protobuf:"bytes,2,opt,name=homepage,proto3,oneof" json:"homepage,omitempty"`
+	Wiki       *string `protobuf:"bytes,3,opt,name=wiki,proto3,oneof" json:"wiki,omitempty"`
+}
+
+func (x *UpdateMovieLinks) Reset() {
+	*x = UpdateMovieLinks{}
+	mi := &file_movies_v1_movies_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMovieLinks) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMovieLinks) ProtoMessage() {}
+
+func (x *UpdateMovieLinks) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMovieLinks.ProtoReflect.Descriptor instead.
+func (*UpdateMovieLinks) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UpdateMovieLinks) GetTrailerUrl() string {
+	if x != nil && x.TrailerUrl != nil {
+		return *x.TrailerUrl
+	}
+	return ""
+}
+
+func (x *UpdateMovieLinks) GetHomepage() string {
+	if x != nil && x.Homepage != nil {
+		return *x.Homepage
+	}
+	return ""
+}
+
+func (x *UpdateMovieLinks) GetWiki() string {
+	if x != nil && x.Wiki != nil {
+		return *x.Wiki
+	}
+	return ""
+}
+
+type UpdateMovieResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Movie *Movie `protobuf:"bytes,1,opt,name=movie,proto3" json:"movie,omitempty"`
+}
+
+func (x *UpdateMovieResponse) Reset() {
+	*x = UpdateMovieResponse{}
+	mi := &file_movies_v1_movies_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMovieResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMovieResponse) ProtoMessage() {}
+
+func (x *UpdateMovieResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMovieResponse.ProtoReflect.Descriptor instead.
+func (*UpdateMovieResponse) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *UpdateMovieResponse) GetMovie() *Movie {
+	if x != nil {
+		return x.Movie
+	}
+	return nil
+}
+
+type DeleteMovieRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Movie *MovieRef `protobuf:"bytes,1,opt,name=movie,proto3" json:"movie,omitempty"`
+}
+
+func (x *DeleteMovieRequest) Reset() {
+	*x = DeleteMovieRequest{}
+	mi := &file_movies_v1_movies_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteMovieRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteMovieRequest) ProtoMessage() {}
+
+func (x *DeleteMovieRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteMovieRequest.ProtoReflect.Descriptor instead.
+func (*DeleteMovieRequest) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *DeleteMovieRequest) GetMovie() *MovieRef {
+	if x != nil {
+		return x.Movie
+	}
+	return nil
+}
+
+type DeleteMovieResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DeleteMovieResponse) Reset() {
+	*x = DeleteMovieResponse{}
+	mi := &file_movies_v1_movies_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteMovieResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteMovieResponse) ProtoMessage() {}
+
+func (x *DeleteMovieResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movies_v1_movies_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteMovieResponse.ProtoReflect.Descriptor instead.
+func (*DeleteMovieResponse) Descriptor() ([]byte, []int) {
+	return file_movies_v1_movies_proto_rawDescGZIP(), []int{15}
+}
+
+var File_movies_v1_movies_proto protoreflect.FileDescriptor
+
+var file_movies_v1_movies_proto_rawDesc = []byte{
+	0x0a, 0x16, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2f, 0x76, 0x31, 0x2f, 0x6d, 0x6f, 0x76, 0x69,
+	0x65, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x14, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c,
+	0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x22, 0x80,
+	0x02, 0x0a, 0x05, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x75, 0x75, 0x69, 0x64,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x75, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05,
+	0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x69, 0x74,
+	0x6c, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x6c, 0x75, 0x67, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x73, 0x6c, 0x75, 0x67, 0x12, 0x17, 0x0a, 0x07, 0x69, 0x6d, 0x64, 0x62, 0x5f, 0x69,
+	0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x69, 0x6d, 0x64, 0x62, 0x49, 0x64, 0x12,
+	0x12, 0x0a, 0x04, 0x79, 0x65, 0x61, 0x72, 0x18, 0x06, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x79,
+	0x65, 0x61, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x07,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x16, 0x0a,
+	0x06, 0x67, 0x65, 0x6e, 0x72, 0x65, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x67,
+	0x65, 0x6e, 0x72, 0x65, 0x73, 0x12, 0x36, 0x0a, 0x05, 0x6c, 0x69, 0x6e, 0x6b, 0x73, 0x18, 0x09,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x20, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68,
+	0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f, 0x76, 0x69,
+	0x65, 0x4c, 0x69, 0x6e, 0x6b, 0x73, 0x52, 0x05, 0x6c, 0x69, 0x6e, 0x6b, 0x73, 0x12, 0x18, 0x0a,
+	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07,
+	0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x4a, 0x04, 0x08, 0x01, 0x10, 0x02, 0x52, 0x02, 0x69,
+	0x64, 0x22, 0x5d, 0x0a, 0x0a, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x4c, 0x69, 0x6e, 0x6b, 0x73, 0x12,
+	0x1f, 0x0a, 0x0b, 0x74, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x74, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x55, 0x72, 0x6c,
+	0x12, 0x1a, 0x0a, 0x08, 0x68, 0x6f, 0x6d, 0x65, 0x70, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x68, 0x6f, 0x6d, 0x65, 0x70, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04,
+	0x77, 0x69, 0x6b, 0x69, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x77, 0x69, 0x6b, 0x69,
+	0x22, 0x28, 0x0a, 0x08, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x66, 0x12, 0x12, 0x0a, 0x04,
+	0x75, 0x75, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x75, 0x69, 0x64,
+	0x4a, 0x04, 0x08, 0x02, 0x10, 0x03, 0x52, 0x02, 0x69, 0x64, 0x22, 0x47, 0x0a, 0x0f, 0x47, 0x65,
+	0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x34, 0x0a,
+	0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x67,
+	0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73,
+	0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x66, 0x52, 0x05, 0x6d, 0x6f,
+	0x76, 0x69, 0x65, 0x22, 0x45, 0x0a, 0x10, 0x47, 0x65, 0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x31, 0x0a, 0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69,
+	0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f,
+	0x76, 0x69, 0x65, 0x52, 0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x22, 0x86, 0x01, 0x0a, 0x11, 0x4c,
+	0x69, 0x73, 0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x14, 0x0a, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x67, 0x65, 0x6e, 0x72, 0x65, 0x73,
+	0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x67, 0x65, 0x6e, 0x72, 0x65, 0x73, 0x12, 0x12,
+	0x0a, 0x04, 0x70, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x70, 0x61,
+	0x67, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x70, 0x61, 0x67, 0x65, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x70, 0x61, 0x67, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x12,
+	0x12, 0x0a, 0x04, 0x73, 0x6f, 0x72, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x73,
+	0x6f, 0x72, 0x74, 0x22, 0x85, 0x01, 0x0a, 0x12, 0x4c, 0x69, 0x73, 0x74, 0x4d, 0x6f, 0x76, 0x69,
+	0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x33, 0x0a, 0x06, 0x6d, 0x6f,
+	0x76, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x65,
+	0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76,
+	0x31, 0x2e, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x06, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x12,
+	0x3a, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1e, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d,
+	0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74,
+	0x61, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x22, 0xab, 0x01, 0x0a, 0x08,
+	0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x75, 0x72, 0x72,
+	0x65, 0x6e, 0x74, 0x5f, 0x70, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0b,
+	0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x50, 0x61, 0x67, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x70,
+	0x61, 0x67, 0x65, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08,
+	0x70, 0x61, 0x67, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x69, 0x72, 0x73,
+	0x74, 0x5f, 0x70, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x66, 0x69,
+	0x72, 0x73, 0x74, 0x50, 0x61, 0x67, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x61, 0x73, 0x74, 0x5f,
+	0x70, 0x61, 0x67, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x6c, 0x61, 0x73, 0x74,
+	0x50, 0x61, 0x67, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x72, 0x65,
+	0x63, 0x6f, 0x72, 0x64, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x74, 0x6f, 0x74,
+	0x61, 0x6c, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x22, 0xc1, 0x01, 0x0a, 0x12, 0x43, 0x72,
+	0x65, 0x61, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x14, 0x0a, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x69, 0x6d, 0x64, 0x62, 0x5f, 0x69,
+	0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x69, 0x6d, 0x64, 0x62, 0x49, 0x64, 0x12,
+	0x12, 0x0a, 0x04, 0x79, 0x65, 0x61, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x79,
+	0x65, 0x61, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x16, 0x0a,
+	0x06, 0x67, 0x65, 0x6e, 0x72, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x67,
+	0x65, 0x6e, 0x72, 0x65, 0x73, 0x12, 0x36, 0x0a, 0x05, 0x6c, 0x69, 0x6e, 0x6b, 0x73, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x20, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68,
+	0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f, 0x76, 0x69,
+	0x65, 0x4c, 0x69, 0x6e, 0x6b, 0x73, 0x52, 0x05, 0x6c, 0x69, 0x6e, 0x6b, 0x73, 0x22, 0x48, 0x0a,
+	0x13, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x31, 0x0a, 0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74,
+	0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f, 0x76, 0x69, 0x65,
+	0x52, 0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x22, 0x9f, 0x03, 0x0a, 0x12, 0x55, 0x70, 0x64, 0x61,
+	0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x34,
+	0x0a, 0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e,
+	0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65,
+	0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x66, 0x52, 0x05, 0x6d,
+	0x6f, 0x76, 0x69, 0x65, 0x12, 0x19, 0x0a, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x88, 0x01, 0x01, 0x12,
+	0x1c, 0x0a, 0x07, 0x69, 0x6d, 0x64, 0x62, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x48, 0x01, 0x52, 0x06, 0x69, 0x6d, 0x64, 0x62, 0x49, 0x64, 0x88, 0x01, 0x01, 0x12, 0x17, 0x0a,
+	0x04, 0x79, 0x65, 0x61, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x48, 0x02, 0x52, 0x04, 0x79,
+	0x65, 0x61, 0x72, 0x88, 0x01, 0x01, 0x12, 0x1d, 0x0a, 0x07, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d,
+	0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x48, 0x03, 0x52, 0x07, 0x72, 0x75, 0x6e, 0x74, 0x69,
+	0x6d, 0x65, 0x88, 0x01, 0x01, 0x12, 0x34, 0x0a, 0x06, 0x67, 0x65, 0x6e, 0x72, 0x65, 0x73, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67,
+	0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x6e,
+	0x72, 0x65, 0x73, 0x52, 0x06, 0x67, 0x65, 0x6e, 0x72, 0x65, 0x73, 0x12, 0x3c, 0x0a, 0x05, 0x6c,
+	0x69, 0x6e, 0x6b, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x26, 0x2e, 0x67, 0x72, 0x65,
+	0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76,
+	0x31, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x4c, 0x69, 0x6e,
+	0x6b, 0x73, 0x52, 0x05, 0x6c, 0x69, 0x6e, 0x6b, 0x73, 0x12, 0x2e, 0x0a, 0x10, 0x65, 0x78, 0x70,
+	0x65, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x05, 0x48, 0x04, 0x52, 0x0f, 0x65, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x56,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x88, 0x01, 0x01, 0x42, 0x08, 0x0a, 0x06, 0x5f, 0x74, 0x69,
+	0x74, 0x6c, 0x65, 0x42, 0x0a, 0x0a, 0x08, 0x5f, 0x69, 0x6d, 0x64, 0x62, 0x5f, 0x69, 0x64, 0x42,
+	0x07, 0x0a, 0x05, 0x5f, 0x79, 0x65, 0x61, 0x72, 0x42, 0x0a, 0x0a, 0x08, 0x5f, 0x72, 0x75, 0x6e,
+	0x74, 0x69, 0x6d, 0x65, 0x42, 0x13, 0x0a, 0x11, 0x5f, 0x65, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65,
+	0x64, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0x20, 0x0a, 0x06, 0x47, 0x65, 0x6e,
+	0x72, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x06, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x22, 0x98, 0x01, 0x0a, 0x10,
+	0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x4c, 0x69, 0x6e, 0x6b, 0x73,
+	0x12, 0x24, 0x0a, 0x0b, 0x74, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x5f, 0x75, 0x72, 0x6c, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x0a, 0x74, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72,
+	0x55, 0x72, 0x6c, 0x88, 0x01, 0x01, 0x12, 0x1f, 0x0a, 0x08, 0x68, 0x6f, 0x6d, 0x65, 0x70, 0x61,
+	0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x48, 0x01, 0x52, 0x08, 0x68, 0x6f, 0x6d, 0x65,
+	0x70, 0x61, 0x67, 0x65, 0x88, 0x01, 0x01, 0x12, 0x17, 0x0a, 0x04, 0x77, 0x69, 0x6b, 0x69, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x48, 0x02, 0x52, 0x04, 0x77, 0x69, 0x6b, 0x69, 0x88, 0x01, 0x01,
+	0x42, 0x0e, 0x0a, 0x0c, 0x5f, 0x74, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x5f, 0x75, 0x72, 0x6c,
+	0x42, 0x0b, 0x0a, 0x09, 0x5f, 0x68, 0x6f, 0x6d, 0x65, 0x70, 0x61, 0x67, 0x65, 0x42, 0x07, 0x0a,
+	0x05, 0x5f, 0x77, 0x69, 0x6b, 0x69, 0x22, 0x48, 0x0a, 0x13, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65,
+	0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x31, 0x0a,
+	0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67,
+	0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73,
+	0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65,
+	0x22, 0x4a, 0x0a, 0x12, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x34, 0x0a, 0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67,
+	0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f, 0x76,
+	0x69, 0x65, 0x52, 0x65, 0x66, 0x52, 0x05, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x22, 0x15, 0x0a, 0x13,
+	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x32, 0xf6, 0x03, 0x0a, 0x0c, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x53, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x12, 0x59, 0x0a, 0x08, 0x47, 0x65, 0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65,
+	0x12, 0x25, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f,
+	0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c,
+	0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x47,
+	0x65, 0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x5f, 0x0a, 0x0a, 0x4c, 0x69, 0x73, 0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x12, 0x27, 0x2e,
+	0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65,
+	0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x28, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69,
+	0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69,
+	0x73, 0x74, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x62, 0x0a, 0x0b, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x12,
+	0x28, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76,
+	0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4d, 0x6f, 0x76,
+	0x69, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x29, 0x2e, 0x67, 0x72, 0x65, 0x65,
+	0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31,
+	0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x62, 0x0a, 0x0b, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4d, 0x6f,
+	0x76, 0x69, 0x65, 0x12, 0x28, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74,
+	0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74,
+	0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x29, 0x2e,
+	0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65,
+	0x73, 0x2e, 0x76, 0x31, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x62, 0x0a, 0x0b, 0x44, 0x65, 0x6c, 0x65,
+	0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x12, 0x28, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c,
+	0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x44,
+	0x65, 0x6c, 0x65, 0x74, 0x65, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x29, 0x2e, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x2e, 0x6d,
+	0x6f, 0x76, 0x69, 0x65, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4d,
+	0x6f, 0x76, 0x69, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x46, 0x5a, 0x44,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x76, 0x69, 0x61, 0x67,
+	0x61, 0x72, 0x77, 0x61, 0x6c, 0x31, 0x32, 0x31, 0x32, 0x2f, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x6c,
+	0x69, 0x67, 0x68, 0x74, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x67, 0x72,
+	0x70, 0x63, 0x2f, 0x6d, 0x6f, 0x76, 0x69, 0x65, 0x73, 0x76, 0x31, 0x3b, 0x6d, 0x6f, 0x76, 0x69,
+	0x65, 0x73, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_movies_v1_movies_proto_rawDescOnce sync.Once
+	file_movies_v1_movies_proto_rawDescData = file_movies_v1_movies_proto_rawDesc
+)
+
+func file_movies_v1_movies_proto_rawDescGZIP() []byte {
+	file_movies_v1_movies_proto_rawDescOnce.Do(func() {
+		file_movies_v1_movies_proto_rawDescData = protoimpl.X.CompressGZIP(file_movies_v1_movies_proto_rawDescData)
+	})
+	return file_movies_v1_movies_proto_rawDescData
+}
+
+var file_movies_v1_movies_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_movies_v1_movies_proto_goTypes = []any{
+	(*Movie)(nil),               // 0: greenlight.movies.v1.Movie
+	(*MovieLinks)(nil),          // 1: greenlight.movies.v1.MovieLinks
+	(*MovieRef)(nil),            // 2: greenlight.movies.v1.MovieRef
+	(*GetMovieRequest)(nil),     // 3: greenlight.movies.v1.GetMovieRequest
+	(*GetMovieResponse)(nil),    // 4: greenlight.movies.v1.GetMovieResponse
+	(*ListMoviesRequest)(nil),   // 5: greenlight.movies.v1.ListMoviesRequest
+	(*ListMoviesResponse)(nil),  // 6: greenlight.movies.v1.ListMoviesResponse
+	(*Metadata)(nil),            // 7: greenlight.movies.v1.Metadata
+	(*CreateMovieRequest)(nil),  // 8: greenlight.movies.v1.CreateMovieRequest
+	(*CreateMovieResponse)(nil), // 9: greenlight.movies.v1.CreateMovieResponse
+	(*UpdateMovieRequest)(nil),  // 10: greenlight.movies.v1.UpdateMovieRequest
+	(*Genres)(nil),              // 11: greenlight.movies.v1.Genres
+	(*UpdateMovieLinks)(nil),    // 12: greenlight.movies.v1.UpdateMovieLinks
+	(*UpdateMovieResponse)(nil), // 13: greenlight.movies.v1.UpdateMovieResponse
+	(*DeleteMovieRequest)(nil),  // 14: greenlight.movies.v1.DeleteMovieRequest
+	(*DeleteMovieResponse)(nil), // 15: greenlight.movies.v1.DeleteMovieResponse
+}
+var file_movies_v1_movies_proto_depIdxs = []int32{
+	1,  // 0: greenlight.movies.v1.Movie.links:type_name -> greenlight.movies.v1.MovieLinks
+	2,  // 1: greenlight.movies.v1.GetMovieRequest.movie:type_name -> greenlight.movies.v1.MovieRef
+	0,  // 2: greenlight.movies.v1.GetMovieResponse.movie:type_name -> greenlight.movies.v1.Movie
+	0,  // 3: greenlight.movies.v1.ListMoviesResponse.movies:type_name -> greenlight.movies.v1.Movie
+	7,  // 4: greenlight.movies.v1.ListMoviesResponse.metadata:type_name -> greenlight.movies.v1.Metadata
+	1,  // 5: greenlight.movies.v1.CreateMovieRequest.links:type_name -> greenlight.movies.v1.MovieLinks
+	0,  // 6: greenlight.movies.v1.CreateMovieResponse.movie:type_name -> greenlight.movies.v1.Movie
+	2,  // 7: greenlight.movies.v1.UpdateMovieRequest.movie:type_name -> greenlight.movies.v1.MovieRef
+	11, // 8: greenlight.movies.v1.UpdateMovieRequest.genres:type_name -> greenlight.movies.v1.Genres
+	12, // 9: greenlight.movies.v1.UpdateMovieRequest.links:type_name -> greenlight.movies.v1.UpdateMovieLinks
+	0,  // 10: greenlight.movies.v1.UpdateMovieResponse.movie:type_name -> greenlight.movies.v1.Movie
+	2,  // 11: greenlight.movies.v1.DeleteMovieRequest.movie:type_name -> greenlight.movies.v1.MovieRef
+	3,  // 12: greenlight.movies.v1.MovieService.GetMovie:input_type -> greenlight.movies.v1.GetMovieRequest
+	5,  // 13: greenlight.movies.v1.MovieService.ListMovies:input_type -> greenlight.movies.v1.ListMoviesRequest
+	8,  // 14: greenlight.movies.v1.MovieService.CreateMovie:input_type -> greenlight.movies.v1.CreateMovieRequest
+	10, // 15: greenlight.movies.v1.MovieService.UpdateMovie:input_type -> greenlight.movies.v1.UpdateMovieRequest
+	14, // 16: greenlight.movies.v1.MovieService.DeleteMovie:input_type -> greenlight.movies.v1.DeleteMovieRequest
+	4,  // 17: greenlight.movies.v1.MovieService.GetMovie:output_type -> greenlight.movies.v1.GetMovieResponse
+	6,  // 18: greenlight.movies.v1.MovieService.ListMovies:output_type -> greenlight.movies.v1.ListMoviesResponse
+	9,  // 19: greenlight.movies.v1.MovieService.CreateMovie:output_type -> greenlight.movies.v1.CreateMovieResponse
+	13, // 20: greenlight.movies.v1.MovieService.UpdateMovie:output_type -> greenlight.movies.v1.UpdateMovieResponse
+	15, // 21: greenlight.movies.v1.MovieService.DeleteMovie:output_type -> greenlight.movies.v1.DeleteMovieResponse
+	17, // [17:22] is the sub-list for method output_type
+	12, // [12:17] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_movies_v1_movies_proto_init() }
+func file_movies_v1_movies_proto_init() {
+	if File_movies_v1_movies_proto != nil {
+		return
+	}
+	file_movies_v1_movies_proto_msgTypes[10].OneofWrappers = []any{}
+	file_movies_v1_movies_proto_msgTypes[12].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_movies_v1_movies_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_movies_v1_movies_proto_goTypes,
+		DependencyIndexes: file_movies_v1_movies_proto_depIdxs,
+		MessageInfos:      file_movies_v1_movies_proto_msgTypes,
+	}.Build()
+	File_movies_v1_movies_proto = out.File
+	file_movies_v1_movies_proto_rawDesc = nil
+	file_movies_v1_movies_proto_goTypes = nil
+	file_movies_v1_movies_proto_depIdxs = nil
+}
@@ -0,0 +1,119 @@
+package i18n
+
+// german holds the German translations, keyed by the English message or format
+var german = map[string]string{
+	// error responses
+	"the server encountered a problem and could not process your request":   "der Server hat ein Problem festgestellt und konnte Ihre Anfrage nicht verarbeiten",
+	"the requested resource could not be found":                             "die angeforderte Ressource wurde nicht gefunden",
+	"the %s method is not supported for this resource":                      "die Methode %s wird für diese Ressource nicht unterstützt",
+	"unable to update the record due to an edit conflict":                   "der Datensatz konnte wegen eines Bearbeitungskonflikts nicht aktualisiert werden",
+	"unable to update the record due to an edit conflict, please try again": "der Datensatz konnte wegen eines Bearbeitungskonflikts nicht aktualisiert werden, bitte versuchen Sie es erneut",
+	"rate limit exceeded":                                               "Anfragelimit überschritten",
+	"invalid or missing authentication token":                           "ungültiges oder fehlendes Authentifizierungstoken",
+	"a trusted client certificate is required to access this resource":  "für den Zugriff auf diese Ressource ist ein vertrauenswürdiges Client-Zertifikat erforderlich",
+	"you do not have the necessary permissions to access this resource": "Sie haben nicht die nötigen Berechtigungen, um auf diese Ressource zuzugreifen",
+	"invalid API key": "ungültiger API-Schlüssel",
+	"the server is overloaded, please try again later":                                     "der Server ist überlastet, bitte versuchen Sie es später erneut",
+	"the server is undergoing maintenance, please try again later":                         "der Server wird gewartet, bitte versuchen Sie es später erneut",
+	"API version %s is not supported by this route; supported versions: %s":                "die API-Version %s wird von dieser Route nicht unterstützt; unterstützte Versionen: %s",
+	"monthly request quota exceeded; the quota resets at %s":                               "monatliches Anfragekontingent überschritten; das Kontingent wird am %s zurückgesetzt",
+	"too many failed authentication attempts, please try again later":                      "zu viele fehlgeschlagene Anmeldeversuche, bitte versuchen Sie es später erneut",
+	"an API key is required to access this resource":                                       "für den Zugriff auf diese Ressource ist ein API-Schlüssel erforderlich",
+	"the requested media types are not supported by this route; supported media types: %s": "die angefragten Medientypen werden von dieser Route nicht unterstützt; unterstützte Medientypen: %s",
+	"the input failed validation":                                                          "die Eingabe ist ungültig",
+	"invalid id parameter":                                                                 "ungültiger ID-Parameter",
+
+	// request bodies
+	"body must not be larger than %d bytes":               "der Anfragetext darf nicht größer als %d Bytes sein",
+	"body contains badly-formed JSON (at character %d)":   "der Anfragetext enthält fehlerhaftes JSON (bei Zeichen %d)",
+	"body contains badly-formed JSON":                     "der Anfragetext enthält fehlerhaftes JSON",
+	"body contains incorrect JSON type for field %q":      "der Anfragetext enthält einen falschen JSON-Typ für das Feld %q",
+	"body contains incorrect JSON type (at character %d)": "der Anfragetext enthält einen falschen JSON-Typ (bei Zeichen %d)",
+	"body must not be empty":                              "der Anfragetext darf nicht leer sein",
+	"body contains unknown key %s":                        "der Anfragetext enthält den unbekannten Schlüssel %s",
+	"body must contain a single JSON value":               "der Anfragetext muss genau einen JSON-Wert enthalten",
+	"body contains badly-formed CSV: %s":                  "der Anfragetext enthält fehlerhaftes CSV: %s",
+	"CSV header contains unknown column %q":               "die CSV-Kopfzeile enthält die unbekannte Spalte %q",
+	"CSV header contains duplicate column %q":             "die CSV-Kopfzeile enthält die Spalte %q mehrfach",
+	"CSV header must contain a title column":              "die CSV-Kopfzeile muss eine Spalte title enthalten",
+	"line must contain a single JSON value":               "die Zeile muss genau einen JSON-Wert enthalten",
+	"must have %d fields":                                 "muss %d Felder haben",
+
+	// validation
+	"must be provided":                                                       "muss angegeben werden",
+	"must not be null":                                                       "darf nicht null sein",
+	"is not a known field":                                                   "ist kein bekanntes Feld",
+	"contains unknown field %q":                                              "enthält das unbekannte Feld %q",
+	"has an invalid format":                                                  "hat ein ungültiges Format",
+	"must be a string":                                                       "muss eine Zeichenkette sein",
+	"must be a number":                                                       "muss eine Zahl sein",
+	"must be an integer":                                                     "muss eine ganze Zahl sein",
+	"must be an integer value":                                               "muss eine ganze Zahl sein",
+	"must be a boolean":                                                      "muss ein Wahrheitswert sein",
+	"must be an array":                                                       "muss ein Array sein",
+	"must be an object":                                                      "muss ein Objekt sein",
+	"must be an integer or a string":                                         "muss eine ganze Zahl oder eine Zeichenkette sein",
+	"must match exactly one of the allowed forms":                            "muss genau einer der erlaubten Formen entsprechen",
+	"is not a known field; did you mean %q?":                                 "ist kein bekanntes Feld; meinten Sie %q?",
+	"must be one of %s":                                                      "muss einer der folgenden Werte sein: %s",
+	"must be a positive integer":                                             "muss eine positive ganze Zahl sein",
+	"must be greater than zero":                                              "muss größer als null sein",
+	"must be greater than %d":                                                "muss größer als %d sein",
+	"must be at least %d":                                                    "muss mindestens %d sein",
+	"must not be more than %d":                                               "darf nicht größer als %d sein",
+	"must be a maximum of %d":                                                "darf höchstens %d sein",
+	"must be a maximum of 10 million":                                        "darf höchstens 10 Millionen sein",
+	"must be between %d and %d":                                              "muss zwischen %d und %d liegen",
+	"must be between 1h and 720h":                                            "muss zwischen 1h und 720h liegen",
+	"must be at least %d characters long":                                    "muss mindestens %d Zeichen lang sein",
+	"must not be more than %d characters long":                               "darf nicht länger als %d Zeichen sein",
+	"must be at least %d bytes long":                                         "muss mindestens %d Bytes lang sein",
+	"must not be more than %d bytes long":                                    "darf nicht länger als %d Bytes sein",
+	"must contain at least 1 item":                                           "muss mindestens ein Element enthalten",
+	"must contain at least %d items":                                         "muss mindestens %d Elemente enthalten",
+	"must not contain more than 1 item":                                      "darf nicht mehr als ein Element enthalten",
+	"must not contain more than %d items":                                    "darf nicht mehr als %d Elemente enthalten",
+	"must not contain duplicate values":                                      "darf keine doppelten Werte enthalten",
+	"must be unique":                                                         "muss eindeutig sein",
+	"must be a valid UUID":                                                   "muss eine gültige UUID sein",
+	"must be a valid http or https URL":                                      "muss eine gültige http- oder https-URL sein",
+	"must be a valid IMDb title ID (e.g. tt0111161)":                         "muss eine gültige IMDb-Titel-ID sein (z. B. tt0111161)",
+	"must match the IMDb ID in the URL":                                      "muss mit der IMDb-ID in der URL übereinstimmen",
+	"a movie with this IMDb ID already exists":                               "ein Film mit dieser IMDb-ID existiert bereits",
+	"a tenant with this slug already exists":                                 "ein Mandant mit diesem Slug existiert bereits",
+	"must not be in the future":                                              "darf nicht in der Zukunft liegen",
+	"must be a number of minutes":                                            "muss eine Anzahl von Minuten sein",
+	"must be a duration such as 24h":                                         "muss eine Dauer wie 24h sein",
+	"must be a date in YYYY-MM-DD format":                                    "muss ein Datum im Format JJJJ-MM-TT sein",
+	"must be true or false":                                                  "muss true oder false sein",
+	"invalid sort value":                                                     "ungültiger Sortierwert",
+	"must contain at least 1 genre":                                          "muss mindestens ein Genre enthalten",
+	"must not contain more than %d genres":                                   "darf nicht mehr als %d Genres enthalten",
+	"must contain at least 1 id":                                             "muss mindestens eine ID enthalten",
+	"must not contain more than %d ids":                                      "darf nicht mehr als %d IDs enthalten",
+	"must only contain movie ids or uuids":                                   "darf nur Film-IDs oder UUIDs enthalten",
+	"must contain at least 1 movie":                                          "muss mindestens einen Film enthalten",
+	"must not contain more than %d movies":                                   "darf nicht mehr als %d Filme enthalten",
+	"more than %d movies would be deleted":                                   "es würden mehr als %d Filme gelöscht",
+	"either ids or filter must be provided":                                  "entweder ids oder filter muss angegeben werden",
+	"must not be provided together with ids":                                 "darf nicht zusammen mit ids angegeben werden",
+	"must set at least one of title, genres, year_before or year_after":      "muss mindestens eines von title, genres, year_before oder year_after festlegen",
+	"years must be positive":                                                 "Jahre müssen positiv sein",
+	"runtime must be string, number or human":                                "runtime muss string, number oder human sein",
+	"the request body must be JSON, with a Content-Type of application/json": "der Anfragetext muss JSON mit dem Content-Type application/json sein",
+	"must be a movie id or uuid":                                             "muss eine Film-ID oder UUID sein",
+	"must be an existing movie":                                              "muss ein vorhandener Film sein",
+	"must not be the movie itself":                                           "darf nicht der Film selbst sein",
+	"must be atomic or best_effort":                                          "muss atomic oder best_effort sein",
+	"must be csv or jsonl, or set by a text/csv or application/x-ndjson Content-Type": "muss csv oder jsonl sein oder durch einen Content-Type text/csv oder application/x-ndjson festgelegt werden",
+	"must contain at least 1 field":                                                      "muss mindestens ein Feld enthalten",
+	"must contain at least 1 event type":                                                 "muss mindestens einen Ereignistyp enthalten",
+	"must only contain movie.created, movie.updated or movie.deleted":                    "darf nur movie.created, movie.updated oder movie.deleted enthalten",
+	"must be pending, succeeded or failed":                                               "muss pending, succeeded oder failed sein",
+	"must be debug, info, warn or error":                                                 "muss debug, info, warn oder error sein",
+	"must not be less than limiter_rps":                                                  "darf nicht kleiner als limiter_rps sein",
+	"must be one of endpoints, fields or limits":                                         "muss endpoints, fields oder limits sein",
+	"must be one of the known areas":                                                     "muss einer der bekannten Bereiche sein",
+	"must be one of the known types":                                                     "muss einer der bekannten Typen sein",
+	"must only contain lowercase letters, digits and inner hyphens, up to 63 characters": "darf nur Kleinbuchstaben, Ziffern und innere Bindestriche enthalten, höchstens 63 Zeichen",
+}
@@ -0,0 +1,167 @@
+// Package i18n translates the messages the API sends to clients, such as error and
+// validation messages, into the languages the clients accept.
+//
+// Messages are written in English throughout the code, and the catalog of every
+// other language is keyed by the English messages. A key may be a format with %d,
+// %s, %q or %v verbs, which then matches every message formatted from it; the
+// values of the verbs are carried over into the translation, in order, or as
+// picked by explicit argument indexes such as %[2]s.
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default is the language of the messages as written, used for clients which accept
+// none of the supported languages
+const Default = "en"
+
+// catalogs holds the translations of each supported language other than Default,
+// keyed by the English message or format
+var catalogs = map[string]map[string]string{
+	"de": german,
+}
+
+// Negotiate picks the supported language the client prefers out of the languages
+// of an Accept-Language header, by their quality values. Regional variants match
+// their language, so de-CH selects de. It returns Default if the client accepts none
+// of them.
+func Negotiate(header string) string {
+	best, bestQ := Default, 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		// the first of equally preferred languages wins
+		if _, ok := catalogs[lang]; (ok || lang == Default) && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+
+	return best
+}
+
+// Translate returns the translation of message into lang, or message itself if lang
+// is not supported or has no translation for it
+func Translate(lang, message string) string {
+	catalog, ok := catalogs[lang]
+	if !ok {
+		return message
+	}
+
+	if translation, ok := catalog[message]; ok {
+		return translation
+	}
+
+	for _, f := range formatsOf(lang) {
+		values := f.rx.FindStringSubmatch(message)
+		if values == nil {
+			continue
+		}
+
+		// as with fmt, a verb without an index takes the value following the one
+		// taken by the previous verb
+		position := 0
+		return verbRX.ReplaceAllStringFunc(f.translation, func(verb string) string {
+			if index := verbRX.FindStringSubmatch(verb)[1]; index != "" {
+				position, _ = strconv.Atoi(index)
+			} else {
+				position++
+			}
+
+			if position < 1 || position >= len(values) {
+				return verb
+			}
+			return values[position]
+		})
+	}
+
+	return message
+}
+
+// TranslateAll returns a copy of a map of messages, such as validation errors keyed
+// by field, with every message translated into lang
+func TranslateAll(lang string, messages map[string][]string) map[string][]string {
+	if _, ok := catalogs[lang]; !ok || messages == nil {
+		return messages
+	}
+
+	translated := make(map[string][]string, len(messages))
+	for key, list := range messages {
+		translated[key] = make([]string, len(list))
+		for i, message := range list {
+			translated[key][i] = Translate(lang, message)
+		}
+	}
+	return translated
+}
+
+// verbRX matches the verbs of a format, with an optional explicit argument index
+var verbRX = regexp.MustCompile(`%(?:\[(\d+)\])?[dsqv]`)
+
+// format is a catalog key with verbs, compiled to match the messages formatted from it
+type format struct {
+	rx          *regexp.Regexp
+	translation string
+}
+
+var (
+	formats     = make(map[string][]format)
+	formatsOnce sync.Once
+)
+
+// formatsOf returns the compiled format keys of the catalog of lang
+func formatsOf(lang string) []format {
+	formatsOnce.Do(func() {
+		for lang, catalog := range catalogs {
+			for key, translation := range catalog {
+				if !verbRX.MatchString(key) {
+					continue
+				}
+				formats[lang] = append(formats[lang], compileFormat(key, translation))
+			}
+
+			// longer keys are tried first, so that "must be at least %d characters
+			// long" is not shadowed by a shorter key which also matches
+			slices.SortFunc(formats[lang], func(a, b format) int {
+				return len(b.rx.String()) - len(a.rx.String())
+			})
+		}
+	})
+
+	return formats[lang]
+}
+
+func compileFormat(key, translation string) format {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	last := 0
+	for _, loc := range verbRX.FindAllStringIndex(key, -1) {
+		pattern.WriteString(regexp.QuoteMeta(key[last:loc[0]]))
+		if key[loc[1]-1] == 'd' {
+			pattern.WriteString(`(-?\d+)`)
+		} else {
+			pattern.WriteString(`(.+?)`)
+		}
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(key[last:]))
+	pattern.WriteString("$")
+
+	return format{rx: regexp.MustCompile(pattern.String()), translation: translation}
+}
@@ -0,0 +1,39 @@
+// Package kvstore provides a small key-value store abstraction for short-lived
+// shared state (rate limit counters, cached values, one-time codes and locks),
+// with an in-memory implementation for single-node deployments and a Redis
+// implementation for clustered ones.
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by Get when the key doesn't exist or has expired
+	ErrNotFound = errors.New("kvstore: key not found")
+	// ErrLocked is returned by Lock when the lock is already held
+	ErrLocked = errors.New("kvstore: lock already held")
+)
+
+// Store is implemented by every backend. A ttl of zero means the key never expires.
+type Store interface {
+	// Get returns the value stored at key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value at key, replacing any existing value
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX stores value at key only if the key doesn't exist, and reports whether it did so
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Incr atomically increments the integer stored at key and returns the new value.
+	// A missing key starts from zero and is given the ttl; an existing key keeps its expiry.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// Lock acquires an exclusive lock named key which is released automatically after
+	// ttl, or earlier by calling the returned unlock function. It returns ErrLocked if
+	// the lock is held by someone else.
+	Lock(ctx context.Context, key string, ttl time.Duration) (unlock func(context.Context) error, err error)
+	// Close releases the resources held by the store
+	Close() error
+}
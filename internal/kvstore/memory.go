@@ -0,0 +1,178 @@
+package kvstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// Memory is a Store which keeps all keys in process memory. It is only suitable
+// for deployments running a single instance of the API.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	done    chan struct{}
+}
+
+// NewMemory creates an in-memory store and starts a background goroutine which
+// removes expired keys every minute until Close is called.
+func NewMemory() *Memory {
+	m := &Memory{
+		entries: make(map[string]memoryEntry),
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.done:
+				return
+			case now := <-ticker.C:
+				m.mu.Lock()
+				for key, entry := range m.entries {
+					if entry.expired(now) {
+						delete(m.entries, key)
+					}
+				}
+				m.mu.Unlock()
+			}
+		}
+	}()
+
+	return m
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// get returns the live entry for key; the caller must hold the mutex
+func (m *Memory) get(key string) (memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), entry.value...), nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = memoryEntry{value: append([]byte(nil), value...), expiresAt: expiry(ttl)}
+	return nil
+}
+
+func (m *Memory) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.get(key); ok {
+		return false, nil
+	}
+
+	m.entries[key] = memoryEntry{value: append([]byte(nil), value...), expiresAt: expiry(ttl)}
+	return true, nil
+}
+
+func (m *Memory) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.get(key)
+	if !ok {
+		entry = memoryEntry{value: []byte("0"), expiresAt: expiry(ttl)}
+	}
+
+	n, err := strconv.ParseInt(string(entry.value), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	n++
+
+	entry.value = []byte(strconv.FormatInt(n, 10))
+	m.entries[key] = entry
+
+	return n, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *Memory) Lock(ctx context.Context, key string, ttl time.Duration) (func(context.Context) error, error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := m.SetNX(ctx, key, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+
+	unlock := func(context.Context) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// only release the lock if it hasn't expired and been taken by someone else
+		if entry, ok := m.get(key); ok && string(entry.value) == string(token) {
+			delete(m.entries, key)
+		}
+		return nil
+	}
+
+	return unlock, nil
+}
+
+func (m *Memory) Close() error {
+	close(m.done)
+	return nil
+}
+
+// lockToken returns a random value identifying the holder of a lock
+func lockToken() ([]byte, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return []byte(hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,99 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incrScript increments a key and sets its expiry only when the key is created,
+// in a single round trip
+var incrScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n`)
+
+// unlockScript deletes a lock only if it is still held by the caller's token
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Redis is a Store backed by a Redis server, shared by every instance of the API.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the Redis server at url (e.g. redis://localhost:6379/0) and
+// checks that it is reachable.
+func NewRedis(ctx context.Context, url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+
+	err = client.Ping(ctx).Err()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &Redis{client: client}, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+
+	return value, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (r *Redis) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, r.client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+func (r *Redis) Lock(ctx context.Context, key string, ttl time.Duration) (func(context.Context) error, error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := r.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+
+	unlock := func(ctx context.Context) error {
+		return unlockScript.Run(ctx, r.client, []string{key}, token).Err()
+	}
+
+	return unlock, nil
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
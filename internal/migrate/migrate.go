@@ -0,0 +1,293 @@
+// Package migrate applies the SQL migrations of the database schema. It records the
+// schema version in the same schema_migrations table as the migrate CLI, so that a
+// database migrated by either can be managed by the other.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// lockID is the key of the advisory lock held while migrating, so that instances
+// started together don't apply the same migrations
+const lockID = 7291036154
+
+var (
+	// ErrDirty is returned when a migration failed part way in an earlier run of the
+	// migrate CLI; the schema must be repaired by hand and its version set with Force
+	ErrDirty = errors.New("migrate: database is dirty")
+	// ErrUnknownVersion is returned when the database is at a version which has no
+	// migration, such as one applied by a newer binary
+	ErrUnknownVersion = errors.New("migrate: database version has no migration")
+)
+
+var filenameRX = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a change of the schema, made by its up SQL and reverted by its down SQL
+type Migration struct {
+	Version uint64
+	Name    string
+	up      string
+	down    string
+}
+
+// Migrator applies the migrations of a directory to a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+}
+
+// New creates a Migrator for the migration files at the root of fsys. Every
+// migration must have both an up and a down file.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		match := filenameRX.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d has migrations %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.up = string(contents)
+		} else {
+			migration.down = string(contents)
+		}
+	}
+
+	m := &Migrator{db: db}
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migrate: migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	slices.SortFunc(m.migrations, func(a, b *Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return m, nil
+}
+
+// Version returns the version of the database, which is 0 before any migration, and
+// whether it is dirty
+func (m *Migrator) Version(ctx context.Context) (uint64, bool, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+
+	err = ensureTable(ctx, conn)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return version(ctx, conn)
+}
+
+// Up applies every pending migration in order, and returns those it applied
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn, current int) error {
+		for _, migration := range m.migrations[current+1:] {
+			err := apply(ctx, conn, migration.up, int64(migration.Version))
+			if err != nil {
+				return fmt.Errorf("migrate: %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts up to steps of the applied migrations, latest first, and returns
+// those it reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var reverted []*Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn, current int) error {
+		for i := current; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+
+			// the version goes back to the previous migration, or to none
+			previous := int64(-1)
+			if i > 0 {
+				previous = int64(m.migrations[i-1].Version)
+			}
+
+			err := apply(ctx, conn, migration.down, previous)
+			if err != nil {
+				return fmt.Errorf("migrate: %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Force sets the version of the database and marks it clean without running any
+// migration, once the schema has been repaired by hand after a failed migration.
+// Version 0 removes the version.
+func (m *Migrator) Force(ctx context.Context, v uint64) error {
+	if v != 0 && m.index(v) < 0 {
+		return fmt.Errorf("migrate: no migration has version %d", v)
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = ensureTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	next := int64(v)
+	if v == 0 {
+		next = -1
+	}
+	return apply(ctx, conn, "", next)
+}
+
+// locked runs fn holding the migration lock, on a connection which is at the index
+// of its current migration, or -1 before any migration
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, current int) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	err = ensureTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	v, dirty, err := version(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirty, v)
+	}
+
+	current := -1
+	if v != 0 {
+		current = m.index(v)
+		if current < 0 {
+			return fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+		}
+	}
+
+	return fn(conn, current)
+}
+
+// index returns the index of the migration with version v, or -1
+func (m *Migrator) index(v uint64) int {
+	return slices.IndexFunc(m.migrations, func(migration *Migration) bool {
+		return migration.Version == v
+	})
+}
+
+// ensureTable creates the version table if it doesn't exist yet
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint NOT NULL PRIMARY KEY,
+			dirty boolean NOT NULL
+		)`)
+	return err
+}
+
+// version reads the version of the database and whether it is dirty
+func version(ctx context.Context, conn *sql.Conn) (uint64, bool, error) {
+	var v int64
+	var dirty bool
+
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &dirty)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, false, nil
+	case err != nil:
+		return 0, false, err
+	}
+
+	return uint64(v), dirty, nil
+}
+
+// apply runs the SQL of a migration and records the new version of the database, or
+// no version if it is negative, in a single transaction, so that a failed migration
+// leaves the database as it was rather than dirty
+func apply(ctx context.Context, conn *sql.Conn, query string, next int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// without arguments the files are sent as they are, so they may hold several
+	// statements
+	if query != "" {
+		_, err = tx.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+
+	if next >= 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, next)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
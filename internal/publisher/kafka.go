@@ -0,0 +1,53 @@
+package publisher
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka is a Publisher backed by a Kafka cluster. Messages are partitioned by their
+// key, and carry their ID, type and tenant in the message-id, event-type and
+// tenant-id headers.
+type Kafka struct {
+	writer *kafka.Writer
+}
+
+// NewKafka creates a publisher for the Kafka cluster reachable at the given broker
+// addresses (e.g. localhost:9092). Connections are made lazily, on the first
+// publish.
+func NewKafka(brokers []string) *Kafka {
+	return &Kafka{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			// every Publish call is a batch of its own, so there is no point in
+			// waiting for more messages to fill it
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+}
+
+func (p *Kafka) Publish(ctx context.Context, messages []Message) error {
+	msgs := make([]kafka.Message, len(messages))
+	for i, message := range messages {
+		msgs[i] = kafka.Message{
+			Topic: message.Topic,
+			Key:   []byte(message.Key),
+			Value: message.Payload,
+			Headers: []kafka.Header{
+				{Key: "message-id", Value: []byte(message.ID)},
+				{Key: "event-type", Value: []byte(message.Type)},
+				{Key: "tenant-id", Value: []byte(message.Tenant)},
+			},
+		}
+	}
+
+	return p.writer.WriteMessages(ctx, msgs...)
+}
+
+func (p *Kafka) Close() error {
+	return p.writer.Close()
+}
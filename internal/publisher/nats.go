@@ -0,0 +1,55 @@
+package publisher
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATS is a Publisher backed by NATS JetStream. A stream must capture the subjects
+// the messages are published to; the stream drops messages whose ID it has already
+// seen within its duplicate window.
+type NATS struct {
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// NewNATS connects to the NATS server at url (e.g. nats://localhost:4222).
+func NewNATS(url string) (*NATS, error) {
+	conn, err := nats.Connect(url, nats.Name("greenlight"))
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &NATS{conn: conn, js: js}, nil
+}
+
+func (p *NATS) Publish(ctx context.Context, messages []Message) error {
+	for _, message := range messages {
+		msg := nats.NewMsg(message.Topic)
+		msg.Data = message.Payload
+		msg.Header.Set("Greenlight-Event-Type", message.Type)
+		msg.Header.Set("Greenlight-Key", message.Key)
+		msg.Header.Set("Greenlight-Tenant-ID", message.Tenant)
+
+		// JetStream acknowledges every message, so they are published one at a
+		// time to keep them in order
+		_, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(message.ID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *NATS) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,40 @@
+// Package publisher provides a small abstraction for publishing events to a
+// message broker, with implementations for NATS JetStream and Kafka, and one which
+// discards events for deployments without a broker.
+package publisher
+
+import "context"
+
+// Message is an event to publish
+type Message struct {
+	// ID uniquely identifies the message, so that brokers and consumers can drop
+	// the duplicates of a message which was published more than once
+	ID string
+	// Topic is the subject (NATS) or topic (Kafka) the message is published to
+	Topic string
+	// Type is the type of the event, e.g. movie.created
+	Type string
+	// Key identifies the record the event is about; messages with the same key
+	// are kept in order
+	Key string
+	// Tenant is the ID of the tenant whose catalog the event is about
+	Tenant  string
+	Payload []byte
+}
+
+// Publisher is implemented by every broker.
+type Publisher interface {
+	// Publish publishes the messages in order, and only returns once the broker
+	// has acknowledged all of them. If it returns an error, some of the messages
+	// may still have been published.
+	Publish(ctx context.Context, messages []Message) error
+	// Close releases the resources held by the publisher
+	Close() error
+}
+
+// Discard is a Publisher which drops every message.
+type Discard struct{}
+
+func (Discard) Publish(context.Context, []Message) error { return nil }
+
+func (Discard) Close() error { return nil }
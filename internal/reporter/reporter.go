@@ -0,0 +1,44 @@
+// Package reporter provides a small abstraction for reporting server errors and
+// panics to an error tracking service, with an implementation for Sentry and one
+// which drops reports for deployments without such a service.
+package reporter
+
+import (
+	"net/http"
+	"time"
+)
+
+// Report describes a server error, or a recovered panic, and the request it
+// happened in
+type Report struct {
+	Err error
+	// Panic is set when the error is a recovered panic
+	Panic bool
+	// Stack holds the program counters of the stack the error was reported from,
+	// as returned by runtime.Callers
+	Stack []uintptr
+
+	Request   *http.Request
+	RequestID string
+	// Route is the name of the route which handled the request
+	Route string
+	// UserID identifies the client which made the request
+	UserID string
+}
+
+// Reporter is implemented by every error tracking service.
+type Reporter interface {
+	// Report sends a report in the background, so that it doesn't delay the
+	// response to the request
+	Report(report Report)
+	// Flush waits up to timeout for the reports in flight to be sent, and reports
+	// whether they all were
+	Flush(timeout time.Duration) bool
+}
+
+// Discard is a Reporter which drops every report.
+type Discard struct{}
+
+func (Discard) Report(Report) {}
+
+func (Discard) Flush(time.Duration) bool { return true }
@@ -0,0 +1,90 @@
+package reporter
+
+import (
+	"reflect"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Sentry is a Reporter backed by Sentry. Request headers which hold credentials or
+// client addresses are not sent.
+type Sentry struct {
+	client *sentry.Client
+}
+
+// NewSentry creates a reporter for the Sentry project of the given DSN, tagging
+// every event with the environment and release of the server.
+func NewSentry(dsn, environment, release string) (*Sentry, error) {
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+		Release:     release,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sentry{client: client}, nil
+}
+
+func (s *Sentry) Report(report Report) {
+	scope := sentry.NewScope()
+	if report.Request != nil {
+		scope.SetRequest(report.Request)
+	}
+	if report.UserID != "" {
+		scope.SetUser(sentry.User{ID: report.UserID})
+	}
+	if report.RequestID != "" {
+		scope.SetTag("request_id", report.RequestID)
+	}
+	if report.Route != "" {
+		scope.SetTag("route", report.Route)
+	}
+
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelError
+	event.Exception = []sentry.Exception{{
+		Type:       reflect.TypeOf(report.Err).String(),
+		Value:      report.Err.Error(),
+		Stacktrace: stacktrace(report.Stack),
+		Mechanism:  &sentry.Mechanism{Type: "generic", Handled: boolPtr(!report.Panic)},
+	}}
+	if report.Panic {
+		event.Level = sentry.LevelFatal
+	}
+
+	s.client.CaptureEvent(event, nil, scope)
+}
+
+func (s *Sentry) Flush(timeout time.Duration) bool {
+	return s.client.Flush(timeout)
+}
+
+// stacktrace converts program counters to a Sentry stack trace, whose frames go
+// from the outermost call to the innermost
+func stacktrace(pcs []uintptr) *sentry.Stacktrace {
+	if len(pcs) == 0 {
+		return nil
+	}
+
+	var frames []sentry.Frame
+	callers := runtime.CallersFrames(pcs)
+	for {
+		frame, more := callers.Next()
+		frames = append(frames, sentry.NewFrame(frame))
+		if !more {
+			break
+		}
+	}
+	slices.Reverse(frames)
+
+	return &sentry.Stacktrace{Frames: frames}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
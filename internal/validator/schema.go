@@ -0,0 +1,299 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema, in the dialect of OpenAPI 3.0. ValidateSchema supports
+// the keywords the API uses: $ref, type, nullable, enum, oneOf, properties,
+// required, additionalProperties, items, minItems, maxItems, uniqueItems,
+// minLength, maxLength, pattern, format (uri and uuid), minimum and maximum.
+type Schema map[string]any
+
+// patterns caches the compiled regular expressions of pattern keywords
+var patterns sync.Map
+
+// ValidateSchema checks a decoded JSON value against a schema, adding an error for
+// each field which does not conform to it. Fields are named by their path from the
+// root, such as "links.homepage" or "movies[3].genres"; errors about the value as a whole use
+// the given root key. Numbers must have been decoded as json.Number, and $refs are
+// resolved against defs.
+func ValidateSchema(v *Validator, s Schema, defs map[string]Schema, value any, root string) {
+	sv := New()
+	validateSchema(sv, s, defs, value, "")
+
+	for key, messages := range sv.Errors {
+		if key == "" {
+			key = root
+		}
+		for _, message := range messages {
+			v.AddError(key, message)
+		}
+	}
+}
+
+func validateSchema(v *Validator, s Schema, defs map[string]Schema, value any, key string) {
+	if name, ok := s["$ref"].(string); ok {
+		s = defs[strings.TrimPrefix(name, "#/components/schemas/")]
+	}
+
+	if value == nil {
+		nullable, _ := s["nullable"].(bool)
+		v.Check(nullable || s["type"] == nil, key, "must not be null")
+		return
+	}
+
+	if alternatives, ok := s["oneOf"].([]Schema); ok {
+		matches := 0
+		for _, alternative := range alternatives {
+			av := New()
+			validateSchema(av, alternative, defs, value, key)
+			if av.Valid() {
+				matches++
+			}
+		}
+		v.Check(matches == 1, key, oneOfMessage(alternatives))
+		return
+	}
+
+	if typ, ok := s["type"].(string); ok && !hasType(value, typ) {
+		v.AddError(key, typeMessage(typ))
+		return
+	}
+
+	if enum, ok := s["enum"].([]string); ok {
+		str, _ := value.(string)
+		v.Check(PermittedValue(str, enum...), key, "must be one of "+strings.Join(enum, ", "))
+	}
+
+	switch value := value.(type) {
+	case string:
+		validateString(v, s, value, key)
+	case json.Number:
+		validateNumber(v, s, value, key)
+	case []any:
+		validateArray(v, s, defs, value, key)
+	case map[string]any:
+		validateObject(v, s, defs, value, key)
+	}
+}
+
+func validateString(v *Validator, s Schema, value string, key string) {
+	length := utf8.RuneCountInString(value)
+	if min, ok := s["minLength"].(int); ok {
+		v.Check(length >= min, key, fmt.Sprintf("must be at least %d characters long", min))
+	}
+	if max, ok := s["maxLength"].(int); ok {
+		v.Check(length <= max, key, fmt.Sprintf("must not be more than %d characters long", max))
+	}
+
+	if pattern, ok := s["pattern"].(string); ok {
+		rx, cached := patterns.Load(pattern)
+		if !cached {
+			rx, _ = patterns.LoadOrStore(pattern, regexp.MustCompile(pattern))
+		}
+		v.Check(Match(value, rx.(*regexp.Regexp)), key, "has an invalid format")
+	}
+
+	switch s["format"] {
+	case "uri":
+		v.Check(IsURL(value), key, "must be a valid http or https URL")
+	case "uuid":
+		v.Check(Match(value, UUIDRX), key, "must be a valid UUID")
+	}
+}
+
+func validateNumber(v *Validator, s Schema, value json.Number, key string) {
+	n, err := value.Float64()
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return
+	}
+
+	if min, ok := s["minimum"].(int); ok {
+		v.Check(n >= float64(min), key, fmt.Sprintf("must be at least %d", min))
+	}
+	if max, ok := s["maximum"].(int); ok {
+		v.Check(n <= float64(max), key, fmt.Sprintf("must not be more than %d", max))
+	}
+}
+
+func validateArray(v *Validator, s Schema, defs map[string]Schema, value []any, key string) {
+	if min, ok := s["minItems"].(int); ok {
+		v.Check(len(value) >= min, key, fmt.Sprintf("must contain at least %d %s", min, plural(min, "item")))
+	}
+	if max, ok := s["maxItems"].(int); ok {
+		v.Check(len(value) <= max, key, fmt.Sprintf("must not contain more than %d %s", max, plural(max, "item")))
+	}
+
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		seen := make(map[string]bool, len(value))
+		for _, item := range value {
+			js, _ := json.Marshal(item)
+			if seen[string(js)] {
+				v.AddError(key, "must not contain duplicate values")
+				break
+			}
+			seen[string(js)] = true
+		}
+	}
+
+	if items, ok := s["items"].(Schema); ok {
+		for i, item := range value {
+			validateSchema(v, items, defs, item, indexKey(key, i))
+		}
+	}
+}
+
+func validateObject(v *Validator, s Schema, defs map[string]Schema, value map[string]any, key string) {
+	properties, _ := s["properties"].(map[string]Schema)
+
+	if required, ok := s["required"].([]string); ok {
+		for _, name := range required {
+			_, present := value[name]
+			v.Check(present, joinKey(key, name), "must be provided")
+		}
+	}
+
+	for name, field := range value {
+		property, ok := properties[name]
+		if !ok {
+			if additional, ok := s["additionalProperties"].(bool); ok && !additional {
+				if suggestion := nearestName(name, properties); suggestion != "" {
+					v.AddError(joinKey(key, name), fmt.Sprintf("is not a known field; did you mean %q?", suggestion))
+				} else {
+					v.AddError(joinKey(key, name), "is not a known field")
+				}
+			}
+			if additional, ok := s["additionalProperties"].(Schema); ok {
+				validateSchema(v, additional, defs, field, joinKey(key, name))
+			}
+			continue
+		}
+
+		validateSchema(v, property, defs, field, joinKey(key, name))
+	}
+}
+
+// hasType reports whether a decoded JSON value is of a JSON Schema type
+func hasType(value any, typ string) bool {
+	switch typ {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	default:
+		return true
+	}
+}
+
+func typeMessage(typ string) string {
+	switch typ {
+	case "array", "integer", "object":
+		return "must be an " + typ
+	default:
+		return "must be a " + typ
+	}
+}
+
+// oneOfMessage describes the alternatives of a oneOf keyword by their types, such
+// as "must be an integer or a string"
+func oneOfMessage(alternatives []Schema) string {
+	types := make([]string, 0, len(alternatives))
+	for _, alternative := range alternatives {
+		typ, ok := alternative["type"].(string)
+		if !ok {
+			return "must match exactly one of the allowed forms"
+		}
+		types = append(types, strings.TrimPrefix(typeMessage(typ), "must be "))
+	}
+
+	return "must be " + strings.Join(types, " or ")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return noun
+	}
+	return noun + "s"
+}
+
+// nearestName returns the property whose name is closest to the unknown name, as a
+// likely misspelling of it, or an empty string if none is within two edits (and
+// fewer edits than the name has characters). Ties go to the first name in
+// alphabetical order.
+func nearestName(name string, properties map[string]Schema) string {
+	nearest, best := "", 3
+	for property := range properties {
+		d := editDistance(name, property)
+		if d >= utf8.RuneCountInString(name) {
+			continue
+		}
+		if d < best || (d == best && property < nearest) {
+			nearest, best = property, d
+		}
+	}
+	return nearest
+}
+
+// editDistance returns the Levenshtein distance between a and b, the number of
+// single character insertions, deletions and substitutions turning one into the other
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr := make([]int, len(rb)+1)
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(rb)]
+}
+
+// joinKey appends a field name to the path of its parent
+func joinKey(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// indexKey appends the index of an array item to the path of the array, as in
+// "movies[3]"; the items of a root array are named "[3]"
+func indexKey(parent string, i int) string {
+	return parent + "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,207 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ValidateStruct checks the fields of a struct, or of a pointer to one, against the
+// rules in their validate tags, adding the same errors as the equivalent checks would.
+// Fields are named by their json tags, and the fields of nested structs by their path
+// from the root, such as "links.homepage" or "credits[2].name". The rules of a tag are separated by commas:
+//
+//	required      must not be the zero value (an empty slice is allowed, a nil one isn't)
+//	min=N, max=N  bounds the length of strings in bytes, the value of numbers, and the
+//	              number of items of slices
+//	oneof=a b c   strings, and the items of slices of strings, must be one of the values
+//	unique        slices must not contain duplicate values
+//	url           strings which are set must be absolute http or https URLs
+//	uuid          strings which are set must be UUIDs
+//
+// ValidateStruct panics on a malformed tag, as tags are fixed when the code is written.
+func ValidateStruct(v *Validator, s any) {
+	value := reflect.ValueOf(s)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	validateStruct(v, value, "")
+}
+
+// tagRule is a single rule of a validate tag, such as max=500
+type tagRule struct {
+	name  string
+	param string
+}
+
+// structRules caches the parsed validate tags of each struct type, by field index
+var structRules sync.Map
+
+func rulesOf(t reflect.Type) map[int][]tagRule {
+	if rules, ok := structRules.Load(t); ok {
+		return rules.(map[int][]tagRule)
+	}
+
+	rules := make(map[int][]tagRule)
+	for i := range t.NumField() {
+		tag, ok := t.Field(i).Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+
+		for _, part := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch name {
+			case "required", "unique", "url", "uuid":
+			case "min", "max":
+				if _, err := strconv.Atoi(param); err != nil {
+					panic(fmt.Sprintf("validator: %s.%s: %s needs an integer", t, t.Field(i).Name, name))
+				}
+			case "oneof":
+				if param == "" {
+					panic(fmt.Sprintf("validator: %s.%s: oneof needs values", t, t.Field(i).Name))
+				}
+			default:
+				panic(fmt.Sprintf("validator: %s.%s: unknown rule %q", t, t.Field(i).Name, name))
+			}
+			rules[i] = append(rules[i], tagRule{name, param})
+		}
+	}
+
+	actual, _ := structRules.LoadOrStore(t, rules)
+	return actual.(map[int][]tagRule)
+}
+
+func validateStruct(v *Validator, value reflect.Value, prefix string) {
+	t := value.Type()
+	rules := rulesOf(t)
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		key := joinKey(prefix, name)
+
+		fv := value.Field(i)
+		for _, rule := range rules[i] {
+			checkRule(v, rule, fv, key)
+		}
+
+		// nested structs, and the structs in slices, are walked for their own tags
+		if fv.Kind() == reflect.Slice {
+			for j := range fv.Len() {
+				validateNested(v, fv.Index(j), indexKey(key, j))
+			}
+			continue
+		}
+		validateNested(v, fv, key)
+	}
+}
+
+func validateNested(v *Validator, value reflect.Value, key string) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Struct {
+		validateStruct(v, value, key)
+	}
+}
+
+func checkRule(v *Validator, rule tagRule, value reflect.Value, key string) {
+	switch rule.name {
+	case "required":
+		v.Check(!value.IsZero(), key, "must be provided")
+
+	case "min", "max":
+		n, _ := strconv.Atoi(rule.param)
+		checkBound(v, rule.name, n, value, key)
+
+	case "oneof":
+		allowed := strings.Fields(rule.param)
+		switch value.Kind() {
+		case reflect.String:
+			v.Check(value.String() == "" || PermittedValue(value.String(), allowed...), key, "must be "+listOr(allowed))
+		case reflect.Slice:
+			for j := range value.Len() {
+				v.Check(PermittedValue(value.Index(j).String(), allowed...), key, "must only contain "+listOr(allowed))
+			}
+		}
+
+	case "unique":
+		seen := make(map[any]bool, value.Len())
+		for j := range value.Len() {
+			item := value.Index(j).Interface()
+			if seen[item] {
+				v.AddError(key, "must not contain duplicate values")
+				break
+			}
+			seen[item] = true
+		}
+
+	case "url":
+		v.Check(value.String() == "" || IsURL(value.String()), key, "must be a valid http or https URL")
+
+	case "uuid":
+		v.Check(value.String() == "" || Match(value.String(), UUIDRX), key, "must be a valid UUID")
+	}
+}
+
+// checkBound checks a min or max rule of n against a string, number or slice
+func checkBound(v *Validator, bound string, n int, value reflect.Value, key string) {
+	var size float64
+	switch value.Kind() {
+	case reflect.String, reflect.Slice:
+		size = float64(value.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	}
+
+	var messages [2]string
+	switch value.Kind() {
+	case reflect.String:
+		messages = [2]string{fmt.Sprintf("must be at least %d bytes long", n), fmt.Sprintf("must not be more than %d bytes long", n)}
+	case reflect.Slice:
+		messages = [2]string{
+			fmt.Sprintf("must contain at least %d %s", n, plural(n, "item")),
+			fmt.Sprintf("must not contain more than %d %s", n, plural(n, "item")),
+		}
+	default:
+		messages = [2]string{fmt.Sprintf("must be at least %d", n), fmt.Sprintf("must not be more than %d", n)}
+	}
+
+	if bound == "min" {
+		v.Check(size >= float64(n), key, messages[0])
+	} else {
+		v.Check(size <= float64(n), key, messages[1])
+	}
+}
+
+// listOr joins values as in "a, b or c"
+func listOr(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
@@ -2,22 +2,30 @@
 package validator
 
 import (
+	"cmp"
+	"net/url"
 	"regexp"
 	"slices"
+	"strings"
+	"time"
 )
 
 // declare a regular expression for sanity-checking the email address
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
-// Validator contains a map of validation errors
+// declare a regular expression matching the canonical textual form of a UUID
+var UUIDRX = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+// Validator contains a map of validation errors, holding every failed check of each
+// key in the order the checks were made
 type Validator struct {
-	Errors map[string]string
+	Errors map[string][]string
 }
 
 // constructor for Validator
 func New() *Validator {
 	return &Validator{
-		Errors: make(map[string]string),
+		Errors: make(map[string][]string),
 	}
 }
 
@@ -26,11 +34,29 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-// AddError adds an error message to the map (if it doesn't exist already)
+// AddError adds an error message for the key (if the key doesn't have it already)
 func (v *Validator) AddError(key string, message string) {
-	if _, exists := v.Errors[key]; !exists {
-		v.Errors[key] = message
+	if !slices.Contains(v.Errors[key], message) {
+		v.Errors[key] = append(v.Errors[key], message)
+	}
+}
+
+// Error returns the first error message of the key, or an empty string if it has none
+func (v *Validator) Error(key string) string {
+	if messages := v.Errors[key]; len(messages) > 0 {
+		return messages[0]
+	}
+	return ""
+}
+
+// FirstErrors returns the first error message of each key, for callers which report
+// a single error per key
+func (v *Validator) FirstErrors() map[string]string {
+	errs := make(map[string]string, len(v.Errors))
+	for key := range v.Errors {
+		errs[key] = v.Error(key)
 	}
+	return errs
 }
 
 // Check adds an error message to the map if the validation check is ok
@@ -46,6 +72,41 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return slices.Contains(permittedValues, value)
 }
 
+// In is a shorter name for PermittedValue
+func In[T comparable](value T, permittedValues ...T) bool {
+	return PermittedValue(value, permittedValues...)
+}
+
+// Between returns true if a value is within the inclusive range from min to max
+func Between[T cmp.Ordered](value, min, max T) bool {
+	return value >= min && value <= max
+}
+
+// MinLength returns true if a string is at least n bytes long
+func MinLength(value string, n int) bool {
+	return len(value) >= n
+}
+
+// MaxLength returns true if a string is at most n bytes long
+func MaxLength(value string, n int) bool {
+	return len(value) <= n
+}
+
+// NotBlank returns true if a string contains more than whitespace
+func NotBlank(value string) bool {
+	return strings.TrimSpace(value) != ""
+}
+
+// MinItems returns true if a slice has at least n items; a nil slice has none
+func MinItems[T any](values []T, n int) bool {
+	return len(values) >= n
+}
+
+// MaxItems returns true if a slice has at most n items
+func MaxItems[T any](values []T, n int) bool {
+	return len(values) <= n
+}
+
 // Matches returns true if a string matches a specific regex pattern
 func Match(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
@@ -61,3 +122,20 @@ func Unique[T comparable](values []T) bool {
 
 	return len(values) == len(uniqueValues)
 }
+
+// IsURL returns true if a string is an absolute http or https URL with a host
+func IsURL(value string) bool {
+	u, err := url.ParseRequestURI(value)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// IsISODate returns true if a string is a calendar date in the ISO 8601 form
+// YYYY-MM-DD, such as 2024-02-29
+func IsISODate(value string) bool {
+	_, err := time.Parse(time.DateOnly, value)
+	return err == nil
+}
@@ -0,0 +1,188 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinLength(t *testing.T) {
+	tests := []struct {
+		value string
+		n     int
+		want  bool
+	}{
+		{"", 0, true},
+		{"", 1, false},
+		{"a", 1, true},
+		{"abc", 2, true},
+		{"ab", 3, false},
+		// the length is counted in bytes
+		{"é", 2, true},
+	}
+
+	for _, tt := range tests {
+		if got := MinLength(tt.value, tt.n); got != tt.want {
+			t.Errorf("MinLength(%q, %d) = %t; want %t", tt.value, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	tests := []struct {
+		value string
+		n     int
+		want  bool
+	}{
+		{"", 0, true},
+		{"a", 0, false},
+		{"abc", 3, true},
+		{"abcd", 3, false},
+		{strings.Repeat("x", 500), 500, true},
+		{strings.Repeat("x", 501), 500, false},
+		{"é", 1, false},
+	}
+
+	for _, tt := range tests {
+		if got := MaxLength(tt.value, tt.n); got != tt.want {
+			t.Errorf("MaxLength(%q, %d) = %t; want %t", tt.value, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		value, min, max int
+		want            bool
+	}{
+		{5, 1, 10, true},
+		{1, 1, 10, true},
+		{10, 1, 10, true},
+		{0, 1, 10, false},
+		{11, 1, 10, false},
+		{-5, -10, -1, true},
+		{3, 3, 3, true},
+	}
+
+	for _, tt := range tests {
+		if got := Between(tt.value, tt.min, tt.max); got != tt.want {
+			t.Errorf("Between(%d, %d, %d) = %t; want %t", tt.value, tt.min, tt.max, got, tt.want)
+		}
+	}
+
+	if !Between("m", "a", "z") || Between("A", "a", "z") {
+		t.Error("Between compares strings in byte order")
+	}
+}
+
+func TestIn(t *testing.T) {
+	tests := []struct {
+		value     string
+		permitted []string
+		want      bool
+	}{
+		{"atomic", []string{"atomic", "best_effort"}, true},
+		{"best_effort", []string{"atomic", "best_effort"}, true},
+		{"Atomic", []string{"atomic", "best_effort"}, false},
+		{"", []string{"atomic"}, false},
+		{"atomic", nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := In(tt.value, tt.permitted...); got != tt.want {
+			t.Errorf("In(%q, %q) = %t; want %t", tt.value, tt.permitted, got, tt.want)
+		}
+	}
+}
+
+func TestNotBlank(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", false},
+		{" ", false},
+		{"\t\n ", false},
+		{"a", true},
+		{"  a  ", true},
+	}
+
+	for _, tt := range tests {
+		if got := NotBlank(tt.value); got != tt.want {
+			t.Errorf("NotBlank(%q) = %t; want %t", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"https://example.com", true},
+		{"http://example.com/path?q=1", true},
+		{"https://example.com:8443/", true},
+		{"", false},
+		{"example.com", false},
+		{"/relative/path", false},
+		{"ftp://example.com", false},
+		{"javascript:alert(1)", false},
+		{"https://", false},
+		{"https:///path", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsURL(tt.value); got != tt.want {
+			t.Errorf("IsURL(%q) = %t; want %t", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsISODate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"2024-02-29", true},
+		{"2026-10-15", true},
+		{"2023-02-29", false},
+		{"2026-13-01", false},
+		{"2026-1-5", false},
+		{"15/10/2026", false},
+		{"2026-10-15T00:00:00Z", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsISODate(tt.value); got != tt.want {
+			t.Errorf("IsISODate(%q) = %t; want %t", tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestGenreItems covers the genre count checks of ValidateMovie, which must reject
+// an empty and an oversized list of genres
+func TestGenreItems(t *testing.T) {
+	tests := []struct {
+		name   string
+		genres []string
+		min    bool
+		max    bool
+	}{
+		{"nil", nil, false, true},
+		{"empty", []string{}, false, true},
+		{"one", []string{"drama"}, true, true},
+		{"five", []string{"action", "comedy", "drama", "horror", "sci-fi"}, true, true},
+		{"six", []string{"action", "comedy", "drama", "horror", "sci-fi", "western"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MinItems(tt.genres, 1); got != tt.min {
+				t.Errorf("MinItems(%q, 1) = %t; want %t", tt.genres, got, tt.min)
+			}
+			if got := MaxItems(tt.genres, 5); got != tt.max {
+				t.Errorf("MaxItems(%q, 5) = %t; want %t", tt.genres, got, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+ALTER TABLE movies DROP COLUMN IF EXISTS trailer_url;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS homepage;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS wiki;
@@ -0,0 +1,5 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS trailer_url text NOT NULL DEFAULT '';
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS homepage text NOT NULL DEFAULT '';
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS wiki text NOT NULL DEFAULT '';
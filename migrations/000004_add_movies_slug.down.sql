@@ -0,0 +1,3 @@
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_slug_key;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,17 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS slug text;
+
+UPDATE movies m
+SET slug = s.slug
+FROM (
+    SELECT id,
+        CASE WHEN row_number() OVER (PARTITION BY base ORDER BY id) = 1 THEN base ELSE base || '-' || id END AS slug
+    FROM (
+        SELECT id, coalesce(nullif(trim(both '-' FROM regexp_replace(lower(title), '[^a-z0-9]+', '-', 'g')), ''), 'movie') AS base
+        FROM movies
+    ) b
+) s
+WHERE m.id = s.id;
+
+ALTER TABLE movies ALTER COLUMN slug SET NOT NULL;
+
+ALTER TABLE movies ADD CONSTRAINT movies_slug_key UNIQUE (slug);
@@ -0,0 +1,3 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS uuid uuid NOT NULL DEFAULT gen_random_uuid();
+
+ALTER TABLE movies ADD CONSTRAINT movies_uuid_key UNIQUE (uuid);
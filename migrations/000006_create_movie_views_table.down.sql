@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movies_created_at_idx;
+
+DROP TABLE IF EXISTS movie_views;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS movie_views (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    bucket timestamp(0) with time zone NOT NULL,
+    views bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (movie_id, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS movie_views_bucket_idx ON movie_views (bucket);
+
+CREATE INDEX IF NOT EXISTS movies_created_at_idx ON movies (created_at);
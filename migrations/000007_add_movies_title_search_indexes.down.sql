@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movies_title_trgm_idx;
+
+DROP INDEX IF EXISTS movies_title_prefix_idx;
@@ -0,0 +1,5 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS movies_title_prefix_idx ON movies (lower(title) text_pattern_ops);
+
+CREATE INDEX IF NOT EXISTS movies_title_trgm_idx ON movies USING gin (lower(title) gin_trgm_ops);
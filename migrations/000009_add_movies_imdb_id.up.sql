@@ -0,0 +1,3 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS imdb_id text;
+
+ALTER TABLE movies ADD CONSTRAINT movies_imdb_id_key UNIQUE (imdb_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_event_types_idx ON webhooks USING GIN (event_types);
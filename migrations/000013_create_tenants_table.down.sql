@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS movies_tenant_id_idx;
+
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_imdb_id_key;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_slug_key;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE movies ADD CONSTRAINT movies_slug_key UNIQUE (slug);
+ALTER TABLE movies ADD CONSTRAINT movies_imdb_id_key UNIQUE (imdb_id);
+
+DROP TABLE IF EXISTS tenants;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS tenants (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    slug text NOT NULL,
+    api_key_hash bytea NOT NULL,
+    CONSTRAINT tenants_slug_key UNIQUE (slug),
+    CONSTRAINT tenants_api_key_hash_key UNIQUE (api_key_hash)
+);
+
+-- the default tenant owns the movies created before tenants were introduced; it has
+-- no API key, as no key hashes to a single zero byte
+INSERT INTO tenants (id, name, slug, api_key_hash)
+VALUES (1, 'Default', 'default', '\x00')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval('tenants_id_seq', (SELECT max(id) FROM tenants));
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants;
+ALTER TABLE movies ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- slugs and IMDb IDs are unique within a catalog
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_slug_key;
+ALTER TABLE movies ADD CONSTRAINT movies_slug_key UNIQUE (tenant_id, slug);
+
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_imdb_id_key;
+ALTER TABLE movies ADD CONSTRAINT movies_imdb_id_key UNIQUE (tenant_id, imdb_id);
+
+CREATE INDEX IF NOT EXISTS movies_tenant_id_idx ON movies (tenant_id, created_at);
@@ -0,0 +1,12 @@
+-- a redirect is left behind by a movie merged into another, so that its ID and UUID
+-- keep resolving to the movie it was merged into
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    old_id bigint PRIMARY KEY,
+    old_uuid uuid NOT NULL,
+    tenant_id bigint NOT NULL REFERENCES tenants ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT movie_redirects_old_uuid_key UNIQUE (old_uuid)
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_movie_id_idx ON movie_redirects (movie_id);
@@ -0,0 +1,7 @@
+-- the requests made with the API key of a tenant, counted by UTC day
+CREATE TABLE IF NOT EXISTS tenant_usage (
+    tenant_id bigint NOT NULL REFERENCES tenants ON DELETE CASCADE,
+    day date NOT NULL,
+    requests bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, day)
+);
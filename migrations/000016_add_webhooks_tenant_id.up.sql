@@ -0,0 +1,6 @@
+-- the webhooks created before tenants were introduced subscribe to the events of the
+-- default tenant
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants ON DELETE CASCADE;
+ALTER TABLE webhooks ALTER COLUMN tenant_id DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS webhooks_tenant_id_idx ON webhooks (tenant_id, id);
@@ -0,0 +1,5 @@
+-- the messages recorded before tenants were introduced are about the movies of the
+-- default tenant. There is no foreign key, so that the messages about a tenant are
+-- still published after it is deleted.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1;
+ALTER TABLE outbox ALTER COLUMN tenant_id DROP DEFAULT;
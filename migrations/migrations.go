@@ -0,0 +1,11 @@
+// Package migrations embeds the SQL migrations of the database schema, so that the
+// binaries can apply them (see internal/migrate).
+package migrations
+
+import "embed"
+
+// FS holds the migration files, named <version>_<name>.up.sql and
+// <version>_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS